@@ -3,6 +3,10 @@ package main
 import (
 	_ "avito/docs"
 	"avito/internal/app"
+	"fmt"
+	"os"
+	"strings"
+	_ "time/tzdata"
 )
 
 // @title Avito-tech
@@ -13,6 +17,37 @@ import (
 // @host localhost:8080
 // @BasePath /
 // @Schemes http
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
-	app.InitApi()
+	command, args := "serve", []string{}
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+	// the flags without a command are the flags of the server
+	if strings.HasPrefix(command, "-") && command != "-h" && command != "--help" {
+		command, args = "serve", os.Args[1:]
+	}
+	switch command {
+	case "serve":
+		app.InitApi(args)
+	case "migrate":
+		os.Exit(app.Migrate(args))
+	case "report":
+		os.Exit(app.Report(args))
+	case "reconcile":
+		os.Exit(app.Reconcile(args))
+	case "export":
+		os.Exit(app.Export(args))
+	case "user":
+		os.Exit(app.User(args))
+	case "keys":
+		os.Exit(app.Keys(args))
+	case "help", "-h", "--help":
+		fmt.Print(app.Usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, app.Usage)
+		os.Exit(2)
+	}
 }
@@ -1,19 +1,185 @@
 // Package configs contains the configuration for launching all application components
 package configs
 
-// Common - common config
+import "time"
+
+// Common - common config. The fields are loaded by Load, the env tag is the name of the variable and
+// the validate tag is checked at startup
 type Common struct {
 	ServiceHost string `env:"SERVICE_HOST" envDefault:"localhost"`
-	ServicePort int    `env:"SERVICE_PORT" envDefault:"8080"`
+	ServicePort int    `env:"SERVICE_PORT" envDefault:"8080" validate:"min=1,max=65535"`
+	// AccountingTimezone - IANA time zone in which report periods and statements are calculated
+	AccountingTimezone string `env:"ACCOUNTING_TIMEZONE" envDefault:"UTC" validate:"timezone"`
+	// ReportRetention - how long the generated reports are available for download, 0 keeps them until restart
+	ReportRetention time.Duration `env:"REPORT_RETENTION" envDefault:"24h" validate:"gte=0"`
 	ConfigDB
+	ConfigHTTP
+	ConfigCORS
+	ConfigLog
+	ConfigHealth
+	ConfigTracing
+	ConfigAuth
+	ConfigJournal
+	ConfigWebhooks
+	ConfigBroker
+	ConfigOutbox
+	ConfigCommands
+	ConfigAudit
 }
 
 // ConfigDB - database connection config
 type ConfigDB struct {
-	DbHost     string `env:"DB_HOST" envDefault:"localhost"`
-	DbPort     int    `env:"DB_PORT" envDefault:"5432"`
-	DbName     string `env:"DB_NAME" envDefault:"postgres"`
-	DbUsername string `env:"DB_USERNAME" envDefault:"postgres"`
+	DbHost     string `env:"DB_HOST" envDefault:"localhost" validate:"required"`
+	DbPort     int    `env:"DB_PORT" envDefault:"5432" validate:"min=1,max=65535"`
+	DbName     string `env:"DB_NAME" envDefault:"postgres" validate:"required"`
+	DbUsername string `env:"DB_USERNAME" envDefault:"postgres" validate:"required"`
 	DbPassword string `env:"DB_PASSWORD"`
-	DbSslmode  string `env:"DB_SSLMODE" envDefault:"disable"`
+	DbSslmode  string `env:"DB_SSLMODE" envDefault:"disable" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	// DbMaxConns and DbMinConns - size of the connection pool
+	DbMaxConns int32 `env:"DB_MAX_CONNS" envDefault:"10" validate:"min=1"`
+	DbMinConns int32 `env:"DB_MIN_CONNS" envDefault:"0" validate:"min=0,ltefield=DbMaxConns"`
+	// DbConnectTimeout - timeout of establishing a connection
+	DbConnectTimeout time.Duration `env:"DB_CONNECT_TIMEOUT" envDefault:"5s" validate:"gt=0"`
+	// DbMaxConnLifetime and DbMaxConnIdleTime - a connection is closed when it is older or idle for longer
+	DbMaxConnLifetime time.Duration `env:"DB_MAX_CONN_LIFETIME" envDefault:"1h" validate:"gt=0"`
+	DbMaxConnIdleTime time.Duration `env:"DB_MAX_CONN_IDLE_TIME" envDefault:"30m" validate:"gt=0"`
+	// DbStatementTimeout - statement_timeout of the sessions, 0 disables it. The bulk exports run as one statement
+	DbStatementTimeout time.Duration `env:"DB_STATEMENT_TIMEOUT" envDefault:"0" validate:"gte=0"`
+	// MigrateOnStart - apply the pending migrations before the server starts
+	MigrateOnStart bool `env:"MIGRATE_ON_START" envDefault:"false"`
+	// MigrateLegacyTimezone - IANA time zone of the timestamps written without the zone before they were
+	// converted to timestamptz, it is the time zone the service ran in before the conversion
+	MigrateLegacyTimezone string `env:"MIGRATE_LEGACY_TIMEZONE" envDefault:"UTC" validate:"timezone"`
+}
+
+// ConfigHTTP - limits of the HTTP server. WriteTimeout limits the whole response, so with a value other than 0
+// the event streams and the large exports are cut off
+type ConfigHTTP struct {
+	HTTPReadTimeout  time.Duration `env:"HTTP_READ_TIMEOUT" envDefault:"30s" validate:"gt=0"`
+	HTTPWriteTimeout time.Duration `env:"HTTP_WRITE_TIMEOUT" envDefault:"0" validate:"gte=0"`
+	// HTTPIdleTimeout - how long an idle keep-alive connection is kept open
+	HTTPIdleTimeout time.Duration `env:"HTTP_IDLE_TIMEOUT" envDefault:"60s" validate:"gt=0"`
+	// HTTPMaxBodySize - maximum size of the request body in bytes
+	HTTPMaxBodySize int `env:"HTTP_MAX_BODY_SIZE" envDefault:"4194304" validate:"min=1"`
+	// HTTPMaxJSONBodySize - maximum size of the JSON body of the API calls, the larger ones get 413
+	HTTPMaxJSONBodySize int `env:"HTTP_MAX_JSON_BODY_SIZE" envDefault:"65536" validate:"min=1,ltefield=HTTPMaxBodySize"`
+}
+
+// ConfigCORS - cross-origin requests of the browsers. An origin is an exact scheme://host[:port], * allows any
+// origin and https://*.example.com any subdomain. The credentials can't be allowed for any origin
+type ConfigCORS struct {
+	CORSAllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS" envSeparator:"," envDefault:"*"`
+	CORSAllowedMethods []string `env:"CORS_ALLOWED_METHODS" envSeparator:"," envDefault:"GET,POST,DELETE" validate:"dive,oneof=GET HEAD POST PUT PATCH DELETE"`
+	// CORSAllowedHeaders - request headers the browser may send, * allows any header
+	CORSAllowedHeaders []string `env:"CORS_ALLOWED_HEADERS" envSeparator:"," envDefault:"Accept,Content-Type,Authorization,X-API-Key,X-Request-ID,traceparent,tracestate"`
+	// CORSExposedHeaders - response headers the browser scripts may read
+	CORSExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" envSeparator:"," envDefault:"X-Request-ID,Content-Disposition"`
+	CORSAllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" envDefault:"false"`
+	CORSMaxAge           time.Duration `env:"CORS_MAX_AGE" envDefault:"10m" validate:"gte=0"`
+}
+
+// ConfigLog - level, format and output of the log
+type ConfigLog struct {
+	LogLevel  string `env:"LOG_LEVEL" envDefault:"info" validate:"oneof=debug info warn error"`
+	LogFormat string `env:"LOG_FORMAT" envDefault:"text" validate:"oneof=text json"`
+	LogOutput string `env:"LOG_OUTPUT" envDefault:"stdout" validate:"oneof=stdout stderr"`
+}
+
+// ConfigHealth - readiness of the service. On shutdown the service reports that it is not ready and waits
+// ShutdownDelay before it stops, so the load balancer stops sending the traffic first
+type ConfigHealth struct {
+	// ReadinessTimeout - timeout of each check of the readiness
+	ReadinessTimeout time.Duration `env:"READINESS_TIMEOUT" envDefault:"2s" validate:"gt=0"`
+	ShutdownDelay    time.Duration `env:"SHUTDOWN_DELAY" envDefault:"5s" validate:"gte=0"`
+}
+
+// ConfigTracing - export of the OpenTelemetry traces. TracingEndpoint is the host:port of the collector,
+// when it is empty the default address of the exporter is used
+type ConfigTracing struct {
+	TracingExporter    string  `env:"TRACING_EXPORTER" envDefault:"none" validate:"oneof=none stdout otlp-grpc otlp-http"`
+	TracingEndpoint    string  `env:"TRACING_ENDPOINT"`
+	TracingInsecure    bool    `env:"TRACING_INSECURE" envDefault:"true"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1" validate:"gte=0,lte=1"`
+	TracingServiceName string  `env:"TRACING_SERVICE_NAME" envDefault:"avito-balance" validate:"required"`
+}
+
+// ConfigAuth - authentication of the client services by the API keys. Without it any caller may use
+// any endpoint, it is meant only for the local development
+type ConfigAuth struct {
+	AuthEnabled bool `env:"AUTH_ENABLED" envDefault:"true"`
+}
+
+// ConfigJournal - chart of accounts used when exporting journal entries for the general ledger.
+// The accounts of charges can be overridden for each service in the catalog
+type ConfigJournal struct {
+	CashAccount     string `env:"JOURNAL_CASH_ACCOUNT" envDefault:"51" validate:"required"`
+	UsersAccount    string `env:"JOURNAL_USERS_ACCOUNT" envDefault:"62.02" validate:"required"`
+	ReservedAccount string `env:"JOURNAL_RESERVED_ACCOUNT" envDefault:"76.09" validate:"required"`
+	RevenueAccount  string `env:"JOURNAL_REVENUE_ACCOUNT" envDefault:"90.01" validate:"required"`
+	// AdjustmentAccount - account of the manual corrections of the balances
+	AdjustmentAccount string `env:"JOURNAL_ADJUSTMENT_ACCOUNT" envDefault:"91.01" validate:"required"`
+}
+
+// ConfigWebhooks - delivery of the outgoing webhooks. A failed delivery is retried with the exponential
+// backoff starting from WebhookBackoffBase, after WebhookMaxAttempts attempts it is dead-lettered
+type ConfigWebhooks struct {
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"10" validate:"min=1"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s" validate:"gt=0"`
+	WebhookBackoffBase  time.Duration `env:"WEBHOOK_BACKOFF_BASE" envDefault:"30s" validate:"gt=0"`
+	WebhookBackoffMax   time.Duration `env:"WEBHOOK_BACKOFF_MAX" envDefault:"6h" validate:"gtefield=WebhookBackoffBase"`
+	WebhookPollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL" envDefault:"1s" validate:"gt=0"`
+}
+
+// ConfigBroker - addresses of the message brokers
+type ConfigBroker struct {
+	KafkaBrokers []string `env:"KAFKA_BROKERS" envSeparator:"," envDefault:"localhost:9092"`
+	NatsURL      string   `env:"NATS_URL" envDefault:"nats://localhost:4222"`
+}
+
+// ConfigOutbox - publishing of the domain events from the outbox to the message broker. OutboxPublisher is
+// kafka, nats, file or none, with none the events stay in the outbox until a publisher is configured
+type ConfigOutbox struct {
+	OutboxPublisher    string        `env:"OUTBOX_PUBLISHER" envDefault:"none" validate:"oneof=none kafka nats file memory"`
+	OutboxBatch        int           `env:"OUTBOX_BATCH" envDefault:"100" validate:"min=1"`
+	OutboxPollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" envDefault:"1s" validate:"gt=0"`
+	// OutboxRetention - how long the published events are kept in the outbox
+	OutboxRetention time.Duration `env:"OUTBOX_RETENTION" envDefault:"168h" validate:"gt=0"`
+	// OutboxLease - how long a claimed batch is reserved for the relay publishing it, it must be longer than
+	// the publishing of a batch takes, the events of a relay that stopped are published again after it
+	OutboxLease time.Duration `env:"OUTBOX_LEASE" envDefault:"1m" validate:"gt=0"`
+	KafkaTopic  string        `env:"KAFKA_TOPIC" envDefault:"avito.events"`
+	// NatsSubject - prefix of the subjects, the events are published to <prefix>.<event type>
+	// and must be captured by a JetStream stream
+	NatsSubject string `env:"NATS_SUBJECT" envDefault:"avito.events"`
+	OutboxFile  string `env:"OUTBOX_FILE" envDefault:"outbox.jsonl"`
+}
+
+// ConfigCommands - consumption of the commands from the message broker. CommandConsumer is kafka, nats
+// or none. A command that fails with a server error is retried CommandMaxAttempts times before
+// it is dead-lettered
+type ConfigCommands struct {
+	CommandConsumer    string        `env:"COMMAND_CONSUMER" envDefault:"none" validate:"oneof=none kafka nats"`
+	CommandTopic       string        `env:"COMMAND_TOPIC" envDefault:"avito.commands"`
+	CommandGroup       string        `env:"COMMAND_GROUP" envDefault:"avito-balance"`
+	ReplyTopic         string        `env:"COMMAND_REPLY_TOPIC" envDefault:"avito.replies"`
+	DeadLetterTopic    string        `env:"COMMAND_DEAD_LETTER_TOPIC" envDefault:"avito.commands.dlq"`
+	CommandMaxAttempts int           `env:"COMMAND_MAX_ATTEMPTS" envDefault:"5" validate:"min=1"`
+	CommandRetryDelay  time.Duration `env:"COMMAND_RETRY_DELAY" envDefault:"1s" validate:"gte=0"`
+}
+
+// ConfigAudit - chaining of the entries of the audit log. The entries are appended without the hash and are
+// chained every AuditChainInterval, AuditChainBatch entries at a time
+type ConfigAudit struct {
+	AuditChainInterval time.Duration `env:"AUDIT_CHAIN_INTERVAL" envDefault:"1s" validate:"gt=0"`
+	AuditChainBatch    int           `env:"AUDIT_CHAIN_BATCH" envDefault:"1000" validate:"min=1"`
+}
+
+// AllowsAnyOrigin - reports whether the cross-origin requests are allowed from any origin
+func (c ConfigCORS) AllowsAnyOrigin() bool {
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
 }
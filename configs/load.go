@@ -0,0 +1,171 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/caarlos0/env/v6"
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// secretSuffix - suffix of the variable holding the path of the file with the value of the variable,
+// for the secrets mounted into the container: DB_PASSWORD_FILE=/run/secrets/db_password
+const secretSuffix = "_FILE"
+
+// Load - loads the configuration in layers, each one overrides the previous: the defaults, the YAML file
+// (if file is not empty), the environment with the variables of the .env file (if it exists) and
+// the overrides in the KEY=VALUE form. The YAML file is a flat map of the names of the variables.
+// Any variable can be read from the file set by <name>_FILE. The loaded configuration is validated
+func Load(file string, overrides []string) (*Common, error) {
+	known := make(map[string]bool)
+	variables(reflect.TypeOf(Common{}), known)
+	values := make(map[string]string)
+	if file != "" {
+		layer, err := readYAML(file)
+		if err != nil {
+			return nil, err
+		}
+		if err = merge(values, layer, known, file, true); err != nil {
+			return nil, err
+		}
+	}
+	environment, err := godotenv.Read(".env")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("cannot load .env: %w", err)
+	}
+	if environment == nil {
+		environment = make(map[string]string)
+	}
+	// the variables set by the environment take precedence over the .env file
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			environment[k] = v
+		}
+	}
+	if err = merge(values, environment, known, "environment", false); err != nil {
+		return nil, err
+	}
+	layer := make(map[string]string, len(overrides))
+	for _, o := range overrides {
+		k, v, ok := strings.Cut(o, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid override %q, expected KEY=VALUE", o)
+		}
+		layer[strings.ToUpper(strings.TrimSpace(k))] = v
+	}
+	if err = merge(values, layer, known, "flags", true); err != nil {
+		return nil, err
+	}
+	var cfg Common
+	if err = env.Parse(&cfg, env.Options{Environment: values}); err != nil {
+		return nil, err
+	}
+	if err = Validate(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate - checks the values of the configuration, the error names the variables with the invalid values
+func Validate(cfg *Common) error {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("env")
+	})
+	err := v.Struct(cfg)
+	var fieldErrors validator.ValidationErrors
+	if err != nil && !errors.As(err, &fieldErrors) {
+		return err
+	}
+	messages := make([]string, 0, len(fieldErrors)+1)
+	for _, e := range fieldErrors {
+		rule := e.Tag()
+		if e.Param() != "" {
+			rule += "=" + e.Param()
+		}
+		messages = append(messages, fmt.Sprintf("%s=%v does not satisfy %s", e.Field(), e.Value(), rule))
+	}
+	// the browsers reject the credentials of the responses allowed for any origin
+	if cfg.CORSAllowCredentials && cfg.AllowsAnyOrigin() {
+		messages = append(messages, "CORS_ALLOW_CREDENTIALS=true requires the explicit CORS_ALLOWED_ORIGINS")
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config: %s", strings.Join(messages, "; "))
+}
+
+// merge - copies the variables of the configuration from the layer into values, reading the variables
+// set by <name>_FILE. With strict an unknown variable is an error, otherwise it is skipped
+func merge(values, layer map[string]string, known map[string]bool, source string, strict bool) error {
+	for k, v := range layer {
+		if name := strings.TrimSuffix(k, secretSuffix); name != k && known[name] {
+			if _, ok := layer[name]; ok {
+				return fmt.Errorf("%s: both %s and %s are set", source, name, k)
+			}
+			data, err := os.ReadFile(v)
+			if err != nil {
+				return fmt.Errorf("%s: cannot read %s: %w", source, k, err)
+			}
+			values[name] = strings.TrimRight(string(data), "\r\n")
+			continue
+		}
+		if !known[k] {
+			if strict {
+				return fmt.Errorf("%s: unknown variable %s", source, k)
+			}
+			continue
+		}
+		values[k] = v
+	}
+	return nil
+}
+
+// readYAML - reads the flat YAML map of the variables, the lists are joined with commas
+func readYAML(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+	var raw map[string]interface{}
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("cannot parse config file %s: %w", file, err)
+	}
+	layer := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch value := v.(type) {
+		case nil:
+			layer[strings.ToUpper(k)] = ""
+		case []interface{}:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			layer[strings.ToUpper(k)] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("config file %s: %s must be a value, the file is a flat map of the variables",
+				file, k)
+		default:
+			layer[strings.ToUpper(k)] = fmt.Sprint(value)
+		}
+	}
+	return layer, nil
+}
+
+// variables - collects the names of the variables of the struct and its embedded structs
+func variables(t reflect.Type, known map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name := field.Tag.Get("env"); name != "" {
+			known[name] = true
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			variables(field.Type, known)
+		}
+	}
+}
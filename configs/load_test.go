@@ -0,0 +1,286 @@
+package configs
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	tableTest := []struct {
+		testName           string
+		yaml               string
+		environment        map[string]string
+		overrides          []string
+		expectedLogLevel   string
+		expectedMaxConns   int32
+		expectedCORSOrigin []string
+	}{
+		{
+			"defaults",
+			"",
+			nil,
+			nil,
+			"info",
+			10,
+			[]string{"*"},
+		},
+		{
+			"yaml overrides the defaults",
+			"LOG_LEVEL: debug\ndb_max_conns: 20\nCORS_ALLOWED_ORIGINS: [https://a.example, https://b.example]\n",
+			nil,
+			nil,
+			"debug",
+			20,
+			[]string{"https://a.example", "https://b.example"},
+		},
+		{
+			"environment overrides yaml",
+			"LOG_LEVEL: debug\nDB_MAX_CONNS: 20\n",
+			map[string]string{"LOG_LEVEL": "warn", "UNRELATED_VARIABLE": "skipped"},
+			nil,
+			"warn",
+			20,
+			[]string{"*"},
+		},
+		{
+			"flags override environment",
+			"LOG_LEVEL: debug\nDB_MAX_CONNS: 20\n",
+			map[string]string{"LOG_LEVEL": "warn", "DB_MAX_CONNS": "25"},
+			[]string{"LOG_LEVEL=error", "db_max_conns=30"},
+			"error",
+			30,
+			[]string{"*"},
+		},
+	}
+	for _, testCase := range tableTest {
+		clearEnvironment(t)
+		for k, v := range testCase.environment {
+			t.Setenv(k, v)
+		}
+		file := ""
+		if testCase.yaml != "" {
+			file = writeFile(t, "config.yaml", testCase.yaml)
+		}
+		cfg, err := Load(file, testCase.overrides)
+		if !assert.Nil(t, err, testCase.testName) {
+			continue
+		}
+		assert.Equal(t, testCase.expectedLogLevel, cfg.LogLevel, testCase.testName)
+		assert.Equal(t, testCase.expectedMaxConns, cfg.DbMaxConns, testCase.testName)
+		assert.Equal(t, testCase.expectedCORSOrigin, cfg.CORSAllowedOrigins, testCase.testName)
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	secret := writeFile(t, "db_password", "s3cr=t\n")
+	tableTest := []struct {
+		testName         string
+		yaml             string
+		environment      map[string]string
+		overrides        []string
+		expectedPassword string
+		expectedError    string
+	}{
+		{
+			"environment",
+			"",
+			map[string]string{"DB_PASSWORD_FILE": secret},
+			nil,
+			"s3cr=t",
+			"",
+		},
+		{
+			"yaml",
+			"DB_PASSWORD_FILE: " + secret + "\n",
+			nil,
+			nil,
+			"s3cr=t",
+			"",
+		},
+		{
+			"file of the environment overrides the value of yaml",
+			"DB_PASSWORD: plain\n",
+			map[string]string{"DB_PASSWORD_FILE": secret},
+			nil,
+			"s3cr=t",
+			"",
+		},
+		{
+			"flag overrides the file",
+			"",
+			map[string]string{"DB_PASSWORD_FILE": secret},
+			[]string{"DB_PASSWORD=plain"},
+			"plain",
+			"",
+		},
+		{
+			"both value and file",
+			"",
+			map[string]string{"DB_PASSWORD": "plain", "DB_PASSWORD_FILE": secret},
+			nil,
+			"",
+			"environment: both DB_PASSWORD and DB_PASSWORD_FILE are set",
+		},
+		{
+			"missing file",
+			"",
+			map[string]string{"DB_PASSWORD_FILE": filepath.Join(t.TempDir(), "missing")},
+			nil,
+			"",
+			"environment: cannot read DB_PASSWORD_FILE",
+		},
+	}
+	for _, testCase := range tableTest {
+		clearEnvironment(t)
+		for k, v := range testCase.environment {
+			t.Setenv(k, v)
+		}
+		file := ""
+		if testCase.yaml != "" {
+			file = writeFile(t, "config.yaml", testCase.yaml)
+		}
+		cfg, err := Load(file, testCase.overrides)
+		if testCase.expectedError != "" {
+			if assert.NotNil(t, err, testCase.testName) {
+				assert.True(t, strings.HasPrefix(err.Error(), testCase.expectedError), testCase.testName)
+			}
+			continue
+		}
+		if assert.Nil(t, err, testCase.testName) {
+			assert.Equal(t, testCase.expectedPassword, cfg.DbPassword, testCase.testName)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tableTest := []struct {
+		testName      string
+		yaml          string
+		overrides     []string
+		expectedError string
+	}{
+		{
+			"unknown yaml key",
+			"DB_HOSTNAME: db\n",
+			nil,
+			"%s: unknown variable DB_HOSTNAME",
+		},
+		{
+			"nested yaml map",
+			"DB:\n  HOST: db\n",
+			nil,
+			"config file %s: DB must be a value, the file is a flat map of the variables",
+		},
+		{
+			"malformed yaml",
+			"LOG_LEVEL: [debug\n",
+			nil,
+			"cannot parse config file %s",
+		},
+		{
+			"unknown flag",
+			"",
+			[]string{"LOG_LEVL=debug"},
+			"flags: unknown variable LOG_LEVL",
+		},
+		{
+			"invalid flag",
+			"",
+			[]string{"LOG_LEVEL"},
+			`invalid override "LOG_LEVEL", expected KEY=VALUE`,
+		},
+		{
+			"invalid value",
+			"",
+			[]string{"DB_MAX_CONNS=many"},
+			`env: parse error on field "DbMaxConns"`,
+		},
+	}
+	for _, testCase := range tableTest {
+		clearEnvironment(t)
+		file, expectedError := "", testCase.expectedError
+		if testCase.yaml != "" {
+			// the errors of the file name it
+			file = writeFile(t, "config.yaml", testCase.yaml)
+			expectedError = fmt.Sprintf(expectedError, file)
+		}
+		_, err := Load(file, testCase.overrides)
+		if assert.NotNil(t, err, testCase.testName) {
+			assert.True(t, strings.HasPrefix(err.Error(), expectedError), testCase.testName+": "+err.Error())
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tableTest := []struct {
+		testName      string
+		overrides     []string
+		expectedError string
+	}{
+		{
+			"valid",
+			[]string{"CORS_ALLOW_CREDENTIALS=true", "CORS_ALLOWED_ORIGINS=https://a.example"},
+			"",
+		},
+		{
+			"invalid level",
+			[]string{"LOG_LEVEL=verbose"},
+			"invalid config: LOG_LEVEL=verbose does not satisfy oneof=debug info warn error",
+		},
+		{
+			"invalid time zone",
+			[]string{"ACCOUNTING_TIMEZONE=Mars/Olympus"},
+			"invalid config: ACCOUNTING_TIMEZONE=Mars/Olympus does not satisfy timezone",
+		},
+		{
+			"several invalid variables",
+			[]string{"SERVICE_PORT=0", "TRACING_SAMPLE_RATIO=2"},
+			"invalid config: SERVICE_PORT=0 does not satisfy min=1; TRACING_SAMPLE_RATIO=2 does not satisfy lte=1",
+		},
+		{
+			"credentials for any origin",
+			[]string{"CORS_ALLOW_CREDENTIALS=true"},
+			"invalid config: CORS_ALLOW_CREDENTIALS=true requires the explicit CORS_ALLOWED_ORIGINS",
+		},
+	}
+	for _, testCase := range tableTest {
+		clearEnvironment(t)
+		_, err := Load("", testCase.overrides)
+		if testCase.expectedError == "" {
+			assert.Nil(t, err, testCase.testName)
+			continue
+		}
+		if assert.NotNil(t, err, testCase.testName) {
+			assert.Equal(t, testCase.expectedError, err.Error(), testCase.testName)
+		}
+	}
+}
+
+// clearEnvironment - unsets the variables of the configuration for the test, so the environment
+// of the machine running the tests doesn't change the loaded configuration
+func clearEnvironment(t *testing.T) {
+	t.Helper()
+	known := make(map[string]bool)
+	variables(reflect.TypeOf(Common{}), known)
+	for name := range known {
+		for _, k := range []string{name, name + secretSuffix} {
+			t.Setenv(k, "")
+			os.Unsetenv(k)
+		}
+	}
+}
+
+// writeFile - writes the file into the temporary directory of the test, returns its path
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
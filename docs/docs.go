@@ -21,6 +21,11 @@ const docTemplate = `{
     "paths": {
         "/accrual": {
             "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "accepts amount and user ID",
                 "consumes": [
                     "application/json"
@@ -57,6 +62,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/app.response"
                         }
                     },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
                     "500": {
                         "description": "server error",
                         "schema": {
@@ -66,36 +83,74 @@ const docTemplate = `{
                 }
             }
         },
-        "/cancel_order": {
-            "post": {
-                "description": "accepts order id",
-                "consumes": [
-                    "application/json"
+        "/admin/audit": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
+                "description": "the entries are returned in the order of the log, the next page starts after the last audit_id",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "admin"
                 ],
-                "summary": "Unblocks the user's funds when the service is canceled",
-                "operationId": "unblock-funds",
+                "summary": "Returns the entries of the audit log of the mutating calls",
+                "operationId": "get-audit",
                 "parameters": [
                     {
-                        "description": "order id for unblock",
-                        "name": "unblock_request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Unblock"
-                        }
+                        "type": "string",
+                        "description": "client of the API key, anonymous for the calls without a valid key",
+                        "name": "client",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "user, sender or receiver of the call",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "path of the call, e.g. /accrual",
+                        "name": "endpoint",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "beginning of the period: RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end of the period (exclusive): RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "the entries after this audit id",
+                        "name": "after_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "number of entries, 100 by default and 1000 at most",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "success",
                         "schema": {
-                            "$ref": "#/definitions/app.response"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditEntry"
+                            }
                         }
                     },
                     "400": {
@@ -113,36 +168,65 @@ const docTemplate = `{
                 }
             }
         },
-        "/charge": {
-            "post": {
-                "description": "accepts user id, service id, order id, amount",
-                "consumes": [
-                    "application/json"
+        "/admin/audit/export": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
+                "description": "accepts the filters of the audit log except the limit, the whole log can be verified\noutside the service by recalculating the hashes of the export\nthe export interrupted by an error ends with the {\"error\": \"...\"} line",
                 "produces": [
-                    "application/json"
+                    "application/x-ndjson"
                 ],
                 "tags": [
-                    "order"
+                    "admin"
                 ],
-                "summary": "Withdraws previously blocked funds",
-                "operationId": "charge-funds",
+                "summary": "Streams the entries of the audit log with their hashes as JSON lines",
+                "operationId": "export-audit",
                 "parameters": [
                     {
-                        "description": "data for charge funds",
-                        "name": "charge_request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Order"
-                        }
+                        "type": "string",
+                        "description": "client of the API key",
+                        "name": "client",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "user, sender or receiver of the call",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "path of the call",
+                        "name": "endpoint",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "beginning of the period: RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end of the period (exclusive): RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "the entries after this audit id",
+                        "name": "after_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "success",
+                        "description": "audit log entries",
                         "schema": {
-                            "$ref": "#/definitions/app.response"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -150,52 +234,31 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/app.response"
                         }
-                    },
-                    "500": {
-                        "description": "server error",
-                        "schema": {
-                            "$ref": "#/definitions/app.response"
-                        }
                     }
                 }
             }
         },
-        "/create_order": {
-            "post": {
-                "description": "accepts user id, service id, order id, amount",
-                "consumes": [
-                    "application/json"
+        "/admin/audit/verify": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
+                "description": "recalculates the hashes of all entries, broken_at is the first entry that was changed\nor follows a removed one",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
-                ],
-                "summary": "Blocks user funds when ordering a service",
-                "operationId": "block-funds",
-                "parameters": [
-                    {
-                        "description": "data for order",
-                        "name": "block_request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Order"
-                        }
-                    }
+                    "admin"
                 ],
+                "summary": "Checks the hash chain of the whole audit log",
+                "operationId": "verify-audit",
                 "responses": {
-                    "201": {
-                        "description": "success",
-                        "schema": {
-                            "$ref": "#/definitions/app.response"
-                        }
-                    },
-                    "400": {
-                        "description": "bad request",
+                    "200": {
+                        "description": "result of the check",
                         "schema": {
-                            "$ref": "#/definitions/app.response"
+                            "$ref": "#/definitions/models.AuditVerification"
                         }
                     },
                     "500": {
@@ -207,36 +270,62 @@ const docTemplate = `{
                 }
             }
         },
-        "/get_balance": {
-            "post": {
-                "description": "accepts user id",
-                "consumes": [
-                    "application/json"
+        "/admin/export/{table}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
+                "description": "accepts table, format (csv, ndjson or parquet), period and user id, memory usage does not depend on the size of the export\nthe export interrupted by an error ends with the error record: a \"#error: ...\" line in CSV\nor an object with the error field in NDJSON, the parquet file is left without the footer",
                 "produces": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
                 ],
                 "tags": [
-                    "user"
+                    "admin"
                 ],
-                "summary": "Returns the user's current balance",
-                "operationId": "get-balance",
+                "summary": "Streams a bulk export of the transactions or orders table",
+                "operationId": "export-table",
                 "parameters": [
                     {
+                        "type": "string",
+                        "description": "table: transactions or orders",
+                        "name": "table",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv (default), ndjson or parquet",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "beginning of the period: RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "end of the period (exclusive): RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
                         "description": "user id",
-                        "name": "id",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.UserBalance"
-                        }
+                        "name": "user_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "success",
+                        "description": "exported rows",
                         "schema": {
-                            "$ref": "#/definitions/app.response"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -244,46 +333,46 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/app.response"
                         }
-                    },
-                    "500": {
-                        "description": "server error",
-                        "schema": {
-                            "$ref": "#/definitions/app.response"
-                        }
                     }
                 }
             }
         },
-        "/get_report": {
+        "/admin/journal": {
             "post": {
-                "description": "accepts year and month",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts year, month and format: csv (default) or jsonl",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson"
                 ],
                 "tags": [
-                    "order"
+                    "admin"
                 ],
-                "summary": "Requests a financial report on paid services for the month",
-                "operationId": "get-report",
+                "summary": "Exports the money movements of the month as journal entries for the general ledger system",
+                "operationId": "export-journal",
                 "parameters": [
                     {
-                        "description": "data for get report",
-                        "name": "report_request",
+                        "description": "period and format of the journal",
+                        "name": "journal_request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Report"
+                            "$ref": "#/definitions/models.JournalRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "success",
+                        "description": "journal entries",
                         "schema": {
-                            "$ref": "#/definitions/app.response"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -292,6 +381,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/app.response"
                         }
                     },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
                     "500": {
                         "description": "server error",
                         "schema": {
@@ -301,42 +402,46 @@ const docTemplate = `{
                 }
             }
         },
-        "/reports/": {
+        "/admin/keys": {
             "get": {
-                "description": "accepts report key",
-                "tags": [
-                    "order"
-                ],
-                "summary": "Downloads a file with a report in CSV format",
-                "operationId": "download-file",
-                "parameters": [
+                "security": [
                     {
-                        "type": "string",
-                        "description": "report key",
-                        "name": "report",
-                        "in": "query",
-                        "required": true
+                        "ApiKeyAuth": []
                     }
                 ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Returns the API keys with their scopes, without the keys themselves",
+                "operationId": "get-api-keys",
                 "responses": {
                     "200": {
                         "description": "success",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.APIKey"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "not found",
+                    "500": {
+                        "description": "server error",
                         "schema": {
                             "$ref": "#/definitions/app.response"
                         }
                     }
                 }
-            }
-        },
-        "/transactions": {
+            },
             "post": {
-                "description": "accepts user id, order by data, limit and offset",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts client name and scopes: funds:accrue, funds:transfer, orders:write, balances:read,\nreports:read, audit:read or admin, and the user_id of the key issued for a user,\nthe key is returned only in this response",
                 "consumes": [
                     "application/json"
                 ],
@@ -344,29 +449,26 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "transaction"
+                    "admin"
                 ],
-                "summary": "Requests a list of all user transactions with comments",
-                "operationId": "get-transactions",
+                "summary": "Issues the API key of the client service with the scopes",
+                "operationId": "issue-api-key",
                 "parameters": [
                     {
-                        "description": "data for get transactions",
-                        "name": "transactions_request",
+                        "description": "client and scopes",
+                        "name": "key",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.TransactionListRequest"
+                            "$ref": "#/definitions/models.APIKey"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
+                    "201": {
                         "description": "success",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.TransactionList"
-                            }
+                            "$ref": "#/definitions/models.APIKey"
                         }
                     },
                     "400": {
@@ -375,6 +477,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/app.response"
                         }
                     },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
                     "500": {
                         "description": "server error",
                         "schema": {
@@ -384,29 +498,28 @@ const docTemplate = `{
                 }
             }
         },
-        "/transfer": {
-            "post": {
-                "description": "accepts sender id, receiver id, amount",
-                "consumes": [
-                    "application/json"
+        "/admin/keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "admin"
                 ],
-                "summary": "Makes a transfer of funds between two users",
-                "operationId": "transfer-funds",
+                "summary": "Revokes the API key, the calls with it are rejected at once",
+                "operationId": "revoke-api-key",
                 "parameters": [
                     {
-                        "description": "data for transfer funds",
-                        "name": "transfer_request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Transfer"
-                        }
+                        "type": "integer",
+                        "description": "key id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -422,6 +535,1171 @@ const docTemplate = `{
                             "$ref": "#/definitions/app.response"
                         }
                     },
+                    "404": {
+                        "description": "key not found",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/reconcile": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts an optional year and month for the revenue check, the whole time is checked by default",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reconciles users' balances, orders and charged revenue with the transaction history",
+                "operationId": "reconcile",
+                "parameters": [
+                    {
+                        "description": "period for the revenue check",
+                        "name": "reconciliation_request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReconciliationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "discrepancy report",
+                        "schema": {
+                            "$ref": "#/definitions/models.Reconciliation"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/services": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Returns the service catalog",
+                "operationId": "get-services",
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ServiceInfo"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts service id, name and optional accounts for the journal entries of charges",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Adds the service to the catalog or updates the existing one",
+                "operationId": "upsert-service",
+                "parameters": [
+                    {
+                        "description": "service catalog entry",
+                        "name": "service",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ServiceInfo"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/transactions/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts transaction id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Returns any transaction with the linked order, the mirror transaction of a transfer and its reversals",
+                "operationId": "get-transaction-admin",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "transaction id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/models.TransactionDetail"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "404": {
+                        "description": "transaction not found",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Returns the webhook subscriptions without their secrets",
+                "operationId": "get-webhooks",
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookSubscription"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts url, event types and optional secret of at least 16 characters, the secret is generated\nwhen it is not supplied and returned only in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Subscribes the endpoint to the events of the given types",
+                "operationId": "create-webhook",
+                "parameters": [
+                    {
+                        "description": "webhook subscription",
+                        "name": "subscription",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookSubscription"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Returns the latest webhook deliveries with the results of the last attempts",
+                "operationId": "get-webhook-deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "subscription id",
+                        "name": "subscription_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "delivery status: pending, delivered or dead",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "number of deliveries, 100 by default and 1000 at most",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/deliveries/{id}/replay": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Schedules the webhook delivery again with a fresh number of attempts",
+                "operationId": "replay-webhook-delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "delivery id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "404": {
+                        "description": "delivery not found",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Deletes the webhook subscription, its pending deliveries are dead-lettered",
+                "operationId": "delete-webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "subscription id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "404": {
+                        "description": "subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/cancel_order": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts order id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Unblocks the user's funds when the service is canceled",
+                "operationId": "unblock-funds",
+                "parameters": [
+                    {
+                        "description": "order id for unblock",
+                        "name": "unblock_request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Unblock"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/charge": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts user id, service id, order id, amount",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Withdraws previously blocked funds",
+                "operationId": "charge-funds",
+                "parameters": [
+                    {
+                        "description": "data for charge funds",
+                        "name": "charge_request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/create_order": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts user id, service id, order id, amount",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Blocks user funds when ordering a service",
+                "operationId": "block-funds",
+                "parameters": [
+                    {
+                        "description": "data for order",
+                        "name": "block_request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/get_balance": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts user id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Returns the user's current balance",
+                "operationId": "get-balance",
+                "parameters": [
+                    {
+                        "description": "user id",
+                        "name": "id",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserBalance"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/get_report": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts year and month",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Requests a financial report on paid services for the month",
+                "operationId": "get-report",
+                "parameters": [
+                    {
+                        "description": "data for get report",
+                        "name": "report_request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Report"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Liveness probe, the process is alive",
+                "operationId": "healthz",
+                "responses": {
+                    "200": {
+                        "description": "alive",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "checks the database with a ping, the applied migrations and the background workers.\nThe service is not ready during the graceful shutdown",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness probe, the service can take the traffic",
+                "operationId": "readyz",
+                "responses": {
+                    "200": {
+                        "description": "ready",
+                        "schema": {
+                            "$ref": "#/definitions/models.Readiness"
+                        }
+                    },
+                    "503": {
+                        "description": "not ready",
+                        "schema": {
+                            "$ref": "#/definitions/models.Readiness"
+                        }
+                    }
+                }
+            }
+        },
+        "/reports/": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts report key",
+                "tags": [
+                    "order"
+                ],
+                "summary": "Downloads a file with a report in CSV format",
+                "operationId": "download-file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "report key",
+                        "name": "report",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "not found",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts user id, after a reconnect the transactions made after Last-Event-ID are sent first",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Streams the balance changes and new transactions of the user as Server-Sent Events",
+                "operationId": "stream-events",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user id",
+                        "name": "user_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the last received transaction, for clients that can't set Last-Event-ID",
+                        "name": "last_event_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id of the last received transaction",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "language of the descriptions: ru (default) or en, overrides Accept-Language",
+                        "name": "lang",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "503": {
+                        "description": "server is shutting down",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/transactions": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts user id, sort keys, filters, limit and the cursor of the next page (or offset), optionally returns the total count and the summary of the filtered transactions",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Requests a list of all user transactions with comments",
+                "operationId": "get-transactions",
+                "parameters": [
+                    {
+                        "description": "data for get transactions",
+                        "name": "transactions_request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.TransactionListRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "language of the descriptions: ru (default) or en, overrides Accept-Language",
+                        "name": "lang",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preferred languages of the descriptions",
+                        "name": "Accept-Language",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/models.TransactionPage"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/transactions/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts transaction id, the user is the one the API key is issued for and the transaction\nof another user is not found. The key of a client service without a user gets 403",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Returns the user's transaction with the linked order, the mirror transaction of a transfer and its reversals",
+                "operationId": "get-transaction",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "transaction id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "user id, required without the authentication, otherwise it must be the user of the key",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "language of the descriptions: ru (default) or en, overrides Accept-Language",
+                        "name": "lang",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/models.TransactionDetail"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "403": {
+                        "description": "the key is not issued for the user",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "404": {
+                        "description": "transaction not found",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "500": {
+                        "description": "server error",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/transfer": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "accepts sender id, receiver id, amount",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Makes a transfer of funds between two users",
+                "operationId": "transfer-funds",
+                "parameters": [
+                    {
+                        "description": "data for transfer funds",
+                        "name": "transfer_request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Transfer"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "400": {
+                        "description": "bad request",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "413": {
+                        "description": "request body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
+                    "415": {
+                        "description": "unsupported content type",
+                        "schema": {
+                            "$ref": "#/definitions/app.response"
+                        }
+                    },
                     "500": {
                         "description": "server error",
                         "schema": {
@@ -439,40 +1717,352 @@ const docTemplate = `{
                 "description": {
                     "type": "string"
                 },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/parser.FieldError"
+                    }
+                },
                 "success": {
                     "type": "boolean"
                 }
             }
         },
-        "models.AccrualFunds": {
+        "models.APIKey": {
+            "type": "object",
+            "required": [
+                "client",
+                "scopes"
+            ],
+            "properties": {
+                "client": {
+                    "type": "string",
+                    "maxLength": 64
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "key_id": {
+                    "type": "integer"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "minItems": 1,
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "user_id": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "models.AccrualFunds": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "comment": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "external_reference": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "operation": {
+                    "type": "string",
+                    "enum": [
+                        "accrual",
+                        "refund"
+                    ]
+                },
+                "order_id": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "user_id": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "models.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "audit_id": {
+                    "type": "integer"
+                },
+                "balances": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "chain_seq": {
+                    "type": "integer"
+                },
+                "client": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "key_id": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "prev_hash": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "source_ip": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.AuditVerification": {
+            "type": "object",
+            "properties": {
+                "broken_at": {
+                    "type": "integer"
+                },
+                "entries": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.BalanceDiscrepancy": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "number"
+                },
+                "difference": {
+                    "type": "number"
+                },
+                "ledger": {
+                    "type": "number"
+                },
+                "reserved": {
+                    "type": "number"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.HealthCheck": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "ok": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.JournalRequest": {
+            "type": "object",
+            "required": [
+                "month",
+                "year"
+            ],
+            "properties": {
+                "format": {
+                    "type": "string",
+                    "enum": [
+                        "csv",
+                        "jsonl"
+                    ]
+                },
+                "month": {
+                    "type": "integer",
+                    "maximum": 12,
+                    "minimum": 1
+                },
+                "year": {
+                    "type": "integer",
+                    "minimum": 2007
+                }
+            }
+        },
+        "models.Order": {
             "type": "object",
             "properties": {
                 "amount": {
                     "type": "number"
                 },
+                "block": {
+                    "type": "boolean"
+                },
+                "comment": {
+                    "description": "Comment and ExternalReference are stored in the reservation transaction",
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "date": {
+                    "type": "string"
+                },
+                "external_reference": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "order_id": {
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "service_id": {
+                    "type": "integer",
+                    "minimum": 1
+                },
                 "user_id": {
                     "type": "integer",
                     "minimum": 1
                 }
             }
         },
-        "models.Order": {
+        "models.OrderDetail": {
             "type": "object",
             "properties": {
                 "amount": {
                     "type": "number"
                 },
+                "date": {
+                    "type": "string"
+                },
                 "order_id": {
-                    "type": "integer",
-                    "minimum": 1
+                    "type": "integer"
+                },
+                "refunded": {
+                    "type": "number"
                 },
                 "service_id": {
-                    "type": "integer",
-                    "minimum": 1
+                    "type": "integer"
+                },
+                "service_name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
                 },
                 "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.OrdersTotals": {
+            "type": "object",
+            "properties": {
+                "debited": {
+                    "type": "number"
+                },
+                "difference": {
+                    "type": "number"
+                },
+                "ordered": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.Readiness": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.HealthCheck"
+                    }
+                },
+                "ready": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.Reconciliation": {
+            "type": "object",
+            "properties": {
+                "balanced": {
+                    "type": "boolean"
+                },
+                "balances": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.BalanceDiscrepancy"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "orders": {
+                    "$ref": "#/definitions/models.OrdersTotals"
+                },
+                "revenue": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.RevenueDiscrepancy"
+                    }
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ReconciliationRequest": {
+            "type": "object",
+            "properties": {
+                "month": {
                     "type": "integer",
+                    "maximum": 12,
                     "minimum": 1
+                },
+                "year": {
+                    "type": "integer",
+                    "minimum": 2007
                 }
             }
         },
@@ -483,6 +2073,12 @@ const docTemplate = `{
                 "year"
             ],
             "properties": {
+                "data": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
                 "month": {
                     "type": "integer",
                     "maximum": 12,
@@ -494,18 +2090,129 @@ const docTemplate = `{
                 }
             }
         },
+        "models.RevenueDiscrepancy": {
+            "type": "object",
+            "properties": {
+                "charged": {
+                    "type": "number"
+                },
+                "difference": {
+                    "type": "number"
+                },
+                "ledger": {
+                    "type": "number"
+                },
+                "service_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ServiceInfo": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "credit_account": {
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "debit_account": {
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "service_id": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "models.SortKey": {
+            "type": "object",
+            "properties": {
+                "direction": {
+                    "type": "string",
+                    "enum": [
+                        "asc",
+                        "desc"
+                    ]
+                },
+                "field": {
+                    "type": "string",
+                    "enum": [
+                        "amount",
+                        "date_time"
+                    ]
+                }
+            }
+        },
+        "models.TransactionDetail": {
+            "type": "object",
+            "properties": {
+                "mirror": {
+                    "$ref": "#/definitions/models.TransactionList"
+                },
+                "order": {
+                    "$ref": "#/definitions/models.OrderDetail"
+                },
+                "reversals": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.TransactionList"
+                    }
+                },
+                "transaction": {
+                    "$ref": "#/definitions/models.TransactionList"
+                }
+            }
+        },
         "models.TransactionList": {
             "type": "object",
             "properties": {
                 "amount": {
                     "type": "number"
                 },
+                "counterparty_user_id": {
+                    "type": "integer"
+                },
                 "date": {
                     "type": "string"
                 },
+                "description": {
+                    "description": "Description is rendered from the message template in the requested language",
+                    "type": "string"
+                },
+                "external_reference": {
+                    "type": "string"
+                },
                 "message": {
                     "type": "string"
                 },
+                "message_code": {
+                    "type": "string"
+                },
+                "message_params": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "operation": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "parent_transaction_id": {
+                    "type": "integer"
+                },
+                "service_id": {
+                    "type": "integer"
+                },
                 "transaction_id": {
                     "type": "integer"
                 },
@@ -517,6 +2224,34 @@ const docTemplate = `{
         "models.TransactionListRequest": {
             "type": "object",
             "properties": {
+                "amount_max": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "amount_min": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "counterparty_user_id": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "cursor": {
+                    "type": "string"
+                },
+                "date_from": {
+                    "type": "string"
+                },
+                "date_to": {
+                    "type": "string"
+                },
+                "direction": {
+                    "type": "string",
+                    "enum": [
+                        "in",
+                        "out"
+                    ]
+                },
                 "limit": {
                     "type": "integer",
                     "minimum": 0
@@ -525,12 +2260,80 @@ const docTemplate = `{
                     "type": "integer",
                     "minimum": 0
                 },
+                "operation": {
+                    "type": "string",
+                    "enum": [
+                        "accrual",
+                        "reservation",
+                        "charge",
+                        "cancellation",
+                        "transfer_in",
+                        "transfer_out",
+                        "refund",
+                        "adjustment"
+                    ]
+                },
                 "order_by": {
                     "type": "string"
                 },
+                "order_id": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "sort": {
+                    "type": "array",
+                    "maxItems": 2,
+                    "uniqueItems": true,
+                    "items": {
+                        "$ref": "#/definitions/models.SortKey"
+                    }
+                },
                 "user_id": {
                     "type": "integer",
                     "minimum": 1
+                },
+                "with_summary": {
+                    "type": "boolean"
+                },
+                "with_total": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.TransactionPage": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "type": "string"
+                },
+                "summary": {
+                    "$ref": "#/definitions/models.TransactionSummary"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.TransactionList"
+                    }
+                }
+            }
+        },
+        "models.TransactionSummary": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "incoming": {
+                    "type": "number"
+                },
+                "net": {
+                    "type": "number"
+                },
+                "outgoing": {
+                    "type": "number"
                 }
             }
         },
@@ -540,6 +2343,10 @@ const docTemplate = `{
                 "amount": {
                     "type": "number"
                 },
+                "comment": {
+                    "type": "string",
+                    "maxLength": 255
+                },
                 "receiver_id": {
                     "type": "integer",
                     "minimum": 1
@@ -553,20 +2360,128 @@ const docTemplate = `{
         "models.Unblock": {
             "type": "object",
             "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "comment": {
+                    "type": "string",
+                    "maxLength": 255
+                },
                 "order_id": {
                     "type": "integer",
                     "minimum": 1
+                },
+                "user_id": {
+                    "type": "integer",
+                    "minimum": 0
                 }
             }
         },
         "models.UserBalance": {
             "type": "object",
             "properties": {
+                "balance": {
+                    "type": "number"
+                },
                 "user_id": {
                     "type": "integer",
                     "minimum": 1
                 }
             }
+        },
+        "models.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "delivery_id": {
+                    "type": "integer"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_status_code": {
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "subscription_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.WebhookSubscription": {
+            "type": "object",
+            "required": [
+                "event_types",
+                "url"
+            ],
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "event_types": {
+                    "type": "array",
+                    "minItems": 1,
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "minLength": 16
+                },
+                "subscription_id": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string",
+                    "maxLength": 2048
+                }
+            }
+        },
+        "parser.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
         }
     }
 }`
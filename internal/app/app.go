@@ -5,17 +5,25 @@ package app
 
 import (
 	"avito/configs"
+	"avito/internal/broker"
+	"avito/internal/metrics"
 	"avito/internal/parser"
 	"avito/internal/repository"
 	"avito/internal/service"
+	"avito/internal/tracing"
 	"avito/pkg/logger"
+	"avito/schema"
+	"context"
+	"flag"
 	"fmt"
-	"github.com/caarlos0/env/v6"
-	"github.com/joho/godotenv"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/valyala/fasthttp"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 // App -  object responsible for working with the request and extracting data from it
@@ -26,48 +34,168 @@ type App struct {
 	parser        *parser.Parser
 	logger        logger.Logger
 	store         *reportStore
+	location      *time.Location
+	// publisher and consumer are nil when the domain events are not published and the commands are not consumed
+	publisher broker.Publisher
+	consumer  broker.Consumer
+	// stopWorkers stops the background workers started with the server
+	stopWorkers context.CancelFunc
+	// workers - running state of the background workers by name, checked by the readiness probe
+	workers sync.Map
+	// shuttingDown is set on the shutdown signal, the service is not ready from then on
+	shuttingDown atomic.Bool
 }
 
 // NewApp - constructor function for App
 func NewApp() *App {
 	return &App{
 		defaultServer: &fasthttp.Server{},
-		parser:        parser.NewParser(),
 		logger:        logger.New(),
 	}
 }
 
-// ParseConfig - function for parsing config from env
-func (a *App) ParseConfig() {
-	if err := godotenv.Load(".env"); err != nil {
-		a.logger.Fatalf("cannot load env: %s", err.Error())
+// ParseConfig - function for loading the config from the defaults, the YAML file, env and the flags.
+// The .env file is optional, the variables may be set by the environment
+func (a *App) ParseConfig(flags *configFlags) {
+	cfg, err := configs.Load(flags.file, flags.overrides)
+	if err != nil {
+		a.logger.Fatalf("cannot load config: %s", err.Error())
+	}
+	location, err := time.LoadLocation(cfg.AccountingTimezone)
+	if err != nil {
+		a.logger.Fatalf("invalid accounting timezone: %s", err.Error())
 	}
-	var cfg configs.Common
-	if err := env.Parse(&cfg); err != nil {
-		a.logger.Fatalf("cannot parse config: %s", err.Error())
+	log := logger.New()
+	if err = log.Configure(cfg.LogLevel, cfg.LogFormat, cfg.LogOutput); err != nil {
+		a.logger.Fatalf("invalid log config: %s", err.Error())
 	}
-	a.config = &cfg
+	a.logger = log
+	a.config = cfg
+	a.location = location
+	a.parser = parser.NewParser(cfg.HTTPMaxJSONBodySize)
+	a.defaultServer.ReadTimeout = cfg.HTTPReadTimeout
+	a.defaultServer.WriteTimeout = cfg.HTTPWriteTimeout
+	a.defaultServer.IdleTimeout = cfg.HTTPIdleTimeout
+	a.defaultServer.MaxRequestBodySize = cfg.HTTPMaxBodySize
 }
 
-// InitApi -  initializes the application
-func InitApi() {
+// InitApi -  initializes the application, args are the flags of the serve command
+func InitApi(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	cf := newConfigFlags(flags)
+	flags.Parse(args)
 	a := NewApp()
-	a.ParseConfig()
-	repo, err := repository.NewPostgresDB(a.config.ConfigDB)
+	a.ParseConfig(cf)
+	shutdownTracing, err := tracing.Init(a.config.ConfigTracing)
 	if err != nil {
-		a.logger.Fatalf("init db error: %s", err.Error())
+		a.logger.Fatalf("init tracing error: %s", err.Error())
+	}
+	repo := a.initServices(true)
+	if a.config.MigrateOnStart {
+		if err := a.applyMigrations(repo); err != nil {
+			a.logger.Fatalf("migration error: %s", err.Error())
+		}
 	}
-	r := repository.NewRepository(repo)
-	s := service.NewService(r)
-	a.services = s
 	storage := reportStore{
-		reports: make(map[string][]byte),
+		reports:   make(map[string][]byte),
+		retention: a.config.ReportRetention,
 	}
 	a.store = &storage
+	if err := metrics.RegisterPool(repo); err != nil {
+		a.logger.Fatalf("metrics error: %s", err.Error())
+	}
+	reservations := func() (int64, float64, error) {
+		return a.services.GetOpenReservations(context.Background())
+	}
+	if err := metrics.RegisterReservations(reservations); err != nil {
+		a.logger.Fatalf("metrics error: %s", err.Error())
+	}
 	router := a.Routing()
-	a.defaultServer.Handler = router.Handler
+	a.defaultServer.Handler = a.Metrics(a.Tracing(a.RequestID(a.CORS(router.Handler))))
+	a.startWorkers()
 	a.Run()
+	if a.consumer != nil {
+		if err := a.consumer.Close(); err != nil {
+			a.logger.Errorf("consumer closing error: %s", err.Error())
+		}
+	}
+	if a.publisher != nil {
+		if err := a.publisher.Close(); err != nil {
+			a.logger.Errorf("publisher closing error: %s", err.Error())
+		}
+	}
 	repo.Close()
+	// the spans left in the batch are exported before the exit
+	if err = shutdownTracing(context.Background()); err != nil {
+		a.logger.Errorf("tracing shutdown error: %s", err.Error())
+	}
+}
+
+// initServices - connects to the database and initializes the service layer. The message broker is connected
+// only for the server, the commands of the command line leave the events in the outbox for the server's relay
+func (a *App) initServices(brokers bool) *pgxpool.Pool {
+	repo, err := repository.NewPostgresDB(a.config.ConfigDB)
+	if err != nil {
+		a.logger.Fatalf("init db error: %s", err.Error())
+	}
+	r := repository.NewRepository(repo)
+	if brokers {
+		a.publisher, err = broker.NewPublisher(a.config.ConfigBroker, a.config.ConfigOutbox)
+		if err != nil {
+			a.logger.Fatalf("init publisher error: %s", err.Error())
+		}
+		a.consumer, err = broker.NewConsumer(a.config.ConfigBroker, a.config.ConfigCommands)
+		if err != nil {
+			a.logger.Fatalf("init consumer error: %s", err.Error())
+		}
+	}
+	a.services = service.NewService(r, a.location, a.config, a.publisher, a.consumer)
+	return repo
+}
+
+// applyMigrations - applies the pending migrations of the schema embedded into the binary
+func (a *App) applyMigrations(db *pgxpool.Pool) error {
+	migrator, err := repository.NewMigrator(db, schema.Migrations, a.config.MigrateLegacyTimezone)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(context.Background())
+	for _, m := range applied {
+		a.logger.Infof("migration %06d_%s applied", m.Version, m.Name)
+	}
+	return err
+}
+
+// startWorkers - starts the background workers, they are stopped before the server shuts down
+func (a *App) startWorkers() {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopWorkers = cancel
+	onError := func(err error) {
+		a.logger.Errorf("%s", err.Error())
+	}
+	a.runWorker(ctx, "stream", a.services.RunStream, onError)
+	a.runWorker(ctx, "webhooks", a.services.RunWebhooks, onError)
+	a.runWorker(ctx, "audit", a.services.RunAudit, onError)
+	if a.publisher != nil {
+		a.runWorker(ctx, "outbox", a.services.RunOutbox, onError)
+	}
+	if a.consumer != nil {
+		a.runWorker(ctx, "commands", a.services.RunCommands, onError)
+	}
+}
+
+// runWorker - runs the background worker. A worker that returns before the workers are stopped
+// makes the service not ready
+func (a *App) runWorker(ctx context.Context, name string, run func(ctx context.Context, onError func(err error)),
+	onError func(err error)) {
+	a.workers.Store(name, true)
+	go func() {
+		run(ctx, onError)
+		if ctx.Err() == nil {
+			a.workers.Store(name, false)
+			onError(fmt.Errorf("worker %s stopped", name))
+		}
+	}()
 }
 
 func (a *App) Run() {
@@ -86,6 +214,16 @@ func (a *App) Run() {
 	}()
 	s := <-signalChannel
 	a.logger.Infof("Got signal: %s. Initiate gracefully stop.\n", s.String())
+	// the readiness probe fails from now on, the traffic is drained before the server stops
+	a.shuttingDown.Store(true)
+	if a.config.ShutdownDelay > 0 {
+		a.logger.Infof("draining the traffic for %s", a.config.ShutdownDelay)
+		time.Sleep(a.config.ShutdownDelay)
+	}
+	if a.stopWorkers != nil {
+		// the open event streams end when the workers stop, otherwise the shutdown waits for them
+		a.stopWorkers()
+	}
 	if err := a.defaultServer.Shutdown(); err != nil {
 		a.logger.Fatal(err)
 	}
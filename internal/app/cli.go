@@ -0,0 +1,410 @@
+package app
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/schema"
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage - text of the help of the command line
+const Usage = `Usage: avito-tech [command] [arguments]
+
+Commands:
+  serve                                    start the API server (default)
+  migrate up | down [-steps N] | status    apply, revert or list the migrations of the schema
+  report -year Y -month M [-out FILE]      generate the monthly accounting report
+  reconcile [-year Y -month M]             reconcile the books and print the discrepancies
+  export [-table T] [-format F] [-out FILE] [-from D] [-to D] [-user ID]
+                                           export the transactions or the orders
+  user balance ID                          print the balance of the user
+  user adjust -id ID -amount A -comment C  correct the balance of the user by the amount
+  keys issue -client C -scopes S[,S] [-user ID]
+                                           issue the API key of the client service
+  keys list                                list the API keys
+  keys revoke ID                           revoke the API key
+
+Each command accepts the flags of the configuration:
+  -config FILE                             YAML file of the configuration, CONFIG_FILE by default
+  -set KEY=VALUE                           override of a variable of the configuration, can be repeated
+`
+
+// auditCLIClient - client of the commands of the command line in the audit log
+const auditCLIClient = "cli"
+
+// configFlags - flags of the configuration accepted by all commands
+type configFlags struct {
+	file      string
+	overrides overrides
+}
+
+// overrides - repeated flag of the overrides of the configuration in the KEY=VALUE form
+type overrides []string
+
+func (o *overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrides) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+// newConfigFlags - adds the flags of the configuration to the flag set of the command
+func newConfigFlags(flags *flag.FlagSet) *configFlags {
+	cf := &configFlags{}
+	flags.StringVar(&cf.file, "config", os.Getenv("CONFIG_FILE"), "YAML file of the configuration")
+	flags.Var(&cf.overrides, "set", "override of a variable of the configuration: KEY=VALUE, can be repeated")
+	return cf
+}
+
+// newCommandApp - loads the configuration and initializes the service layer for a command of the command line
+func newCommandApp(cf *configFlags) (*App, *pgxpool.Pool) {
+	a := NewApp()
+	a.ParseConfig(cf)
+	repo := a.initServices(false)
+	return a, repo
+}
+
+// Report - generates the monthly accounting report from the command line into the file or stdout.
+// Returns the exit code: 0 on success and 1 on error
+func Report(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	year := flags.Int("year", 0, "year of the report")
+	month := flags.Int("month", 0, "month of the report")
+	out := flags.String("out", "", "output file, stdout by default")
+	cf := newConfigFlags(flags)
+	flags.Parse(args)
+	a, repo := newCommandApp(cf)
+	defer repo.Close()
+	data, _, err := a.services.GetReport(context.Background(), models.Report{Year: *year, Month: *month})
+	if err != nil {
+		a.logger.Errorf("get report error: %s", err.Error())
+		return 1
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*out, data, 0o644)
+	}
+	if err != nil {
+		a.logger.Errorf("report output error: %s", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// User - runs the operations with the user's balance from the command line: user balance ID or
+// user adjust -id ID -amount A -comment C. Returns the exit code: 0 on success and 1 on error
+func User(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, Usage)
+		return 1
+	}
+	switch args[0] {
+	case "balance":
+		flags := flag.NewFlagSet("user balance", flag.ExitOnError)
+		cf := newConfigFlags(flags)
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "usage: user balance [flags] ID")
+			return 1
+		}
+		userID, err := strconv.Atoi(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid user id %q\n", flags.Arg(0))
+			return 1
+		}
+		a, repo := newCommandApp(cf)
+		defer repo.Close()
+		return a.userBalance(os.Stdout, userID)
+	case "adjust":
+		flags := flag.NewFlagSet("user adjust", flag.ExitOnError)
+		userID := flags.Int("id", 0, "id of the user")
+		amount := flags.Float64("amount", 0, "amount of the correction, a negative amount debits the balance")
+		comment := flags.String("comment", "", "reason of the correction, stored in the history of the user")
+		cf := newConfigFlags(flags)
+		flags.Parse(args[1:])
+		a, repo := newCommandApp(cf)
+		defer repo.Close()
+		return a.userAdjust(os.Stdout, models.Adjustment{UserID: *userID, Amount: *amount, Comment: *comment})
+	}
+	fmt.Fprintf(os.Stderr, "unknown user command %q, expected balance or adjust\n", args[0])
+	return 1
+}
+
+// userBalance - prints the balance of the user to w, returns the exit code
+func (a *App) userBalance(w io.Writer, userID int) int {
+	ub := models.UserBalance{UserID: userID}
+	if _, err := a.services.GetBalance(context.Background(), &ub); err != nil {
+		a.logger.Errorf("get balance error: %s", err.Error())
+		return 1
+	}
+	return printJSON(a, w, ub)
+}
+
+// userAdjust - corrects the balance of the user, records the correction in the audit log and prints the new
+// balance to w, returns the exit code
+func (a *App) userAdjust(w io.Writer, adj models.Adjustment) int {
+	ctx, record := a.services.WithAudit(context.Background(), 200, func() models.AuditEntry {
+		return commandEntry("user adjust", adj)
+	})
+	statusCode, err := a.services.AdjustBalance(ctx, adj)
+	if !record.Recorded() || err != nil {
+		auditCommand(a, "user adjust", adj, statusCode, err)
+	}
+	if err != nil {
+		a.logger.Errorf("adjust balance error: %s", err.Error())
+		return 1
+	}
+	return a.userBalance(w, adj.UserID)
+}
+
+// Keys - manages the API keys of the client services from the command line, the first admin key is issued
+// this way: keys issue -client C -scopes S[,S], keys list or keys revoke ID. Returns the exit code: 0 on
+// success and 1 on error
+func Keys(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, Usage)
+		return 1
+	}
+	switch args[0] {
+	case "issue":
+		flags := flag.NewFlagSet("keys issue", flag.ExitOnError)
+		client := flags.String("client", "", "name of the client service")
+		scopes := flags.String("scopes", "", "comma separated scopes: funds:accrue, funds:transfer, "+
+			"orders:write, balances:read, reports:read, audit:read or admin")
+		userID := flags.Int("user", 0, "user the key is issued for, the key of a client service has no user")
+		cf := newConfigFlags(flags)
+		flags.Parse(args[1:])
+		a, repo := newCommandApp(cf)
+		defer repo.Close()
+		key := models.APIKey{Client: *client, Scopes: strings.Split(*scopes, ",")}
+		if *userID != 0 {
+			key.UserID = userID
+		}
+		if err := a.parser.Validate(key); err != nil {
+			a.logger.Errorf("data parsing error: %s", err.Error())
+			return 1
+		}
+		statusCode, err := a.services.IssueAPIKey(context.Background(), &key)
+		auditCommand(a, "keys issue", models.APIKey{Client: key.Client, Scopes: key.Scopes, UserID: key.UserID},
+			statusCode, err)
+		if err != nil {
+			a.logger.Errorf("api key issuing error: %s", err.Error())
+			return 1
+		}
+		return printJSON(a, os.Stdout, key)
+	case "list":
+		flags := flag.NewFlagSet("keys list", flag.ExitOnError)
+		cf := newConfigFlags(flags)
+		flags.Parse(args[1:])
+		a, repo := newCommandApp(cf)
+		defer repo.Close()
+		keys, _, err := a.services.GetAPIKeys(context.Background())
+		if err != nil {
+			a.logger.Errorf("api keys getting error: %s", err.Error())
+			return 1
+		}
+		return printJSON(a, os.Stdout, keys)
+	case "revoke":
+		flags := flag.NewFlagSet("keys revoke", flag.ExitOnError)
+		cf := newConfigFlags(flags)
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "usage: keys revoke [flags] ID")
+			return 1
+		}
+		id, err := strconv.Atoi(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid key id %q\n", flags.Arg(0))
+			return 1
+		}
+		a, repo := newCommandApp(cf)
+		defer repo.Close()
+		statusCode, err := a.services.RevokeAPIKey(context.Background(), id)
+		auditCommand(a, "keys revoke", map[string]int{"key_id": id}, statusCode, err)
+		if err != nil {
+			a.logger.Errorf("api key revocation error: %s", err.Error())
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown keys command %q, expected issue, list or revoke\n", args[0])
+	return 1
+}
+
+// auditCommand - appends the mutating command of the command line to the audit log as the call of the cli client
+// with the name of the operating system user, e.g. cli:root
+func auditCommand(a *App, command string, payload interface{}, code int, err error) {
+	e := commandEntry(command, payload)
+	e.StatusCode = code
+	if err != nil {
+		e.Message = err.Error()
+	}
+	if aErr := a.services.RecordAudit(context.Background(), e); aErr != nil {
+		a.logger.Errorf("audit log error: %s", aErr.Error())
+	}
+}
+
+// commandEntry - returns the entry of the command of the command line in the audit log
+func commandEntry(command string, payload interface{}) models.AuditEntry {
+	e := models.AuditEntry{Client: auditCLIClient, Method: "CLI", Endpoint: command, SourceIP: "local"}
+	if u, err := user.Current(); err == nil {
+		e.Client += ":" + u.Username
+	}
+	e.Payload, _ = json.Marshal(payload)
+	return e
+}
+
+// printJSON - prints the indented JSON of the data to w, returns the exit code
+func printJSON(a *App, w io.Writer, data interface{}) int {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(data); err != nil {
+		a.logger.Errorf("output error: %s", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// Reconcile - runs the reconciliation of the books from the command line and prints the discrepancy report.
+// Returns the exit code: 0 if the books balance, 1 if discrepancies were found and 2 on error
+func Reconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	year := flags.Int("year", 0, "year of the revenue check, the whole time is checked by default")
+	month := flags.Int("month", 0, "month of the revenue check")
+	cf := newConfigFlags(flags)
+	flags.Parse(args)
+	a, repo := newCommandApp(cf)
+	defer repo.Close()
+	rec, _, err := a.services.Reconcile(context.Background(), models.ReconciliationRequest{Year: *year, Month: *month})
+	if err != nil {
+		a.logger.Errorf("reconciliation error: %s", err.Error())
+		return 2
+	}
+	if printJSON(a, os.Stdout, rec) != 0 {
+		return 2
+	}
+	if !rec.Balanced {
+		return 1
+	}
+	return 0
+}
+
+// Export - streams a bulk export of the table from the command line into the file or stdout.
+// Returns the exit code: 0 on success and 1 on error
+func Export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	table := flags.String("table", "transactions", "table to export: transactions or orders")
+	format := flags.String("format", "csv", "output format: csv, ndjson or parquet")
+	from := flags.String("from", "", "beginning of the period: RFC 3339 timestamp or YYYY-MM-DD")
+	to := flags.String("to", "", "end of the period (exclusive): RFC 3339 timestamp or YYYY-MM-DD")
+	userID := flags.Int("user", 0, "export only the rows of this user")
+	out := flags.String("out", "", "output file, stdout by default")
+	cf := newConfigFlags(flags)
+	flags.Parse(args)
+	a, repo := newCommandApp(cf)
+	defer repo.Close()
+	req := models.ExportRequest{
+		Table:    *table,
+		Format:   *format,
+		UserID:   *userID,
+		DateFrom: *from,
+		DateTo:   *to,
+	}
+	if _, err := a.services.PrepareExport(&req); err != nil {
+		a.logger.Errorf("export request error: %s", err.Error())
+		return 1
+	}
+	output := os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			a.logger.Errorf("cannot create output file: %s", err.Error())
+			return 1
+		}
+		defer file.Close()
+		output = file
+	}
+	w := bufio.NewWriter(output)
+	if err := a.services.Export(context.Background(), req, w); err != nil {
+		a.logger.Errorf("export of %s error: %s", req.Table, err.Error())
+		return 1
+	}
+	if err := w.Flush(); err != nil {
+		a.logger.Errorf("export output error: %s", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// Migrate - applies or reverts the migrations of the schema embedded into the binary from the command line:
+// migrate up, migrate down [-steps N] or migrate status. Returns the exit code: 0 on success and 1 on error
+func Migrate(args []string) int {
+	a := NewApp()
+	if len(args) == 0 {
+		a.logger.Errorf("usage: migrate up | down [-steps N] | status")
+		return 1
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of the latest migrations to revert")
+	cf := newConfigFlags(flags)
+	flags.Parse(args[1:])
+	a.ParseConfig(cf)
+	db, err := repository.NewPostgresDB(a.config.ConfigDB)
+	if err != nil {
+		a.logger.Errorf("init db error: %s", err.Error())
+		return 1
+	}
+	defer db.Close()
+	switch args[0] {
+	case "up":
+		err = a.applyMigrations(db)
+	case "down":
+		var migrator *repository.Migrator
+		if migrator, err = repository.NewMigrator(db, schema.Migrations, a.config.MigrateLegacyTimezone); err != nil {
+			break
+		}
+		var reverted []models.Migration
+		reverted, err = migrator.Down(context.Background(), *steps)
+		for _, m := range reverted {
+			a.logger.Infof("migration %06d_%s reverted", m.Version, m.Name)
+		}
+	case "status":
+		var migrator *repository.Migrator
+		if migrator, err = repository.NewMigrator(db, schema.Migrations, a.config.MigrateLegacyTimezone); err != nil {
+			break
+		}
+		var status []models.Migration
+		if status, err = migrator.Status(context.Background()); err != nil {
+			break
+		}
+		for _, m := range status {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = "applied " + m.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%06d_%-30s %s\n", m.Version, m.Name, applied)
+		}
+	default:
+		err = fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+	if err != nil {
+		a.logger.Errorf("migration error: %s", err.Error())
+		return 1
+	}
+	return 0
+}
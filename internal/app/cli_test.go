@@ -0,0 +1,122 @@
+package app
+
+import (
+	"avito/internal/models"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestUserArgs(t *testing.T) {
+	tableTest := []struct {
+		testName string
+		args     []string
+	}{
+		{
+			"no command",
+			[]string{},
+		},
+		{
+			"unknown command",
+			[]string{"delete"},
+		},
+		{
+			"missing user id",
+			[]string{"balance"},
+		},
+		{
+			"invalid user id",
+			[]string{"balance", "abc"},
+		},
+	}
+	for _, testCase := range tableTest {
+		assert.Equal(t, 1, User(testCase.args), testCase.testName)
+	}
+}
+
+func TestUserBalance(t *testing.T) {
+	tableTest := []struct {
+		testName         string
+		userID           int
+		expectedCode     int
+		expectedResponse string
+	}{
+		{
+			"valid data",
+			1,
+			0,
+			`{"user_id":1,"balance":100}`,
+		},
+		{
+			"internal error",
+			2,
+			1,
+			"",
+		},
+	}
+	for _, testCase := range tableTest {
+		mockApp := getAppMoc()
+		var out bytes.Buffer
+		assert.Equal(t, testCase.expectedCode, mockApp.userBalance(&out, testCase.userID), testCase.testName)
+		if testCase.expectedResponse == "" {
+			assert.Empty(t, out.String(), testCase.testName)
+			continue
+		}
+		assert.JSONEq(t, testCase.expectedResponse, out.String(), testCase.testName)
+	}
+}
+
+func TestUserAdjust(t *testing.T) {
+	tableTest := []struct {
+		testName           string
+		data               models.Adjustment
+		expectedCode       int
+		expectedResponse   string
+		expectedStatusCode int
+		expectedMessage    string
+	}{
+		{
+			"valid data",
+			models.Adjustment{UserID: 1, Amount: -40, Comment: "duplicate accrual"},
+			0,
+			`{"user_id":1,"balance":100}`,
+			200,
+			"",
+		},
+		{
+			"insufficient funds",
+			models.Adjustment{UserID: 1, Amount: -150, Comment: "duplicate accrual"},
+			1,
+			"",
+			400,
+			"adjustment is not possible: the balance 100.00 of the user 1 is less than the debit 150.00",
+		},
+		{
+			"internal error",
+			models.Adjustment{UserID: 2, Amount: 10, Comment: "missed accrual"},
+			1,
+			"",
+			500,
+			"internal error",
+		},
+	}
+	for _, testCase := range tableTest {
+		mockApp := getAppMoc()
+		var out bytes.Buffer
+		assert.Equal(t, testCase.expectedCode, mockApp.userAdjust(&out, testCase.data), testCase.testName)
+		if testCase.expectedResponse == "" {
+			assert.Empty(t, out.String(), testCase.testName)
+		} else {
+			assert.JSONEq(t, testCase.expectedResponse, out.String(), testCase.testName)
+		}
+		entries := mockApp.services.Audit.(*mockAuditService).entries
+		if assert.Len(t, entries, 1, testCase.testName) {
+			e := entries[0]
+			assert.True(t, strings.HasPrefix(e.Client, auditCLIClient), testCase.testName)
+			assert.Equal(t, "user adjust", e.Endpoint, testCase.testName)
+			assert.Equal(t, testCase.expectedStatusCode, e.StatusCode, testCase.testName)
+			assert.Equal(t, testCase.expectedMessage, e.Message, testCase.testName)
+		}
+	}
+}
@@ -2,9 +2,26 @@ package app
 
 import (
 	"avito/internal/models"
+	"avito/internal/service"
+	"avito/internal/tracing"
+	"avito/pkg/logger"
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/valyala/fasthttp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// streamHeartbeat - interval of the comments sent to the idle event streams
+const streamHeartbeat = 15 * time.Second
+
+// exportErrorMessage - the last record of the export interrupted by an error
+const (
+	exportErrorMessage = "export interrupted by a server error, the data is incomplete"
+	exportErrorRecord  = "#error: " + exportErrorMessage
 )
 
 // accrualFunds godoc
@@ -17,19 +34,24 @@ import (
 // @Produce json
 // @Success 200 {object} response "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /accrual [post]
 // accrualFunds - method of accruing cash to the balance
 func (a *App) accrualFunds(ctx *fasthttp.RequestCtx) {
 	var ac models.AccrualFunds
-	if err := a.parser.UnmarshalBody(ctx, &ac, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+	err := a.parser.UnmarshalBody(ctx, &ac, true)
+	logIDs(ctx, ac.UserID, ac.OrderID)
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	statusCode, err := a.services.AccrualFunds(ac)
+	statusCode, err := a.services.AccrualFunds(tracing.FromRequest(ctx), ac)
 	if err != nil {
-		a.logger.Errorf("accrual funds error: %s", err.Error())
+		a.log(ctx).Errorf("accrual funds error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
@@ -47,19 +69,24 @@ func (a *App) accrualFunds(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Success 200 {object} response "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /get_balance [post]
 // getBalance - method to get the user's balance
 func (a *App) getBalance(ctx *fasthttp.RequestCtx) {
 	var ub models.UserBalance
-	if err := a.parser.UnmarshalBody(ctx, &ub, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+	err := a.parser.UnmarshalBody(ctx, &ub, true)
+	logIDs(ctx, ub.UserID, 0)
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	statusCode, err := a.services.GetBalance(&ub)
+	statusCode, err := a.services.GetBalance(tracing.FromRequest(ctx), &ub)
 	if err != nil {
-		a.logger.Errorf("balance check error: %s", err.Error())
+		a.log(ctx).Errorf("balance check error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
@@ -77,19 +104,24 @@ func (a *App) getBalance(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Success 201 {object} response "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /create_order [post]
 // blockFunds - method of reserving funds from the main balance in a separate account
 func (a *App) blockFunds(ctx *fasthttp.RequestCtx) {
 	var order models.Order
-	if err := a.parser.UnmarshalBody(ctx, &order, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+	err := a.parser.UnmarshalBody(ctx, &order, true)
+	logIDs(ctx, order.UserID, order.OrderID)
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	statusCode, err := a.services.BlockFunds(order)
+	statusCode, err := a.services.BlockFunds(tracing.FromRequest(ctx), order)
 	if err != nil {
-		a.logger.Errorf("block funds error: %s", err.Error())
+		a.log(ctx).Errorf("block funds error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
@@ -107,19 +139,24 @@ func (a *App) blockFunds(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Success 200 {object} response "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /cancel_order [post]
 // unblockFunds - method of reserving money if it was not possible to apply the service
 func (a *App) unblockFunds(ctx *fasthttp.RequestCtx) {
 	var unblock models.Unblock
-	if err := a.parser.UnmarshalBody(ctx, &unblock, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+	err := a.parser.UnmarshalBody(ctx, &unblock, true)
+	logIDs(ctx, unblock.UserID, unblock.OrderID)
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	statusCode, err := a.services.UnblockFunds(unblock)
+	statusCode, err := a.services.UnblockFunds(tracing.FromRequest(ctx), unblock)
 	if err != nil {
-		a.logger.Errorf("unblock funds error: %s", err.Error())
+		a.log(ctx).Errorf("unblock funds error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
@@ -137,19 +174,24 @@ func (a *App) unblockFunds(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Success 200 {object} response "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /charge [post]
 // chargeFunds - method for charging previously reserved funds
 func (a *App) chargeFunds(ctx *fasthttp.RequestCtx) {
 	var order models.Order
-	if err := a.parser.UnmarshalBody(ctx, &order, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+	err := a.parser.UnmarshalBody(ctx, &order, true)
+	logIDs(ctx, order.UserID, order.OrderID)
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	statusCode, err := a.services.ChargeFunds(order)
+	statusCode, err := a.services.ChargeFunds(tracing.FromRequest(ctx), order)
 	if err != nil {
-		a.logger.Errorf("charge funds error: %s", err.Error())
+		a.log(ctx).Errorf("charge funds error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
@@ -167,26 +209,27 @@ func (a *App) chargeFunds(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Success 200 {object} response "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /get_report [post]
 // getReport - method provides monthly accounting report
 func (a *App) getReport(ctx *fasthttp.RequestCtx) {
 	var report models.Report
 	if err := a.parser.UnmarshalBody(ctx, &report, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	data, statusCode, err := a.services.GetReport(report)
+	data, statusCode, err := a.services.GetReport(tracing.FromRequest(ctx), report)
 	if err != nil {
-		a.logger.Errorf("get report error: %s", err.Error())
+		a.log(ctx).Errorf("get report error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
 	key := fmt.Sprintf("%d%d", report.Year, report.Month)
-	a.store.Lock()
-	a.store.reports[key] = data
-	a.store.Unlock()
+	a.store.Put(key, data)
 	link := fmt.Sprintf("http://%s:%d/reports/?report=%s", a.config.ServiceHost, a.config.ServicePort, key)
 	message := fmt.Sprintf("the requested report has been successfully generated and is available at the link: %s", link)
 	Response(ctx, statusCode, message, true)
@@ -200,6 +243,7 @@ func (a *App) getReport(ctx *fasthttp.RequestCtx) {
 // @Param report query string true "report key"
 // @Success 200 {string} string "success"
 // @Failure 404 {object} response "not found"
+// @Security ApiKeyAuth
 // @Router /reports/ [get]
 // downloadReport - method provides monthly accounting report
 func (a *App) downloadReport(ctx *fasthttp.RequestCtx) {
@@ -210,7 +254,7 @@ func (a *App) downloadReport(ctx *fasthttp.RequestCtx) {
 		ctx.Write(report)
 		return
 	}
-	a.logger.Errorf("report for key %s not found", key)
+	a.log(ctx).Errorf("report for key %s not found", key)
 	Response(ctx, 404, "report not found", false)
 }
 
@@ -224,19 +268,27 @@ func (a *App) downloadReport(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Success 200 {object} response "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /transfer [post]
 // transferFunds - method for transferring funds between users
 func (a *App) transferFunds(ctx *fasthttp.RequestCtx) {
 	var t models.Transfer
-	if err := a.parser.UnmarshalBody(ctx, &t, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+	err := a.parser.UnmarshalBody(ctx, &t, true)
+	logIDs(ctx, t.SenderID, 0)
+	if t.ReceiverID != 0 {
+		logFields(ctx, logger.Fields{"receiver_id": t.ReceiverID})
+	}
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	statusCode, err := a.services.TransferFunds(t)
+	statusCode, err := a.services.TransferFunds(tracing.FromRequest(ctx), t)
 	if err != nil {
-		a.logger.Errorf("transfer error: %s", err.Error())
+		a.log(ctx).Errorf("transfer error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
@@ -247,30 +299,905 @@ func (a *App) transferFunds(ctx *fasthttp.RequestCtx) {
 // getUserTransactions godoc
 // @Summary Requests a list of all user transactions with comments
 // @Tags transaction
-// @Description accepts user id, order by data, limit and offset
+// @Description accepts user id, sort keys, filters, limit and the cursor of the next page (or offset), optionally returns the total count and the summary of the filtered transactions
 // @ID get-transactions
 // @Accept  json
 // @Param transactions_request body models.TransactionListRequest true "data for get transactions"
+// @Param lang query string false "language of the descriptions: ru (default) or en, overrides Accept-Language"
+// @Param Accept-Language header string false "preferred languages of the descriptions"
 // @Produce json
-// @Success 200 {array} models.TransactionList "success"
+// @Success 200 {object} models.TransactionPage "success"
 // @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
 // @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
 // @Router /transactions [post]
 // getUserTransactions - method to get list of user's transactions
 func (a *App) getUserTransactions(ctx *fasthttp.RequestCtx) {
 	var tr models.TransactionListRequest
-	if err := a.parser.UnmarshalBody(ctx, &tr, true); err != nil {
-		a.logger.Errorf("data parsing error: %s", err.Error())
-		Response(ctx, 400, err.Error(), false)
+	err := a.parser.UnmarshalBody(ctx, &tr, true)
+	logIDs(ctx, tr.UserID, 0)
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
 		return
 	}
-	tl, statusCode, err := a.services.GetUserTransactions(tr)
+	tr.Language = language(ctx)
+	page, statusCode, err := a.services.GetUserTransactions(tracing.FromRequest(ctx), tr)
 	if err != nil {
-		a.logger.Errorf("transaction list getting error: %s", err.Error())
+		a.log(ctx).Errorf("transaction list getting error: %s", err.Error())
 		Response(ctx, statusCode, err.Error(), false)
 		return
 	}
 	ctx.SetStatusCode(200)
 	ctx.SetContentType("application/json")
-	json.NewEncoder(ctx).Encode(tl)
+	json.NewEncoder(ctx).Encode(page)
+}
+
+// getTransaction godoc
+// @Summary Returns the user's transaction with the linked order, the mirror transaction of a transfer and its reversals
+// @Tags transaction
+// @Description accepts transaction id, the user is the one the API key is issued for and the transaction
+// @Description of another user is not found. The key of a client service without a user gets 403
+// @ID get-transaction
+// @Param id path int true "transaction id"
+// @Param user_id query int false "user id, required without the authentication, otherwise it must be the user of the key"
+// @Param lang query string false "language of the descriptions: ru (default) or en, overrides Accept-Language"
+// @Produce json
+// @Success 200 {object} models.TransactionDetail "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 403 {object} response "the key is not issued for the user"
+// @Failure 404 {object} response "transaction not found"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /transactions/{id} [get]
+// getTransaction - method to get the user's transaction with its linked entities
+func (a *App) getTransaction(ctx *fasthttp.RequestCtx) {
+	userID, statusCode, err := a.keyUser(ctx)
+	logIDs(ctx, userID, 0)
+	if err != nil {
+		a.log(ctx).Errorf("user checking error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	a.transactionDetail(ctx, userID)
+}
+
+// keyUser - returns the user of the user-facing call, the one the API key is issued for. The user_id
+// query parameter is optional then and must be the same user. Without the authentication there is no key,
+// the user is taken from user_id
+func (a *App) keyUser(ctx *fasthttp.RequestCtx) (userID int, code int, err error) {
+	queried := string(ctx.QueryArgs().Peek("user_id"))
+	if queried != "" || !a.config.AuthEnabled {
+		userID, err = strconv.Atoi(queried)
+		if err != nil || userID < 1 {
+			return 0, 400, fmt.Errorf("user id must be a positive integer")
+		}
+	}
+	if !a.config.AuthEnabled {
+		return userID, 200, nil
+	}
+	client, _ := ctx.UserValue(clientKey).(models.APIKey)
+	if client.UserID == nil {
+		return 0, 403, fmt.Errorf("the key of %s is not issued for a user, any transaction is read by "+
+			"/admin/transactions/{id}", client.Client)
+	}
+	if userID != 0 && userID != *client.UserID {
+		return 0, 403, fmt.Errorf("the key of %s is not issued for the user %d", client.Client, userID)
+	}
+	return *client.UserID, 200, nil
+}
+
+// getTransactionAdmin godoc
+// @Summary Returns any transaction with the linked order, the mirror transaction of a transfer and its reversals
+// @Tags admin
+// @Description accepts transaction id
+// @ID get-transaction-admin
+// @Param id path int true "transaction id"
+// @Produce json
+// @Success 200 {object} models.TransactionDetail "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 404 {object} response "transaction not found"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/transactions/{id} [get]
+// getTransactionAdmin - method to get any transaction with its linked entities for the support
+func (a *App) getTransactionAdmin(ctx *fasthttp.RequestCtx) {
+	a.transactionDetail(ctx, 0)
+}
+
+// transactionDetail - writes the transaction from the path with its linked entities,
+// a non-zero userID restricts the access to the transactions of this user
+func (a *App) transactionDetail(ctx *fasthttp.RequestCtx, userID int) {
+	id, err := strconv.Atoi(fmt.Sprint(ctx.UserValue("id")))
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		Response(ctx, 400, "transaction id must be an integer", false)
+		return
+	}
+	req := models.TransactionDetailRequest{TransactionID: id, UserID: userID, Language: language(ctx)}
+	detail, statusCode, err := a.services.GetTransactionDetail(tracing.FromRequest(ctx), req)
+	if err != nil {
+		a.log(ctx).Errorf("transaction getting error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(detail)
+}
+
+// language - returns the language of the transaction descriptions requested by the lang query parameter
+// or the Accept-Language header
+func language(ctx *fasthttp.RequestCtx) string {
+	return service.NegotiateLanguage(string(ctx.QueryArgs().Peek("lang")),
+		string(ctx.Request.Header.Peek("Accept-Language")))
+}
+
+// streamEvents godoc
+// @Summary Streams the balance changes and new transactions of the user as Server-Sent Events
+// @Tags transaction
+// @Description accepts user id, after a reconnect the transactions made after Last-Event-ID are sent first
+// @ID stream-events
+// @Param user_id query int true "user id"
+// @Param last_event_id query int false "id of the last received transaction, for clients that can't set Last-Event-ID"
+// @Param Last-Event-ID header int false "id of the last received transaction"
+// @Param lang query string false "language of the descriptions: ru (default) or en, overrides Accept-Language"
+// @Produce text/event-stream
+// @Success 200 {string} string "event stream"
+// @Failure 400 {object} response "bad request"
+// @Failure 500 {object} response "server error"
+// @Failure 503 {object} response "server is shutting down"
+// @Security ApiKeyAuth
+// @Router /stream [get]
+// streamEvents - method pushes the balance changes and new transactions of the user as they commit
+func (a *App) streamEvents(ctx *fasthttp.RequestCtx) {
+	req := models.StreamRequest{Language: language(ctx)}
+	var err error
+	if req.UserID, err = strconv.Atoi(string(ctx.QueryArgs().Peek("user_id"))); err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		Response(ctx, 400, "user id must be an integer", false)
+		return
+	}
+	logIDs(ctx, req.UserID, 0)
+	lastEventID := ctx.Request.Header.Peek("Last-Event-ID")
+	if len(lastEventID) == 0 {
+		lastEventID = ctx.QueryArgs().Peek("last_event_id")
+	}
+	if len(lastEventID) != 0 {
+		if req.LastEventID, err = strconv.Atoi(string(lastEventID)); err != nil {
+			a.log(ctx).Errorf("data parsing error: %s", err.Error())
+			Response(ctx, 400, "last event id must be an integer", false)
+			return
+		}
+	}
+	sub, statusCode, err := a.services.Subscribe(tracing.FromRequest(ctx), req)
+	if err != nil {
+		a.log(ctx).Errorf("subscription error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("text/event-stream")
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	ctx.Response.Header.Set("X-Accel-Buffering", "no")
+	// the context of the request is released when the handler returns, the stream logs with its fields
+	log := a.log(ctx)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Cancel()
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case event, ok := <-sub.Events:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, event); err != nil {
+					log.Errorf("event encoding error: %s", err.Error())
+					return
+				}
+			case <-heartbeat.C:
+				// comments keep the connection open and reveal the disconnected clients
+				w.WriteString(": ping\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// writeEvent - writes the event in the Server-Sent Events format
+func writeEvent(w *bufio.Writer, event models.StreamEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if event.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", event.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return nil
+}
+
+// reconcile godoc
+// @Summary Reconciles users' balances, orders and charged revenue with the transaction history
+// @Tags admin
+// @Description accepts an optional year and month for the revenue check, the whole time is checked by default
+// @ID reconcile
+// @Accept  json
+// @Param reconciliation_request body models.ReconciliationRequest false "period for the revenue check"
+// @Produce json
+// @Success 200 {object} models.Reconciliation "discrepancy report"
+// @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/reconcile [post]
+// reconcile - method checks that the books balance and returns the discrepancy report
+func (a *App) reconcile(ctx *fasthttp.RequestCtx) {
+	var req models.ReconciliationRequest
+	if len(ctx.Request.Body()) != 0 {
+		if err := a.parser.UnmarshalBody(ctx, &req, true); err != nil {
+			a.log(ctx).Errorf("data parsing error: %s", err.Error())
+			ParseError(ctx, err)
+			return
+		}
+	}
+	rec, statusCode, err := a.services.Reconcile(tracing.FromRequest(ctx), req)
+	if err != nil {
+		a.log(ctx).Errorf("reconciliation error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	if !rec.Balanced {
+		a.log(ctx).Warnf("reconciliation found discrepancies: %d balances, %d services",
+			len(rec.Balances), len(rec.Revenue))
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(rec)
+}
+
+// upsertService godoc
+// @Summary Adds the service to the catalog or updates the existing one
+// @Tags admin
+// @Description accepts service id, name and optional accounts for the journal entries of charges
+// @ID upsert-service
+// @Accept  json
+// @Param service body models.ServiceInfo true "service catalog entry"
+// @Produce json
+// @Success 200 {object} response "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/services [post]
+// upsertService - method for managing the service catalog
+func (a *App) upsertService(ctx *fasthttp.RequestCtx) {
+	var s models.ServiceInfo
+	if err := a.parser.UnmarshalBody(ctx, &s, true); err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
+		return
+	}
+	statusCode, err := a.services.UpsertService(tracing.FromRequest(ctx), s)
+	if err != nil {
+		a.log(ctx).Errorf("service catalog update error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	message := fmt.Sprintf("service %d has been saved to the catalog", s.ServiceID)
+	Response(ctx, statusCode, message, true)
+}
+
+// getServices godoc
+// @Summary Returns the service catalog
+// @Tags admin
+// @ID get-services
+// @Produce json
+// @Success 200 {array} models.ServiceInfo "success"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/services [get]
+// getServices - method to get the service catalog
+func (a *App) getServices(ctx *fasthttp.RequestCtx) {
+	services, statusCode, err := a.services.GetServices(tracing.FromRequest(ctx))
+	if err != nil {
+		a.log(ctx).Errorf("service catalog getting error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(services)
+}
+
+// exportJournal godoc
+// @Summary Exports the money movements of the month as journal entries for the general ledger system
+// @Tags admin
+// @Description accepts year, month and format: csv (default) or jsonl
+// @ID export-journal
+// @Accept  json
+// @Param journal_request body models.JournalRequest true "period and format of the journal"
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Success 200 {string} string "journal entries"
+// @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/journal [post]
+// exportJournal - method provides journal entries for the accounting import
+func (a *App) exportJournal(ctx *fasthttp.RequestCtx) {
+	var req models.JournalRequest
+	if err := a.parser.UnmarshalBody(ctx, &req, true); err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
+		return
+	}
+	data, statusCode, err := a.services.ExportJournal(tracing.FromRequest(ctx), req)
+	if err != nil {
+		a.log(ctx).Errorf("journal export error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	contentType, extension := "text/csv; charset=utf-8", service.FormatCSV
+	if req.Format == service.FormatJSONL {
+		contentType, extension = "application/x-ndjson", service.FormatJSONL
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType(contentType)
+	ctx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"journal-%d-%02d.%s\"", req.Year, req.Month, extension))
+	ctx.Write(data)
+}
+
+// exportTable godoc
+// @Summary Streams a bulk export of the transactions or orders table
+// @Tags admin
+// @Description accepts table, format (csv, ndjson or parquet), period and user id, memory usage does not depend on the size of the export
+// @Description the export interrupted by an error ends with the error record: a "#error: ..." line in CSV
+// @Description or an object with the error field in NDJSON, the parquet file is left without the footer
+// @ID export-table
+// @Param table path string true "table: transactions or orders"
+// @Param format query string false "csv (default), ndjson or parquet"
+// @Param from query string false "beginning of the period: RFC 3339 timestamp or YYYY-MM-DD"
+// @Param to query string false "end of the period (exclusive): RFC 3339 timestamp or YYYY-MM-DD"
+// @Param user_id query int false "user id"
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.apache.parquet
+// @Success 200 {string} string "exported rows"
+// @Failure 400 {object} response "bad request"
+// @Security ApiKeyAuth
+// @Router /admin/export/{table} [get]
+// exportTable - method for the data-warehouse dumps of the tables
+func (a *App) exportTable(ctx *fasthttp.RequestCtx) {
+	req := models.ExportRequest{
+		Table:    fmt.Sprint(ctx.UserValue("table")),
+		Format:   string(ctx.QueryArgs().Peek("format")),
+		DateFrom: string(ctx.QueryArgs().Peek("from")),
+		DateTo:   string(ctx.QueryArgs().Peek("to")),
+	}
+	if userID := ctx.QueryArgs().Peek("user_id"); len(userID) != 0 {
+		id, err := strconv.Atoi(string(userID))
+		if err != nil {
+			a.log(ctx).Errorf("data parsing error: %s", err.Error())
+			Response(ctx, 400, "user id must be an integer", false)
+			return
+		}
+		req.UserID = id
+	}
+	statusCode, err := a.services.PrepareExport(&req)
+	if err != nil {
+		a.log(ctx).Errorf("export request error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	switch req.Format {
+	case service.FormatNDJSON:
+		contentType = "application/x-ndjson"
+	case service.FormatParquet:
+		contentType = "application/vnd.apache.parquet"
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType(contentType)
+	ctx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"%s.%s\"", req.Table, req.Format))
+	log := a.log(ctx)
+	reqCtx := tracing.FromRequest(ctx)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		exportCtx, cancel := context.WithCancel(reqCtx)
+		defer cancel()
+		err := a.services.Export(exportCtx, req, &cancelWriter{w: w, cancel: cancel})
+		if err == nil {
+			return
+		}
+		log.Errorf("export of %s error: %s", req.Table, err.Error())
+		if exportCtx.Err() == nil {
+			writeExportError(w, req.Format)
+		}
+	})
+}
+
+// cancelWriter - writer of the streamed body that cancels the context of the stream once the write fails,
+// the client has gone and the query of the stream is stopped
+type cancelWriter struct {
+	w      *bufio.Writer
+	cancel context.CancelFunc
+}
+
+func (c *cancelWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		c.cancel()
+	}
+	return n, err
+}
+
+// writeExportError - finishes the interrupted export with the error record, the status has already been sent,
+// so the caller learns about the incomplete data from the last record. The parquet file has no footer then
+// and is rejected by the readers
+func writeExportError(w *bufio.Writer, format string) {
+	switch format {
+	case service.FormatCSV:
+		w.WriteString("\n" + exportErrorRecord + "\n")
+	case service.FormatNDJSON:
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{Error: exportErrorMessage})
+	}
+}
+
+// createWebhook godoc
+// @Summary Subscribes the endpoint to the events of the given types
+// @Tags admin
+// @Description accepts url, event types and optional secret of at least 16 characters, the secret is generated
+// @Description when it is not supplied and returned only in this response
+// @ID create-webhook
+// @Accept  json
+// @Param subscription body models.WebhookSubscription true "webhook subscription"
+// @Produce json
+// @Success 201 {object} models.WebhookSubscription "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/webhooks [post]
+// createWebhook - method for subscribing the other services to the money movements
+func (a *App) createWebhook(ctx *fasthttp.RequestCtx) {
+	var s models.WebhookSubscription
+	if err := a.parser.UnmarshalBody(ctx, &s, true); err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
+		return
+	}
+	statusCode, err := a.services.CreateSubscription(tracing.FromRequest(ctx), &s)
+	if err != nil {
+		a.log(ctx).Errorf("webhook subscription error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(s)
+}
+
+// getWebhooks godoc
+// @Summary Returns the webhook subscriptions without their secrets
+// @Tags admin
+// @ID get-webhooks
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription "success"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/webhooks [get]
+// getWebhooks - method to get the webhook subscriptions
+func (a *App) getWebhooks(ctx *fasthttp.RequestCtx) {
+	subscriptions, statusCode, err := a.services.GetSubscriptions(tracing.FromRequest(ctx))
+	if err != nil {
+		a.log(ctx).Errorf("webhook subscriptions getting error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(subscriptions)
+}
+
+// deleteWebhook godoc
+// @Summary Deletes the webhook subscription, its pending deliveries are dead-lettered
+// @Tags admin
+// @ID delete-webhook
+// @Param id path int true "subscription id"
+// @Produce json
+// @Success 200 {object} response "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 404 {object} response "subscription not found"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/webhooks/{id} [delete]
+// deleteWebhook - method to unsubscribe the endpoint
+func (a *App) deleteWebhook(ctx *fasthttp.RequestCtx) {
+	id, err := strconv.Atoi(fmt.Sprint(ctx.UserValue("id")))
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		Response(ctx, 400, "subscription id must be an integer", false)
+		return
+	}
+	statusCode, err := a.services.DeleteSubscription(tracing.FromRequest(ctx), id)
+	if err != nil {
+		a.log(ctx).Errorf("webhook subscription deletion error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	Response(ctx, statusCode, fmt.Sprintf("subscription %d has been deleted", id), true)
+}
+
+// getWebhookDeliveries godoc
+// @Summary Returns the latest webhook deliveries with the results of the last attempts
+// @Tags admin
+// @ID get-webhook-deliveries
+// @Param subscription_id query int false "subscription id"
+// @Param status query string false "delivery status: pending, delivered or dead"
+// @Param limit query int false "number of deliveries, 100 by default and 1000 at most"
+// @Produce json
+// @Success 200 {array} models.WebhookDelivery "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/webhooks/deliveries [get]
+// getWebhookDeliveries - method for inspecting the delivery queue and the dead letters
+func (a *App) getWebhookDeliveries(ctx *fasthttp.RequestCtx) {
+	f := models.WebhookDeliveryFilter{Status: string(ctx.QueryArgs().Peek("status"))}
+	for name, dest := range map[string]*int{"subscription_id": &f.SubscriptionID, "limit": &f.Limit} {
+		value := ctx.QueryArgs().Peek(name)
+		if len(value) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(string(value))
+		if err != nil {
+			a.log(ctx).Errorf("data parsing error: %s", err.Error())
+			Response(ctx, 400, fmt.Sprintf("%s must be an integer", name), false)
+			return
+		}
+		*dest = n
+	}
+	deliveries, statusCode, err := a.services.GetDeliveries(tracing.FromRequest(ctx), f)
+	if err != nil {
+		a.log(ctx).Errorf("webhook deliveries getting error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(deliveries)
+}
+
+// replayWebhookDelivery godoc
+// @Summary Schedules the webhook delivery again with a fresh number of attempts
+// @Tags admin
+// @ID replay-webhook-delivery
+// @Param id path int true "delivery id"
+// @Produce json
+// @Success 202 {object} response "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 404 {object} response "delivery not found"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/webhooks/deliveries/{id}/replay [post]
+// replayWebhookDelivery - method for the manual replay of the failed and dead-lettered deliveries
+func (a *App) replayWebhookDelivery(ctx *fasthttp.RequestCtx) {
+	id, err := strconv.ParseInt(fmt.Sprint(ctx.UserValue("id")), 10, 64)
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		Response(ctx, 400, "delivery id must be an integer", false)
+		return
+	}
+	statusCode, err := a.services.ReplayDelivery(tracing.FromRequest(ctx), id)
+	if err != nil {
+		a.log(ctx).Errorf("webhook delivery replay error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	Response(ctx, statusCode, fmt.Sprintf("delivery %d has been scheduled", id), true)
+}
+
+// issueAPIKey godoc
+// @Summary Issues the API key of the client service with the scopes
+// @Tags admin
+// @Description accepts client name and scopes: funds:accrue, funds:transfer, orders:write, balances:read,
+// @Description reports:read, audit:read or admin, and the user_id of the key issued for a user,
+// @Description the key is returned only in this response
+// @ID issue-api-key
+// @Accept  json
+// @Param key body models.APIKey true "client and scopes"
+// @Produce json
+// @Success 201 {object} models.APIKey "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 413 {object} response "request body is too large"
+// @Failure 415 {object} response "unsupported content type"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/keys [post]
+// issueAPIKey - method for issuing the keys of the client services
+func (a *App) issueAPIKey(ctx *fasthttp.RequestCtx) {
+	var key models.APIKey
+	if err := a.parser.UnmarshalBody(ctx, &key, true); err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		ParseError(ctx, err)
+		return
+	}
+	statusCode, err := a.services.IssueAPIKey(tracing.FromRequest(ctx), &key)
+	if err != nil {
+		a.log(ctx).Errorf("api key issuing error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	a.log(ctx).Infof("api key %d has been issued to %s", key.KeyID, key.Client)
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(key)
+}
+
+// getAPIKeys godoc
+// @Summary Returns the API keys with their scopes, without the keys themselves
+// @Tags admin
+// @ID get-api-keys
+// @Produce json
+// @Success 200 {array} models.APIKey "success"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/keys [get]
+// getAPIKeys - method to get the issued and revoked keys
+func (a *App) getAPIKeys(ctx *fasthttp.RequestCtx) {
+	keys, statusCode, err := a.services.GetAPIKeys(tracing.FromRequest(ctx))
+	if err != nil {
+		a.log(ctx).Errorf("api keys getting error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(keys)
+}
+
+// revokeAPIKey godoc
+// @Summary Revokes the API key, the calls with it are rejected at once
+// @Tags admin
+// @ID revoke-api-key
+// @Param id path int true "key id"
+// @Produce json
+// @Success 200 {object} response "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 404 {object} response "key not found"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/keys/{id} [delete]
+// revokeAPIKey - method to revoke the leaked or unused key
+func (a *App) revokeAPIKey(ctx *fasthttp.RequestCtx) {
+	id, err := strconv.Atoi(fmt.Sprint(ctx.UserValue("id")))
+	if err != nil {
+		a.log(ctx).Errorf("data parsing error: %s", err.Error())
+		Response(ctx, 400, "key id must be an integer", false)
+		return
+	}
+	statusCode, err := a.services.RevokeAPIKey(tracing.FromRequest(ctx), id)
+	if err != nil {
+		a.log(ctx).Errorf("api key revocation error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	a.log(ctx).Infof("api key %d has been revoked", id)
+	Response(ctx, statusCode, fmt.Sprintf("key %d has been revoked", id), true)
+}
+
+// getAudit godoc
+// @Summary Returns the entries of the audit log of the mutating calls
+// @Tags admin
+// @Description the entries are returned in the order of the log, the next page starts after the last audit_id
+// @ID get-audit
+// @Param client query string false "client of the API key, anonymous for the calls without a valid key"
+// @Param user_id query int false "user, sender or receiver of the call"
+// @Param endpoint query string false "path of the call, e.g. /accrual"
+// @Param from query string false "beginning of the period: RFC 3339 timestamp or YYYY-MM-DD"
+// @Param to query string false "end of the period (exclusive): RFC 3339 timestamp or YYYY-MM-DD"
+// @Param after_id query int false "the entries after this audit id"
+// @Param limit query int false "number of entries, 100 by default and 1000 at most"
+// @Produce json
+// @Success 200 {array} models.AuditEntry "success"
+// @Failure 400 {object} response "bad request"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/audit [get]
+// getAudit - method answers who made the call, when and with which outcome
+func (a *App) getAudit(ctx *fasthttp.RequestCtx) {
+	f, ok := a.auditFilter(ctx)
+	if !ok {
+		return
+	}
+	entries, statusCode, err := a.services.GetAudit(tracing.FromRequest(ctx), f)
+	if err != nil {
+		a.log(ctx).Errorf("audit log getting error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(entries)
+}
+
+// exportAudit godoc
+// @Summary Streams the entries of the audit log with their hashes as JSON lines
+// @Tags admin
+// @Description accepts the filters of the audit log except the limit, the whole log can be verified
+// @Description outside the service by recalculating the hashes of the export
+// @Description the export interrupted by an error ends with the {"error": "..."} line
+// @ID export-audit
+// @Param client query string false "client of the API key"
+// @Param user_id query int false "user, sender or receiver of the call"
+// @Param endpoint query string false "path of the call"
+// @Param from query string false "beginning of the period: RFC 3339 timestamp or YYYY-MM-DD"
+// @Param to query string false "end of the period (exclusive): RFC 3339 timestamp or YYYY-MM-DD"
+// @Param after_id query int false "the entries after this audit id"
+// @Produce application/x-ndjson
+// @Success 200 {string} string "audit log entries"
+// @Failure 400 {object} response "bad request"
+// @Security ApiKeyAuth
+// @Router /admin/audit/export [get]
+// exportAudit - method for handing the audit log over to the auditors
+func (a *App) exportAudit(ctx *fasthttp.RequestCtx) {
+	f, ok := a.auditFilter(ctx)
+	if !ok {
+		return
+	}
+	statusCode, err := a.services.PrepareAudit(&f)
+	if err != nil {
+		a.log(ctx).Errorf("audit export request error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/x-ndjson")
+	ctx.Response.Header.Set("Content-Disposition", "attachment; filename=\"audit.ndjson\"")
+	log := a.log(ctx)
+	reqCtx := tracing.FromRequest(ctx)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		exportCtx, cancel := context.WithCancel(reqCtx)
+		defer cancel()
+		err := a.services.ExportAudit(exportCtx, f, &cancelWriter{w: w, cancel: cancel})
+		if err == nil {
+			return
+		}
+		log.Errorf("audit export error: %s", err.Error())
+		if exportCtx.Err() == nil {
+			writeExportError(w, service.FormatNDJSON)
+		}
+	})
+}
+
+// verifyAudit godoc
+// @Summary Checks the hash chain of the whole audit log
+// @Tags admin
+// @Description recalculates the hashes of all entries, broken_at is the first entry that was changed
+// @Description or follows a removed one
+// @ID verify-audit
+// @Produce json
+// @Success 200 {object} models.AuditVerification "result of the check"
+// @Failure 500 {object} response "server error"
+// @Security ApiKeyAuth
+// @Router /admin/audit/verify [get]
+// verifyAudit - method proves that the audit log has not been tampered with
+func (a *App) verifyAudit(ctx *fasthttp.RequestCtx) {
+	v, statusCode, err := a.services.VerifyAudit(tracing.FromRequest(ctx))
+	if err != nil {
+		a.log(ctx).Errorf("audit log verification error: %s", err.Error())
+		Response(ctx, statusCode, err.Error(), false)
+		return
+	}
+	if !v.Valid {
+		a.log(ctx).Warnf("audit log chain is broken at entry %d: %s", *v.BrokenAt, v.Error)
+	}
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(v)
+}
+
+// auditFilter - parses the filter of the audit log from the query, the bad request is answered here
+func (a *App) auditFilter(ctx *fasthttp.RequestCtx) (models.AuditFilter, bool) {
+	args := ctx.QueryArgs()
+	f := models.AuditFilter{
+		Client:   string(args.Peek("client")),
+		Endpoint: string(args.Peek("endpoint")),
+		DateFrom: string(args.Peek("from")),
+		DateTo:   string(args.Peek("to")),
+	}
+	var afterID int
+	for name, dest := range map[string]*int{"user_id": &f.UserID, "after_id": &afterID, "limit": &f.Limit} {
+		value := args.Peek(name)
+		if len(value) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(string(value))
+		if err != nil {
+			a.log(ctx).Errorf("data parsing error: %s", err.Error())
+			Response(ctx, 400, fmt.Sprintf("%s must be an integer", name), false)
+			return f, false
+		}
+		*dest = n
+	}
+	f.AfterID = int64(afterID)
+	return f, true
+}
+
+// healthz godoc
+// @Summary Liveness probe, the process is alive
+// @Tags health
+// @ID healthz
+// @Produce json
+// @Success 200 {object} response "alive"
+// @Router /healthz [get]
+// healthz - method reports that the process is alive
+func (a *App) healthz(ctx *fasthttp.RequestCtx) {
+	Response(ctx, 200, "alive", true)
+}
+
+// readyz godoc
+// @Summary Readiness probe, the service can take the traffic
+// @Tags health
+// @Description checks the database with a ping, the applied migrations and the background workers.
+// @Description The service is not ready during the graceful shutdown
+// @ID readyz
+// @Produce json
+// @Success 200 {object} models.Readiness "ready"
+// @Failure 503 {object} models.Readiness "not ready"
+// @Router /readyz [get]
+// readyz - method reports whether the service is ready to take the traffic
+func (a *App) readyz(ctx *fasthttp.RequestCtx) {
+	readiness := a.readiness(ctx)
+	statusCode := 200
+	if !readiness.Ready {
+		statusCode = 503
+		for _, check := range readiness.Checks {
+			if !check.OK {
+				a.log(ctx).Warnf("readiness check %s failed: %s", check.Name, check.Error)
+			}
+		}
+	}
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(readiness)
+}
+
+// readiness - runs the checks of the dependencies and the background workers
+func (a *App) readiness(ctx context.Context) models.Readiness {
+	if a.shuttingDown.Load() {
+		return models.Readiness{Checks: []models.HealthCheck{{Name: "shutdown", Error: "the service is shutting down"}}}
+	}
+	checks := a.services.CheckReadiness(ctx)
+	workers := make([]models.HealthCheck, 0)
+	a.workers.Range(func(name, running interface{}) bool {
+		check := models.HealthCheck{Name: "worker " + name.(string), OK: running.(bool)}
+		if !check.OK {
+			check.Error = "the worker has stopped"
+		}
+		workers = append(workers, check)
+		return true
+	})
+	sort.Slice(workers, func(i, k int) bool {
+		return workers[i].Name < workers[k].Name
+	})
+	readiness := models.Readiness{Ready: true, Checks: append(checks, workers...)}
+	for _, check := range readiness.Checks {
+		readiness.Ready = readiness.Ready && check.OK
+	}
+	return readiness
 }
@@ -4,22 +4,46 @@ import (
 	"avito/configs"
 	"avito/internal/models"
 	"avito/internal/parser"
+	"avito/internal/repository"
 	"avito/internal/service"
+	"avito/internal/tracing"
+	"avito/pkg/logger"
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"strings"
 	"testing"
+	"time"
 )
 
 func getAppMoc() *App {
 	return &App{
 		services: &service.Service{
-			User:        mockUserService{},
-			Order:       mockOrderService{},
-			Transaction: mockTransactionService{},
+			User:           mockUserService{},
+			Order:          mockOrderService{},
+			Transaction:    mockTransactionService{},
+			Reconciliation: mockReconciliationService{},
+			Catalog:        mockCatalogService{},
+			Journal:        mockJournalService{},
+			BulkExport:     mockExportService{},
+			Stream:         mockStreamService{},
+			Webhook:        mockWebhookService{},
+			Health:         mockHealthService{},
+			Auth:           mockAuthService{},
+			Audit:          &mockAuditService{},
 		},
-		parser: parser.NewParser(),
+		config: &configs.Common{},
+		parser: parser.NewParser(1024),
 		logger: new(mockLogger),
 	}
 }
@@ -63,6 +87,45 @@ func TestAccrualFunds(t *testing.T) {
 			},
 			500,
 		},
+		{
+			"valid refund",
+			models.AccrualFunds{
+				Amount:            50,
+				UserID:            1,
+				Operation:         models.OperationRefund,
+				OrderID:           1,
+				Comment:           "refund for the unused promotion",
+				ExternalReference: "billing-42",
+			},
+			200,
+		},
+		{
+			"refund without order",
+			models.AccrualFunds{
+				Amount:    50,
+				UserID:    1,
+				Operation: models.OperationRefund,
+			},
+			400,
+		},
+		{
+			"invalid operation",
+			models.AccrualFunds{
+				Amount:    50,
+				UserID:    1,
+				Operation: models.OperationCharge,
+			},
+			400,
+		},
+		{
+			"too long comment",
+			models.AccrualFunds{
+				Amount:  50,
+				UserID:  1,
+				Comment: strings.Repeat("a", 256),
+			},
+			400,
+		},
 	}
 	for _, testCase := range tableTest {
 		ctx := new(fasthttp.RequestCtx)
@@ -510,6 +573,91 @@ func TestGetUserTransactions(t *testing.T) {
 			},
 			400,
 		},
+		{
+			"next page",
+			models.TransactionListRequest{
+				UserID:    1,
+				OrderBy:   "amount desc",
+				Limit:     2,
+				Cursor:    "eyJzIjoiYW1vdW50IGRlc2MiLCJ2IjpbIjUwIl0sImlkIjo0Mn0",
+				WithTotal: true,
+			},
+			200,
+		},
+		{
+			"invalid cursor",
+			models.TransactionListRequest{
+				UserID: 1,
+				Limit:  2,
+				Cursor: "invalid",
+			},
+			400,
+		},
+		{
+			"sort and filters",
+			models.TransactionListRequest{
+				UserID: 1,
+				Sort: []models.SortKey{
+					{Field: "amount", Direction: "desc"},
+					{Field: "date_time"},
+				},
+				Limit: 10,
+				TransactionFilter: models.TransactionFilter{
+					Direction:      "out",
+					Operation:      "transfer_out",
+					CounterpartyID: 5,
+				},
+			},
+			200,
+		},
+		{
+			"invalid sort key",
+			models.TransactionListRequest{
+				UserID: 1,
+				Sort:   []models.SortKey{{Field: "amount; DROP TABLE users"}},
+			},
+			400,
+		},
+		{
+			"repeated sort key",
+			models.TransactionListRequest{
+				UserID: 1,
+				Sort:   []models.SortKey{{Field: "amount"}, {Field: "amount", Direction: "desc"}},
+			},
+			400,
+		},
+		{
+			"invalid sort direction",
+			models.TransactionListRequest{
+				UserID: 1,
+				Sort:   []models.SortKey{{Field: "amount", Direction: "sideways"}},
+			},
+			400,
+		},
+		{
+			"invalid direction filter",
+			models.TransactionListRequest{
+				UserID:            1,
+				TransactionFilter: models.TransactionFilter{Direction: "both"},
+			},
+			400,
+		},
+		{
+			"invalid operation filter",
+			models.TransactionListRequest{
+				UserID:            1,
+				TransactionFilter: models.TransactionFilter{Operation: "theft"},
+			},
+			400,
+		},
+		{
+			"invalid order id filter",
+			models.TransactionListRequest{
+				UserID:            1,
+				TransactionFilter: models.TransactionFilter{OrderID: -1},
+			},
+			400,
+		},
 		{
 			"internal error",
 			models.TransactionListRequest{
@@ -529,93 +677,1291 @@ func TestGetUserTransactions(t *testing.T) {
 	}
 }
 
-func TestMiddleware(t *testing.T) {
+func TestReconcile(t *testing.T) {
 	mockApp := getAppMoc()
-	testCase := struct {
-		AllowHeadersKey   string
-		AllowHeadersValue string
-		AllowOriginKey    string
-		AllowOriginValue  string
-		AllowMethodsKey   string
-		AllowMethodsValue string
+	tableTest := []struct {
+		testName           string
+		data               []byte
+		expectedStatusCode int
 	}{
-		"Access-Control-Allow-Headers",
-		"Accept, Content-Type, Content-Length, Accept-Encoding, X-Secret, Access-Control-Allow-Origin, Access-Control-Allow-Headers, X-CSRF-Token, Authorization-Token",
-		"Access-Control-Allow-Origin",
-		"*",
-		"Access-Control-Allow-Methods",
-		"POST, GET, OPTIONS",
+		{
+			"empty body",
+			nil,
+			200,
+		},
+		{
+			"valid period",
+			[]byte(`{"year":2022,"month":10}`),
+			200,
+		},
+		{
+			"invalid month",
+			[]byte(`{"year":2022,"month":13}`),
+			400,
+		},
+		{
+			"internal error",
+			[]byte(`{"year":2008,"month":10}`),
+			500,
+		},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetBody(testCase.data)
+		mockApp.reconcile(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
 	}
-	ctx := new(fasthttp.RequestCtx)
-	h := mockApp.LogRequests(mockApp.getUserTransactions)
-	h(ctx)
-	assert.Equal(t, testCase.AllowHeadersValue, string(ctx.Response.Header.Peek(testCase.AllowHeadersKey)))
-	assert.Equal(t, testCase.AllowOriginValue, string(ctx.Response.Header.Peek(testCase.AllowOriginKey)))
-	assert.Equal(t, testCase.AllowMethodsValue, string(ctx.Response.Header.Peek(testCase.AllowMethodsKey)))
 }
 
-type mockUserService struct{}
-type mockOrderService struct{}
-type mockTransactionService struct{}
-
-func (ms mockUserService) AccrualFunds(ac models.AccrualFunds) (code int, err error) {
-	if ac.UserID == 2 {
-		return 500, fmt.Errorf("internal error")
+func TestUpsertService(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		data               models.ServiceInfo
+		expectedStatusCode int
+	}{
+		{
+			"valid data",
+			models.ServiceInfo{
+				ServiceID:     1,
+				Name:          "photo promotion",
+				CreditAccount: "90.01.1",
+			},
+			200,
+		},
+		{
+			"invalid service id",
+			models.ServiceInfo{
+				ServiceID: 0,
+				Name:      "photo promotion",
+			},
+			400,
+		},
+		{
+			"empty name",
+			models.ServiceInfo{
+				ServiceID: 1,
+			},
+			400,
+		},
+		{
+			"internal error",
+			models.ServiceInfo{
+				ServiceID: 2,
+				Name:      "photo promotion",
+			},
+			500,
+		},
 	}
-	return 200, nil
-}
-func (ms mockUserService) GetBalance(ub *models.UserBalance) (code int, err error) {
-	if ub.UserID == 2 {
-		return 500, fmt.Errorf("internal error")
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		data, _ := json.Marshal(testCase.data)
+		ctx.Request.SetBody(data)
+		mockApp.upsertService(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
 	}
-	return 200, nil
 }
-func (ms mockUserService) BlockFunds(order models.Order) (code int, err error) {
-	if order.UserID == 2 {
-		return 500, fmt.Errorf("internal error")
+
+func TestExportJournal(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName            string
+		data                models.JournalRequest
+		expectedStatusCode  int
+		expectedContentType string
+	}{
+		{
+			"csv by default",
+			models.JournalRequest{
+				Year:  2022,
+				Month: 10,
+			},
+			200,
+			"text/csv; charset=utf-8",
+		},
+		{
+			"json lines",
+			models.JournalRequest{
+				Year:   2022,
+				Month:  10,
+				Format: "jsonl",
+			},
+			200,
+			"application/x-ndjson",
+		},
+		{
+			"invalid format",
+			models.JournalRequest{
+				Year:   2022,
+				Month:  10,
+				Format: "xml",
+			},
+			400,
+			"application/json",
+		},
+		{
+			"invalid month",
+			models.JournalRequest{
+				Year:  2022,
+				Month: 0,
+			},
+			400,
+			"application/json",
+		},
+		{
+			"internal error",
+			models.JournalRequest{
+				Year:  2008,
+				Month: 10,
+			},
+			500,
+			"application/json",
+		},
 	}
-	return 200, nil
-}
-func (ms mockUserService) TransferFunds(t models.Transfer) (code int, err error) {
-	if t.SenderID == 2 {
-		return 500, fmt.Errorf("internal error")
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		data, _ := json.Marshal(testCase.data)
+		ctx.Request.SetBody(data)
+		mockApp.exportJournal(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
+		assert.Equal(t, testCase.expectedContentType, string(ctx.Response.Header.ContentType()), testCase.testName)
 	}
-	return 200, nil
 }
-func (ms mockUserService) UnblockFunds(unblock models.Unblock) (code int, err error) {
-	if unblock.UserID == 2 {
-		return 500, fmt.Errorf("internal error")
+
+func TestTransactionsSummary(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName        string
+		data            models.TransactionListRequest
+		expectedSummary *models.TransactionSummary
+	}{
+		{
+			"without summary",
+			models.TransactionListRequest{UserID: 1},
+			nil,
+		},
+		{
+			"with summary",
+			models.TransactionListRequest{
+				UserID:            1,
+				WithSummary:       true,
+				TransactionFilter: models.TransactionFilter{Direction: models.DirectionOut},
+			},
+			&models.TransactionSummary{Count: 2, Incoming: 100, Outgoing: 40, Net: 60},
+		},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		data, _ := json.Marshal(testCase.data)
+		ctx.Request.SetBody(data)
+		mockApp.getUserTransactions(ctx)
+		assert.Equal(t, 200, ctx.Response.StatusCode(), testCase.testName)
+		var page models.TransactionPage
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &page), testCase.testName)
+		assert.Equal(t, testCase.expectedSummary, page.Summary, testCase.testName)
 	}
-	return 200, nil
 }
-func (ms mockOrderService) ChargeFunds(order models.Order) (code int, err error) {
-	if order.UserID == 2 {
-		return 500, fmt.Errorf("internal error")
+
+func TestTransactionsLanguage(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName         string
+		lang             string
+		acceptLanguage   string
+		expectedLanguage string
+	}{
+		{"russian by default", "", "", models.LanguageRu},
+		{"accept-language", "", "en-US,en;q=0.9,ru;q=0.8", models.LanguageEn},
+		{"accept-language weights", "", "de, ru;q=0.5, en;q=0.7", models.LanguageEn},
+		{"unsupported language", "", "de-DE", models.LanguageRu},
+		{"query parameter overrides header", "ru", "en", models.LanguageRu},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		data, _ := json.Marshal(models.TransactionListRequest{UserID: 1})
+		ctx.Request.SetBody(data)
+		if testCase.lang != "" {
+			ctx.QueryArgs().Set("lang", testCase.lang)
+		}
+		if testCase.acceptLanguage != "" {
+			ctx.Request.Header.Set("Accept-Language", testCase.acceptLanguage)
+		}
+		mockApp.getUserTransactions(ctx)
+		var page models.TransactionPage
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &page), testCase.testName)
+		assert.Equal(t, testCase.expectedLanguage, page.Transactions[0].Description, testCase.testName)
 	}
-	return 200, nil
 }
-func (ms mockOrderService) GetReport(report models.Report) (data []byte, code int, err error) {
-	if report.Year == 2008 {
-		return nil, 500, fmt.Errorf("internal error")
+
+func TestGetTransaction(t *testing.T) {
+	userKey := func(userID int) *models.APIKey {
+		return &models.APIKey{KeyID: 3, Client: "mobile", Scopes: []string{models.ScopeBalances}, UserID: &userID}
+	}
+	tableTest := []struct {
+		testName           string
+		id                 string
+		userID             string
+		admin              bool
+		client             *models.APIKey
+		expectedStatusCode int
+	}{
+		{"valid data", "1", "1", false, nil, 200},
+		{"transaction of another user", "1", "5", false, nil, 404},
+		{"missing transaction", "3", "1", false, nil, 404},
+		{"missing user id", "1", "", false, nil, 400},
+		{"invalid transaction id", "one", "1", false, nil, 400},
+		{"internal error", "2", "1", false, nil, 500},
+		{"admin access", "1", "", true, nil, 200},
+		{"admin missing transaction", "3", "", true, nil, 404},
+		{"user of the key", "1", "", false, userKey(1), 200},
+		{"same user id as the key", "1", "1", false, userKey(1), 200},
+		{"transaction of another user than the key", "1", "", false, userKey(5), 404},
+		{"user id of another user than the key", "1", "1", false, userKey(5), 403},
+		{"key without user", "1", "1", false, &models.APIKey{KeyID: 1, Client: "billing",
+			Scopes: []string{models.ScopeBalances}}, 403},
+	}
+	for _, testCase := range tableTest {
+		mockApp := getAppMoc()
+		ctx := new(fasthttp.RequestCtx)
+		ctx.SetUserValue("id", testCase.id)
+		if testCase.userID != "" {
+			ctx.QueryArgs().Set("user_id", testCase.userID)
+		}
+		if testCase.client != nil {
+			// the key is set by the authorization
+			mockApp.config.AuthEnabled = true
+			ctx.SetUserValue(clientKey, *testCase.client)
+		}
+		if testCase.admin {
+			mockApp.getTransactionAdmin(ctx)
+		} else {
+			mockApp.getTransaction(ctx)
+		}
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
 	}
-	return []byte("ok"), 200, nil
 }
-func (ms mockTransactionService) GetUserTransactions(tr models.TransactionListRequest) (tl []models.TransactionList, code int, err error) {
-	if tr.UserID == 2 {
-		return nil, 500, fmt.Errorf("internal error")
+
+func TestStreamEvents(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName            string
+		query               map[string]string
+		lastEventID         string
+		expectedStatusCode  int
+		expectedContentType string
+	}{
+		{"valid data", map[string]string{"user_id": "1"}, "", 200, "text/event-stream"},
+		{"resume by header", map[string]string{"user_id": "1"}, "42", 200, "text/event-stream"},
+		{"resume by query", map[string]string{"user_id": "1", "last_event_id": "42"}, "", 200, "text/event-stream"},
+		{"missing user id", nil, "", 400, "application/json"},
+		{"invalid last event id", map[string]string{"user_id": "1"}, "last", 400, "application/json"},
+		{"invalid user id", map[string]string{"user_id": "-1"}, "", 400, "application/json"},
+		{"internal error", map[string]string{"user_id": "2"}, "", 500, "application/json"},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		for key, value := range testCase.query {
+			ctx.QueryArgs().Set(key, value)
+		}
+		if testCase.lastEventID != "" {
+			ctx.Request.Header.Set("Last-Event-ID", testCase.lastEventID)
+		}
+		mockApp.streamEvents(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
+		assert.Equal(t, testCase.expectedContentType, string(ctx.Response.Header.ContentType()), testCase.testName)
 	}
-	return nil, 200, nil
 }
 
-type mockLogger struct{}
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	assert.NoError(t, writeEvent(w, models.StreamEvent{ID: "42", Type: models.EventTransaction,
+		Data: models.TransactionList{TransactionID: 42, UserID: 1, Amount: 100, Operation: models.OperationAccrual}}))
+	assert.NoError(t, writeEvent(w, models.StreamEvent{Type: models.EventBalance,
+		Data: models.UserBalance{UserID: 1, Balance: 100}}))
+	assert.NoError(t, w.Flush())
+	expected := "id: 42\nevent: transaction\ndata: " +
+		`{"transaction_id":42,"user_id":1,"amount":100,"date":"0001-01-01T00:00:00Z","message":"","operation":"accrual"}` +
+		"\n\nevent: balance\ndata: " + `{"user_id":1,"balance":100}` + "\n\n"
+	assert.Equal(t, expected, buf.String())
+}
 
-func (ml *mockLogger) Errorf(format string, args ...interface{}) {}
-func (ml *mockLogger) Fatalf(format string, args ...interface{}) {}
-func (ml *mockLogger) Fatal(args ...interface{})                 {}
-func (ml *mockLogger) Infof(format string, args ...interface{})  {}
-func (ml *mockLogger) Info(args ...interface{})                  {}
-func (ml *mockLogger) Warnf(format string, args ...interface{})  {}
-func (ml *mockLogger) Debugf(format string, args ...interface{}) {}
-func (ml *mockLogger) Debug(args ...interface{})                 {}
-func (ml *mockLogger) Panicf(format string, args ...interface{}) {}
-func (ml *mockLogger) Printf(format string, args ...interface{}) {}
+func TestExportTable(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName            string
+		table               string
+		query               map[string]string
+		expectedStatusCode  int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			"csv by default",
+			"transactions",
+			map[string]string{"from": "2022-10-01", "to": "2022-11-01"},
+			200,
+			"text/csv; charset=utf-8",
+			"ok\n",
+		},
+		{
+			"parquet",
+			"orders",
+			map[string]string{"format": "parquet", "user_id": "1"},
+			200,
+			"application/vnd.apache.parquet",
+			"ok\n",
+		},
+		{
+			"interrupted csv",
+			"transactions",
+			map[string]string{"user_id": "2"},
+			200,
+			"text/csv; charset=utf-8",
+			"ok\n\n#error: export interrupted by a server error, the data is incomplete\n",
+		},
+		{
+			"interrupted ndjson",
+			"orders",
+			map[string]string{"format": "ndjson", "user_id": "2"},
+			200,
+			"application/x-ndjson",
+			"ok\n{\"error\":\"export interrupted by a server error, the data is incomplete\"}\n",
+		},
+		{
+			"invalid user id",
+			"transactions",
+			map[string]string{"user_id": "one"},
+			400,
+			"application/json",
+			"",
+		},
+		{
+			"invalid table",
+			"users",
+			nil,
+			400,
+			"application/json",
+			"",
+		},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.SetUserValue("table", testCase.table)
+		for key, value := range testCase.query {
+			ctx.QueryArgs().Set(key, value)
+		}
+		mockApp.exportTable(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
+		assert.Equal(t, testCase.expectedContentType, string(ctx.Response.Header.ContentType()), testCase.testName)
+		if testCase.expectedBody != "" {
+			assert.Equal(t, testCase.expectedBody, string(ctx.Response.Body()), testCase.testName)
+		}
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		data               models.WebhookSubscription
+		expectedStatusCode int
+	}{
+		{
+			"valid data",
+			models.WebhookSubscription{
+				URL:        "https://orders.example.com/hooks",
+				EventTypes: []string{models.EventOrderCharged, models.EventOrderCancelled},
+			},
+			201,
+		},
+		{
+			"missing url",
+			models.WebhookSubscription{
+				EventTypes: []string{models.EventFundsAccrued},
+			},
+			400,
+		},
+		{
+			"no event types",
+			models.WebhookSubscription{
+				URL: "https://orders.example.com/hooks",
+			},
+			400,
+		},
+		{
+			"unknown event type",
+			models.WebhookSubscription{
+				URL:        "https://orders.example.com/hooks",
+				EventTypes: []string{"funds.stolen"},
+			},
+			400,
+		},
+		{
+			"short secret",
+			models.WebhookSubscription{
+				URL:        "https://orders.example.com/hooks",
+				EventTypes: []string{models.EventFundsAccrued},
+				Secret:     "secret",
+			},
+			400,
+		},
+		{
+			"internal error",
+			models.WebhookSubscription{
+				URL:        "https://error.example.com/hooks",
+				EventTypes: []string{models.EventFundsAccrued},
+			},
+			500,
+		},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		data, _ := json.Marshal(testCase.data)
+		ctx.Request.SetBody(data)
+		mockApp.createWebhook(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
+		if testCase.expectedStatusCode == 201 {
+			var s models.WebhookSubscription
+			assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &s), testCase.testName)
+			assert.NotEmpty(t, s.Secret, testCase.testName)
+		}
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		id                 string
+		expectedStatusCode int
+	}{
+		{"valid data", "1", 200},
+		{"missing subscription", "3", 404},
+		{"invalid subscription id", "one", 400},
+		{"internal error", "2", 500},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.SetUserValue("id", testCase.id)
+		mockApp.deleteWebhook(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		query              map[string]string
+		expectedStatusCode int
+	}{
+		{"no filter", nil, 200},
+		{"dead letters of the subscription", map[string]string{"subscription_id": "1", "status": "dead"}, 200},
+		{"unknown status", map[string]string{"status": "lost"}, 400},
+		{"invalid limit", map[string]string{"limit": "many"}, 400},
+		{"invalid subscription id", map[string]string{"subscription_id": "one"}, 400},
+		{"internal error", map[string]string{"subscription_id": "2"}, 500},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		for key, value := range testCase.query {
+			ctx.QueryArgs().Set(key, value)
+		}
+		mockApp.getWebhookDeliveries(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
+	}
+}
+
+func TestReplayWebhookDelivery(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		id                 string
+		expectedStatusCode int
+	}{
+		{"valid data", "1", 202},
+		{"missing delivery", "3", 404},
+		{"invalid delivery id", "one", 400},
+		{"internal error", "2", 500},
+	}
+	for _, testCase := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.SetUserValue("id", testCase.id)
+		mockApp.replayWebhookDelivery(ctx)
+		assert.Equal(t, testCase.expectedStatusCode, ctx.Response.StatusCode(), testCase.testName)
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	signature := service.SignPayload("0123456789abcdef", "1700000000", body)
+	assert.Equal(t, signature, service.SignPayload("0123456789abcdef", "1700000000", body))
+	assert.True(t, strings.HasPrefix(signature, "sha256="))
+	assert.Len(t, signature, len("sha256=")+64)
+	assert.NotEqual(t, signature, service.SignPayload("0123456789abcdef", "1700000001", body))
+	assert.NotEqual(t, signature, service.SignPayload("fedcba9876543210", "1700000000", body))
+}
+
+func TestParseErrors(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		contentType        string
+		body               string
+		expectedStatusCode int
+		expectedErrors     []parser.FieldError
+	}{
+		{"valid data", "application/json", `{"user_id":1,"amount":10}`, 200, nil},
+		{"content type with charset", "application/json; charset=utf-8", `{"user_id":1,"amount":10}`, 200, nil},
+		{"without content type", "", `{"user_id":1,"amount":10}`, 200, nil},
+		{"form content type", "application/x-www-form-urlencoded", `{"user_id":1,"amount":10}`, 415, nil},
+		{"too large body", "application/json", `{"user_id":1,"amount":10,"comment":"` +
+			strings.Repeat("a", 1024) + `"}`, 413, nil},
+		{"empty body", "application/json", ``, 400, nil},
+		{"malformed json", "application/json", `{"user_id":1,`, 400, nil},
+		{"trailing data", "application/json", `{"user_id":1,"amount":10} {"user_id":2}`, 400, nil},
+		{"not an object", "application/json", `[1]`, 400, nil},
+		{"unknown field", "application/json", `{"user_id":1,"amount":10,"currency":"RUB"}`, 400,
+			[]parser.FieldError{{Field: "currency", Rule: "unknown", Message: "is not a known field"}}},
+		{"wrong type", "application/json", `{"user_id":"1","amount":10}`, 400,
+			[]parser.FieldError{{Field: "user_id", Rule: "type", Message: "must be a number"}}},
+		{"invalid fields", "application/json", `{"user_id":0,"amount":0,"operation":"refund"}`, 400,
+			[]parser.FieldError{
+				{Field: "user_id", Rule: "gte", Message: "must be greater than or equal to 1"},
+				{Field: "amount", Rule: "gt", Message: "must be greater than 0"},
+				{Field: "order_id", Rule: "required_if", Message: "is required when operation is refund"},
+			}},
+	}
+	for _, tc := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod("POST")
+		if tc.contentType != "" {
+			ctx.Request.Header.SetContentType(tc.contentType)
+		}
+		ctx.Request.SetBody([]byte(tc.body))
+		mockApp.accrualFunds(ctx)
+		assert.Equal(t, tc.expectedStatusCode, ctx.Response.StatusCode(), tc.testName)
+		var resp response
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &resp), tc.testName)
+		assert.Equal(t, tc.expectedErrors, resp.Errors, tc.testName)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tableTest := []struct {
+		testName        string
+		origins         []string
+		credentials     bool
+		method          string
+		uri             string
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		expectedStatus  int
+		expectedOrigin  string
+		expectedHeaders map[string]string
+	}{
+		{"any origin", []string{"*"}, false, "POST", "/get_balance", "https://shop.example.com", "", "", 200, "*",
+			map[string]string{"Access-Control-Expose-Headers": "X-Request-ID"}},
+		{"allowed origin", []string{"https://shop.example.com"}, true, "POST", "/get_balance",
+			"https://shop.example.com", "", "", 200, "https://shop.example.com",
+			map[string]string{"Access-Control-Allow-Credentials": "true", "Vary": "Origin"}},
+		{"subdomain", []string{"https://*.example.com"}, false, "POST", "/get_balance", "https://admin.example.com",
+			"", "", 200, "https://admin.example.com", nil},
+		{"other origin", []string{"https://shop.example.com"}, false, "POST", "/get_balance", "https://evil.com",
+			"", "", 200, "", nil},
+		{"same origin", []string{"*"}, false, "POST", "/get_balance", "", "", "", 200, "", nil},
+		{"preflight", []string{"https://shop.example.com"}, false, "OPTIONS", "/accrual", "https://shop.example.com",
+			"POST", "Content-Type, X-API-Key", 204, "https://shop.example.com",
+			map[string]string{"Access-Control-Allow-Methods": "GET, POST, DELETE",
+				"Access-Control-Allow-Headers": "Content-Type, X-API-Key", "Access-Control-Max-Age": "600"}},
+		{"preflight of the other origin", []string{"https://shop.example.com"}, false, "OPTIONS", "/accrual",
+			"https://evil.com", "POST", "", 204, "", map[string]string{"Access-Control-Allow-Methods": ""}},
+		{"preflight of the not allowed method", []string{"*"}, false, "OPTIONS", "/accrual",
+			"https://shop.example.com", "PUT", "", 204, "", nil},
+		{"preflight of the not allowed header", []string{"*"}, false, "OPTIONS", "/accrual",
+			"https://shop.example.com", "POST", "X-Secret", 204, "", nil},
+		{"preflight of the unknown route", []string{"*"}, false, "OPTIONS", "/unknown", "https://shop.example.com",
+			"POST", "", 404, "", nil},
+	}
+	for _, tc := range tableTest {
+		mockApp := getAppMoc()
+		mockApp.config.ConfigCORS = configs.ConfigCORS{
+			CORSAllowedOrigins:   tc.origins,
+			CORSAllowedMethods:   []string{"GET", "POST", "DELETE"},
+			CORSAllowedHeaders:   []string{"Accept", "Content-Type", "X-API-Key"},
+			CORSExposedHeaders:   []string{"X-Request-ID"},
+			CORSAllowCredentials: tc.credentials,
+			CORSMaxAge:           10 * time.Minute,
+		}
+		handler := mockApp.CORS(mockApp.Routing().Handler)
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(tc.method)
+		ctx.Request.SetRequestURI(tc.uri)
+		ctx.Request.SetBody([]byte(`{"user_id":1}`))
+		if tc.origin != "" {
+			ctx.Request.Header.Set("Origin", tc.origin)
+		}
+		if tc.requestMethod != "" {
+			ctx.Request.Header.Set("Access-Control-Request-Method", tc.requestMethod)
+		}
+		if tc.requestHeaders != "" {
+			ctx.Request.Header.Set("Access-Control-Request-Headers", tc.requestHeaders)
+		}
+		handler(ctx)
+		assert.Equal(t, tc.expectedStatus, ctx.Response.StatusCode(), tc.testName)
+		assert.Equal(t, tc.expectedOrigin, string(ctx.Response.Header.Peek("Access-Control-Allow-Origin")),
+			tc.testName)
+		for name, value := range tc.expectedHeaders {
+			assert.Equal(t, value, string(ctx.Response.Header.Peek(name)), tc.testName)
+		}
+		// the logging of the requests doesn't change the headers
+		assert.NotContains(t, string(ctx.Response.Header.ContentType()), "*/*", tc.testName)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tableTest := []struct {
+		testName           string
+		enabled            bool
+		header             string
+		key                string
+		uri                string
+		expectedStatusCode int
+	}{
+		{"auth disabled", false, "", "", "/accrual", 200},
+		{"missing key", true, "", "", "/accrual", 401},
+		{"unknown key", true, "X-API-Key", "avk_unknown", "/accrual", 401},
+		{"key with the scope", true, "X-API-Key", "avk_billing", "/accrual", 200},
+		{"bearer token", true, "Authorization", "Bearer avk_billing", "/accrual", 200},
+		{"key without the scope", true, "X-API-Key", "avk_billing", "/transfer", 403},
+		{"admin key", true, "X-API-Key", "avk_admin", "/transfer", 200},
+		{"admin route", true, "X-API-Key", "avk_billing", "/admin/keys", 403},
+	}
+	for _, tc := range tableTest {
+		mockApp := getAppMoc()
+		mockApp.config.AuthEnabled = tc.enabled
+		handler := mockApp.Routing().Handler
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod("POST")
+		ctx.Request.SetRequestURI(tc.uri)
+		if tc.header != "" {
+			ctx.Request.Header.Set(tc.header, tc.key)
+		}
+		switch tc.uri {
+		case "/accrual":
+			ctx.Request.SetBody([]byte(`{"user_id":1,"amount":10}`))
+		case "/transfer":
+			ctx.Request.SetBody([]byte(`{"sender_id":1,"receiver_id":3,"amount":10}`))
+		}
+		handler(ctx)
+		assert.Equal(t, tc.expectedStatusCode, ctx.Response.StatusCode(), tc.testName)
+		if tc.expectedStatusCode == 401 {
+			assert.Equal(t, "Bearer", string(ctx.Response.Header.Peek("WWW-Authenticate")), tc.testName)
+		}
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		handler            fasthttp.RequestHandler
+		id                 string
+		body               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{"issue", mockApp.issueAPIKey, "", `{"client":"billing","scopes":["funds:accrue"]}`, 201, `"key":"avk_issued"`},
+		{"issue without scopes", mockApp.issueAPIKey, "", `{"client":"billing","scopes":[]}`, 400, ""},
+		{"issue unknown scope", mockApp.issueAPIKey, "", `{"client":"billing","scopes":["all"]}`, 400, ""},
+		{"list", mockApp.getAPIKeys, "", "", 200, `"client":"billing"`},
+		{"revoke", mockApp.revokeAPIKey, "1", "", 200, ""},
+		{"revoke missing key", mockApp.revokeAPIKey, "2", "", 404, ""},
+		{"revoke invalid id", mockApp.revokeAPIKey, "a", "", 400, ""},
+	}
+	for _, tc := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetBody([]byte(tc.body))
+		ctx.SetUserValue("id", tc.id)
+		tc.handler(ctx)
+		assert.Equal(t, tc.expectedStatusCode, ctx.Response.StatusCode(), tc.testName)
+		assert.Contains(t, string(ctx.Response.Body()), tc.expectedBody, tc.testName)
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	tableTest := []struct {
+		testName           string
+		key                string
+		uri                string
+		body               string
+		expectedLogged     bool
+		expectedClient     string
+		expectedStatusCode int
+		expectedMessage    string
+		expectedSuccess    []int
+	}{
+		{"successful accrual", "avk_billing", "/accrual", `{"user_id":1,"amount":10}`, true, "billing", 200,
+			"funds have been successfully credited to the balance of the user with id 1", []int{200}},
+		{"failed accrual", "avk_billing", "/accrual", `{"user_id":2,"amount":10}`, true, "billing", 500,
+			"internal error", []int{200}},
+		{"rejected scope", "avk_billing", "/transfer", `{"sender_id":1,"receiver_id":3,"amount":10}`, true,
+			"billing", 403, "client billing is not allowed to funds:transfer", []int{200}},
+		{"unknown key", "avk_unknown", "/accrual", `{"user_id":1,"amount":10}`, true, "", 401,
+			"api key is invalid or revoked", []int{200}},
+		{"read-only call", "avk_billing", "/get_balance", `{"user_id":1}`, false, "", 0, "", nil},
+		{"created order", "avk_admin", "/create_order", `{"order_id":1,"user_id":1,"service_id":1,"amount":10}`,
+			true, "support", 200, "order 1 successfully created, funds reserved", []int{201}},
+	}
+	for _, tc := range tableTest {
+		mockApp := getAppMoc()
+		mockApp.config.AuthEnabled = true
+		handler := mockApp.RequestID(mockApp.Routing().Handler)
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod("POST")
+		ctx.Request.SetRequestURI(tc.uri)
+		ctx.Request.Header.Set("X-API-Key", tc.key)
+		ctx.Request.Header.Set("X-Request-ID", "req-1")
+		ctx.Request.SetBody([]byte(tc.body))
+		handler(ctx)
+		// the balance change would record the call with the status of the success of the route
+		assert.Equal(t, tc.expectedSuccess, mockApp.services.Audit.(*mockAuditService).successes, tc.testName)
+		entries := mockApp.services.Audit.(*mockAuditService).entries
+		if !tc.expectedLogged {
+			assert.Empty(t, entries, tc.testName)
+			continue
+		}
+		if assert.Len(t, entries, 1, tc.testName) {
+			e := entries[0]
+			assert.Equal(t, tc.expectedClient, e.Client, tc.testName)
+			assert.Equal(t, tc.uri, e.Endpoint, tc.testName)
+			assert.Equal(t, "req-1", e.RequestID, tc.testName)
+			assert.Equal(t, tc.expectedStatusCode, e.StatusCode, tc.testName)
+			assert.Equal(t, tc.expectedMessage, e.Message, tc.testName)
+			assert.JSONEq(t, tc.body, string(e.Payload), tc.testName)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	mockApp := getAppMoc()
+	tableTest := []struct {
+		testName           string
+		handler            fasthttp.RequestHandler
+		query              string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{"entries", mockApp.getAudit, "client=billing&user_id=42", 200, `"client":"billing"`},
+		{"invalid user id", mockApp.getAudit, "user_id=a", 400, "user_id must be an integer"},
+		{"invalid after id", mockApp.getAudit, "after_id=a", 400, "after_id must be an integer"},
+		{"invalid period", mockApp.getAudit, "from=bad", 400, "invalid date"},
+		{"export", mockApp.exportAudit, "endpoint=/accrual", 200, `{"audit_id":1}`},
+		{"export invalid period", mockApp.exportAudit, "from=bad", 400, "invalid date"},
+		{"interrupted export", mockApp.exportAudit, "client=broken", 200,
+			`{"audit_id":1}` + "\n" + `{"error":"export interrupted by a server error, the data is incomplete"}`},
+		{"verify", mockApp.verifyAudit, "", 200, `"valid":true`},
+	}
+	for _, tc := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/admin/audit?" + tc.query)
+		tc.handler(ctx)
+		assert.Equal(t, tc.expectedStatusCode, ctx.Response.StatusCode(), tc.testName)
+		// the body of the export is streamed
+		body := ctx.Response.Body()
+		if ctx.Response.IsBodyStream() {
+			var buf bytes.Buffer
+			ctx.Response.BodyWriteTo(&buf)
+			body = buf.Bytes()
+		}
+		assert.Contains(t, string(body), tc.expectedBody, tc.testName)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tableTest := []struct {
+		testName   string
+		requestID  string
+		body       string
+		expectedID string
+		expected   []string
+	}{
+		{
+			"id of the caller",
+			"req-42",
+			`{"user_id":7,"amount":10}`,
+			"req-42",
+			[]string{`"request_id":"req-42"`, `"user_id":7`, `"status":200`},
+		},
+		{
+			"generated id",
+			"",
+			`{"user_id":2,"amount":10}`,
+			"",
+			[]string{`"msg":"accrual funds error: internal error"`, `"user_id":2`, `"status":500`},
+		},
+		{
+			"invalid id of the caller",
+			"bad id",
+			`{"user_id":7,"amount":10}`,
+			"",
+			[]string{`"user_id":7`},
+		},
+		{
+			"refund with the order",
+			"req-43",
+			`{"user_id":7,"amount":10,"operation":"refund","order_id":9}`,
+			"req-43",
+			[]string{`"order_id":9`, `"user_id":7`},
+		},
+	}
+	for _, tc := range tableTest {
+		var buf bytes.Buffer
+		log := logger.New()
+		assert.NoError(t, log.Configure("info", "json", "stdout"), tc.testName)
+		log.Logger.SetOutput(&buf)
+		mockApp := getAppMoc()
+		mockApp.logger = log
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod("POST")
+		if tc.requestID != "" {
+			ctx.Request.Header.Set("X-Request-ID", tc.requestID)
+		}
+		ctx.Request.SetBody([]byte(tc.body))
+		mockApp.RequestID(mockApp.LogRequests(mockApp.accrualFunds))(ctx)
+		id := string(ctx.Response.Header.Peek("X-Request-ID"))
+		if tc.expectedID != "" {
+			assert.Equal(t, tc.expectedID, id, tc.testName)
+		} else {
+			assert.Len(t, id, 32, tc.testName)
+		}
+		// each line of the request carries its ID
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			assert.Contains(t, line, fmt.Sprintf(`"request_id":%q`, id), tc.testName)
+		}
+		for _, e := range tc.expected {
+			assert.Contains(t, buf.String(), e, tc.testName)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	mockApp := getAppMoc()
+	handler := mockApp.Metrics(mockApp.Routing().Handler)
+	tableTest := []struct {
+		testName           string
+		method             string
+		uri                string
+		expectedStatusCode int
+	}{
+		{"matched route", "POST", "/transactions", 400},
+		{"unmatched route", "GET", "/unknown", 404},
+	}
+	for _, tc := range tableTest {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(tc.method)
+		ctx.Request.SetRequestURI(tc.uri)
+		handler(ctx)
+		assert.Equal(t, tc.expectedStatusCode, ctx.Response.StatusCode(), tc.testName)
+	}
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/metrics")
+	handler(ctx)
+	assert.Equal(t, 200, ctx.Response.StatusCode())
+	body := string(ctx.Response.Body())
+	assert.Contains(t, body, `avito_http_requests_total{method="POST",route="/transactions",status="400"} 1`)
+	assert.Contains(t, body, `avito_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `avito_http_request_duration_seconds_bucket{method="POST",route="/transactions",status="400"`)
+}
+
+func TestTracing(t *testing.T) {
+	_, err := tracing.Init(configs.ConfigTracing{TracingExporter: tracing.ExporterNone})
+	assert.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	mockApp := getAppMoc()
+	handler := mockApp.Tracing(mockApp.Routing().Handler)
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/transactions")
+	ctx.Request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx.Request.SetBody([]byte(`{"user_id":`))
+	handler(ctx)
+	assert.Equal(t, 400, ctx.Response.StatusCode())
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	parse, request := spans[0], spans[1]
+	assert.Equal(t, "POST /transactions", request.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", request.Parent().SpanID().String())
+	assert.Equal(t, codes.Unset, request.Status().Code)
+	assert.Equal(t, "Parser.UnmarshalBody", parse.Name())
+	assert.Equal(t, request.SpanContext().SpanID(), parse.Parent().SpanID())
+}
+
+func TestHealthz(t *testing.T) {
+	mockApp := getAppMoc()
+	ctx := new(fasthttp.RequestCtx)
+	mockApp.healthz(ctx)
+	assert.Equal(t, 200, ctx.Response.StatusCode())
+}
+
+func TestReadyz(t *testing.T) {
+	tableTest := []struct {
+		testName           string
+		prepare            func(a *App)
+		expectedStatusCode int
+		expectedCheck      string
+	}{
+		{
+			"ready",
+			func(a *App) {
+				a.workers.Store("stream", true)
+			},
+			200,
+			"worker stream",
+		},
+		{
+			"database is down",
+			func(a *App) {
+				a.services.Health = mockHealthService{err: "connection refused"}
+			},
+			503,
+			"database",
+		},
+		{
+			"worker has stopped",
+			func(a *App) {
+				a.workers.Store("outbox", false)
+			},
+			503,
+			"worker outbox",
+		},
+		{
+			"shutting down",
+			func(a *App) {
+				a.shuttingDown.Store(true)
+			},
+			503,
+			"shutdown",
+		},
+	}
+	for _, tc := range tableTest {
+		mockApp := getAppMoc()
+		tc.prepare(mockApp)
+		ctx := new(fasthttp.RequestCtx)
+		mockApp.readyz(ctx)
+		assert.Equal(t, tc.expectedStatusCode, ctx.Response.StatusCode(), tc.testName)
+		var readiness models.Readiness
+		assert.NoError(t, json.Unmarshal(ctx.Response.Body(), &readiness), tc.testName)
+		assert.Equal(t, tc.expectedStatusCode == 200, readiness.Ready, tc.testName)
+		found := false
+		for _, check := range readiness.Checks {
+			if check.Name == tc.expectedCheck {
+				found = true
+				assert.Equal(t, tc.expectedStatusCode == 200, check.OK, tc.testName)
+			}
+		}
+		assert.True(t, found, tc.testName)
+	}
+}
+
+type mockUserService struct{}
+type mockOrderService struct{}
+type mockTransactionService struct{}
+type mockReconciliationService struct{}
+type mockCatalogService struct{}
+type mockJournalService struct{}
+type mockExportService struct{}
+type mockStreamService struct{}
+type mockWebhookService struct{}
+type mockHealthService struct {
+	err string
+}
+
+type mockAuthService struct{}
+type mockAuditService struct {
+	entries   []models.AuditEntry
+	successes []int
+}
+
+func (ms mockUserService) AccrualFunds(ctx context.Context, ac models.AccrualFunds) (code int, err error) {
+	if ac.UserID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	return 200, nil
+}
+func (ms mockUserService) GetBalance(ctx context.Context, ub *models.UserBalance) (code int, err error) {
+	if ub.UserID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	ub.Balance = 100
+	return 200, nil
+}
+func (ms mockUserService) BlockFunds(ctx context.Context, order models.Order) (code int, err error) {
+	if order.UserID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	return 200, nil
+}
+func (ms mockUserService) TransferFunds(ctx context.Context, t models.Transfer) (code int, err error) {
+	if t.SenderID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	return 200, nil
+}
+func (ms mockUserService) UnblockFunds(ctx context.Context, unblock models.Unblock) (code int, err error) {
+	if unblock.UserID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	return 200, nil
+}
+func (ms mockOrderService) GetOpenReservations(ctx context.Context) (count int64, amount float64, err error) {
+	return 0, 0, nil
+}
+func (ms mockUserService) AdjustBalance(ctx context.Context, adj models.Adjustment) (code int, err error) {
+	if adj.UserID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	if adj.Amount < -100 {
+		return 400, fmt.Errorf("adjustment is not possible: the balance 100.00 of the user %d is less than the debit %.2f",
+			adj.UserID, -adj.Amount)
+	}
+	return 200, nil
+}
+func (ms mockOrderService) ChargeFunds(ctx context.Context, order models.Order) (code int, err error) {
+	if order.UserID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	return 200, nil
+}
+func (ms mockOrderService) GetReport(ctx context.Context, report models.Report) (data []byte, code int, err error) {
+	if report.Year == 2008 {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+	return []byte("ok"), 200, nil
+}
+func (ms mockTransactionService) GetUserTransactions(ctx context.Context,
+	tr models.TransactionListRequest) (page models.TransactionPage, code int, err error) {
+	if tr.UserID == 2 {
+		return page, 500, fmt.Errorf("internal error")
+	}
+	if tr.Cursor == "invalid" {
+		return page, 400, fmt.Errorf("invalid cursor")
+	}
+	page.Transactions = []models.TransactionList{{UserID: tr.UserID, Description: tr.Language}}
+	if tr.WithSummary {
+		page.Summary = &models.TransactionSummary{Count: 2, Incoming: 100, Outgoing: 40, Net: 60}
+	}
+	return page, 200, nil
+}
+
+func (ms mockTransactionService) GetTransactionDetail(ctx context.Context,
+	req models.TransactionDetailRequest) (detail models.TransactionDetail, code int, err error) {
+	if req.TransactionID == 2 {
+		return detail, 500, fmt.Errorf("internal error")
+	}
+	if req.TransactionID == 3 || (req.UserID != 0 && req.UserID != 1) {
+		return detail, 404, fmt.Errorf("transaction with id %d does not exist", req.TransactionID)
+	}
+	detail.Transaction = models.TransactionList{TransactionID: req.TransactionID, UserID: 1}
+	return detail, 200, nil
+}
+
+func (ms mockReconciliationService) Reconcile(ctx context.Context,
+	req models.ReconciliationRequest) (rec models.Reconciliation, code int, err error) {
+	if req.Year == 2008 {
+		return rec, 500, fmt.Errorf("internal error")
+	}
+	rec.Balanced = true
+	return rec, 200, nil
+}
+
+func (ms mockCatalogService) UpsertService(ctx context.Context, s models.ServiceInfo) (code int, err error) {
+	if s.ServiceID == 2 {
+		return 500, fmt.Errorf("internal error")
+	}
+	return 200, nil
+}
+func (ms mockCatalogService) GetServices(ctx context.Context) (services []models.ServiceInfo, code int, err error) {
+	return nil, 200, nil
+}
+func (ms mockJournalService) ExportJournal(ctx context.Context, req models.JournalRequest) (data []byte, code int,
+	err error) {
+	if req.Year == 2008 {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+	return []byte("ok"), 200, nil
+}
+
+func (ms mockExportService) PrepareExport(req *models.ExportRequest) (code int, err error) {
+	if req.Table != "transactions" && req.Table != "orders" {
+		return 400, fmt.Errorf("table cannot be exported")
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	return 200, nil
+}
+func (ms mockExportService) Export(ctx context.Context, req models.ExportRequest, w io.Writer) error {
+	_, err := w.Write([]byte("ok\n"))
+	if err == nil && req.UserID == 2 {
+		return fmt.Errorf("connection reset")
+	}
+	return err
+}
+
+type mockLogger struct{}
+
+func (ml *mockLogger) Errorf(format string, args ...interface{}) {}
+func (ml *mockLogger) Fatalf(format string, args ...interface{}) {}
+func (ml *mockLogger) Fatal(args ...interface{})                 {}
+func (ml *mockLogger) Infof(format string, args ...interface{})  {}
+func (ml *mockLogger) Info(args ...interface{})                  {}
+func (ml *mockLogger) Warnf(format string, args ...interface{})  {}
+func (ml *mockLogger) Debugf(format string, args ...interface{}) {}
+func (ml *mockLogger) Debug(args ...interface{})                 {}
+func (ml *mockLogger) Panicf(format string, args ...interface{}) {}
+func (ml *mockLogger) Printf(format string, args ...interface{}) {}
+func (ml *mockLogger) WithFields(fields logger.Fields) logger.Logger {
+	return ml
+}
+func (ml *mockLogger) WithContext(ctx context.Context) logger.Logger {
+	return ml
+}
+
+func (ms mockStreamService) RunStream(ctx context.Context, onError func(err error)) {}
+func (ms mockStreamService) Subscribe(ctx context.Context, req models.StreamRequest) (sub *service.Subscription,
+	code int, err error) {
+	if req.UserID == 2 {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+	if req.UserID < 1 {
+		return nil, 400, fmt.Errorf("user id must not be less than 1")
+	}
+	events := make(chan models.StreamEvent)
+	close(events)
+	return &service.Subscription{Events: events, Cancel: func() {}}, 200, nil
+}
+
+func (ms mockWebhookService) CreateSubscription(ctx context.Context, s *models.WebhookSubscription) (code int,
+	err error) {
+	if strings.Contains(s.URL, "error") {
+		return 500, fmt.Errorf("internal error")
+	}
+	s.SubscriptionID, s.Secret = 1, "0123456789abcdef0123456789abcdef"
+	return 201, nil
+}
+func (ms mockWebhookService) GetSubscriptions(ctx context.Context) (subscriptions []models.WebhookSubscription,
+	code int, err error) {
+	return []models.WebhookSubscription{}, 200, nil
+}
+func (ms mockWebhookService) DeleteSubscription(ctx context.Context, id int) (code int, err error) {
+	switch id {
+	case 2:
+		return 500, fmt.Errorf("internal error")
+	case 3:
+		return 404, fmt.Errorf("webhook subscription does not exist")
+	}
+	return 200, nil
+}
+func (ms mockWebhookService) GetDeliveries(ctx context.Context,
+	f models.WebhookDeliveryFilter) (deliveries []models.WebhookDelivery,
+	code int, err error) {
+	if f.SubscriptionID == 2 {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+	switch f.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		return nil, 400, fmt.Errorf("unknown delivery status")
+	}
+	return []models.WebhookDelivery{}, 200, nil
+}
+func (ms mockWebhookService) ReplayDelivery(ctx context.Context, id int64) (code int, err error) {
+	switch id {
+	case 2:
+		return 500, fmt.Errorf("internal error")
+	case 3:
+		return 404, fmt.Errorf("webhook delivery does not exist")
+	}
+	return 202, nil
+}
+func (ms mockWebhookService) RunWebhooks(ctx context.Context, onError func(err error)) {}
+
+func (ms mockAuthService) IssueAPIKey(ctx context.Context, key *models.APIKey) (code int, err error) {
+	key.KeyID, key.Key = 1, "avk_issued"
+	return 201, nil
+}
+func (ms mockAuthService) GetAPIKeys(ctx context.Context) (keys []models.APIKey, code int, err error) {
+	return []models.APIKey{{KeyID: 1, Client: "billing", Scopes: []string{models.ScopeAccrual}}}, 200, nil
+}
+func (ms mockAuthService) RevokeAPIKey(ctx context.Context, id int) (code int, err error) {
+	if id == 2 {
+		return 404, fmt.Errorf("api key does not exist or has already been revoked")
+	}
+	return 200, nil
+}
+func (ms mockAuthService) Authorize(ctx context.Context, key, scope string) (client models.APIKey, code int,
+	err error) {
+	switch key {
+	case "avk_billing":
+		client = models.APIKey{KeyID: 1, Client: "billing", Scopes: []string{models.ScopeAccrual}}
+	case "avk_admin":
+		client = models.APIKey{KeyID: 2, Client: "support", Scopes: []string{models.ScopeAdmin}}
+	default:
+		return client, 401, fmt.Errorf("api key is invalid or revoked")
+	}
+	for _, s := range client.Scopes {
+		if s == scope || s == models.ScopeAdmin {
+			return client, 200, nil
+		}
+	}
+	return client, 403, fmt.Errorf("client %s is not allowed to %s", client.Client, scope)
+}
+
+func (ms *mockAuditService) WithAudit(ctx context.Context, status int, entry func() models.AuditEntry) (context.Context,
+	*repository.AuditRecord) {
+	// the mock services don't change the balances, the calls are recorded after they are handled
+	ms.successes = append(ms.successes, status)
+	return ctx, repository.NewAuditRecord(entry)
+}
+func (ms *mockAuditService) RecordAudit(ctx context.Context, e models.AuditEntry) error {
+	ms.entries = append(ms.entries, e)
+	return nil
+}
+func (ms *mockAuditService) GetAudit(ctx context.Context, f models.AuditFilter) (entries []models.AuditEntry,
+	code int, err error) {
+	if code, err = ms.PrepareAudit(&f); err != nil {
+		return nil, code, err
+	}
+	return []models.AuditEntry{{AuditID: 1, Client: f.Client, Endpoint: "/accrual"}}, 200, nil
+}
+func (ms *mockAuditService) PrepareAudit(f *models.AuditFilter) (code int, err error) {
+	if f.DateFrom == "bad" {
+		return 400, fmt.Errorf("invalid date")
+	}
+	return 200, nil
+}
+func (ms *mockAuditService) ExportAudit(ctx context.Context, f models.AuditFilter, w io.Writer) error {
+	_, err := fmt.Fprintln(w, `{"audit_id":1}`)
+	if err == nil && f.Client == "broken" {
+		err = fmt.Errorf("connection reset")
+	}
+	return err
+}
+func (ms *mockAuditService) VerifyAudit(ctx context.Context) (v models.AuditVerification, code int, err error) {
+	return models.AuditVerification{Valid: true, Entries: 1}, 200, nil
+}
+func (ms *mockAuditService) RunAudit(ctx context.Context, onError func(err error)) {}
+
+func (ms mockHealthService) CheckReadiness(ctx context.Context) []models.HealthCheck {
+	return []models.HealthCheck{
+		{Name: "database", OK: ms.err == "", Error: ms.err},
+		{Name: "migrations", OK: true},
+	}
+}
@@ -1,22 +1,321 @@
 package app
 
 import (
+	"avito/internal/metrics"
+	"avito/internal/models"
+	"avito/internal/tracing"
+	"avito/pkg/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/fasthttp/router"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// LogRequests - middleware that logs all requests and
+// requestIDHeader - header of the ID of the request, the ID of the caller is kept and returned in the response
+const requestIDHeader = "X-Request-ID"
+
+// apiKeyHeader - header of the API key of the client, the key can also be sent as the bearer token
+const apiKeyHeader = "X-API-Key"
+
+// clientKey - key of the user value holding the API key of the authorized client
+const clientKey = "client"
+
+// maxRequestIDLength - the longer IDs of the caller are replaced with the generated ones
+const maxRequestIDLength = 128
+
+// LogRequests - middleware that logs all requests with the fields of the request
 func (a *App) LogRequests(h fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
-		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-Secret, Access-Control-Allow-Origin, Access-Control-Allow-Headers, X-CSRF-Token, Authorization-Token")
-		ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
-		ctx.Response.Header.Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		ctx.Response.Header.Set("Content-Type", "*/*; charset=utf-8")
 		start := time.Now()
 		h(ctx)
-		fullURI := string(ctx.Request.URI().Path())
-		a.logger.Printf("start request: %s | status code: %d | request duration: %s | ip: %s | method: %s, URI: %s",
-			start.Format("2006-01-02 - 15:04:05"), ctx.Response.StatusCode(),
-			time.Since(start), ctx.RemoteIP(), ctx.Method(), fullURI)
+		// the fields added by the handler, such as the user and the order, are logged with the request
+		a.log(ctx).WithFields(logger.Fields{
+			"status":      ctx.Response.StatusCode(),
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"ip":          ctx.RemoteIP().String(),
+			"method":      string(ctx.Method()),
+			"uri":         string(ctx.Request.URI().Path()),
+		}).Info("request")
+	}
+}
+
+// CORS - middleware that lets the browser scripts of the allowed origins read the responses. The preflight
+// requests are answered by the router with Preflight
+func (a *App) CORS(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		h(ctx)
+		if ctx.IsOptions() {
+			return
+		}
+		if a.allowOrigin(ctx) && len(a.config.CORSExposedHeaders) != 0 {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlExposeHeaders,
+				strings.Join(a.config.CORSExposedHeaders, ", "))
+		}
+	}
+}
+
+// Preflight - answers the preflight request of the browser to the existing route. The CORS headers are set only
+// when the origin, the method and the headers of the request are allowed, otherwise the browser blocks the request
+func (a *App) Preflight(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+	ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccessControlRequestMethod)
+	ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccessControlRequestHeaders)
+	method := string(ctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestMethod))
+	if !containsFold(a.config.CORSAllowedMethods, method) {
+		return
+	}
+	requested := string(ctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestHeaders))
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !containsFold(a.config.CORSAllowedHeaders, header) &&
+			!containsFold(a.config.CORSAllowedHeaders, "*") {
+			return
+		}
+	}
+	if !a.allowOrigin(ctx) {
+		return
+	}
+	ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowMethods, strings.Join(a.config.CORSAllowedMethods, ", "))
+	if requested != "" {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowHeaders, requested)
+	}
+	if a.config.CORSMaxAge > 0 {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlMaxAge,
+			strconv.Itoa(int(a.config.CORSMaxAge.Seconds())))
+	}
+}
+
+// allowOrigin - sets the allowed origin of the cross-origin request and the credentials, returns false
+// when the request is not cross-origin or its origin is not allowed
+func (a *App) allowOrigin(ctx *fasthttp.RequestCtx) bool {
+	if !a.config.AllowsAnyOrigin() {
+		// the response depends on the origin, so the caches must not share it between the origins
+		ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderOrigin)
+	}
+	origin := string(ctx.Request.Header.Peek(fasthttp.HeaderOrigin))
+	if origin == "" {
+		return false
+	}
+	if a.config.AllowsAnyOrigin() {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, "*")
+		return true
+	}
+	for _, allowed := range a.config.CORSAllowedOrigins {
+		if matchOrigin(allowed, origin) {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, origin)
+			if a.config.CORSAllowCredentials {
+				ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowCredentials, "true")
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin - matches the origin with the allowed one, the allowed origin may have one * standing for
+// the subdomains: https://*.example.com
+func matchOrigin(allowed, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(strings.ToLower(allowed), "*")
+	origin = strings.ToLower(origin)
+	if !wildcard {
+		return origin == prefix
+	}
+	return len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+// containsFold - reports whether the list has the value regardless of the case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize - middleware that authenticates the client by its API key and lets the request through only
+// when the key has the scope. The client is added to the log lines and the span of the request
+func (a *App) Authorize(scope string, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !a.config.AuthEnabled {
+			h(ctx)
+			return
+		}
+		key := string(ctx.Request.Header.Peek(apiKeyHeader))
+		if key == "" {
+			key = strings.TrimPrefix(string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)), "Bearer ")
+		}
+		if key == "" {
+			ctx.Response.Header.Set(fasthttp.HeaderWWWAuthenticate, "Bearer")
+			Response(ctx, 401, "api key is missing", false)
+			return
+		}
+		client, statusCode, err := a.services.Authorize(tracing.FromRequest(ctx), key, scope)
+		if client.KeyID != 0 {
+			// the client of the rejected call is kept too, it is recorded in the audit log
+			ctx.SetUserValue(clientKey, client)
+			logFields(ctx, logger.Fields{"client": client.Client, "key_id": client.KeyID})
+			trace.SpanFromContext(tracing.FromRequest(ctx)).SetAttributes(
+				attribute.String("avito.client", client.Client))
+		}
+		if err != nil {
+			a.log(ctx).Warnf("authorization error: %s", err.Error())
+			if statusCode == 401 {
+				ctx.Response.Header.Set(fasthttp.HeaderWWWAuthenticate, "Bearer")
+			}
+			Response(ctx, statusCode, err.Error(), false)
+			return
+		}
+		h(ctx)
+	}
+}
+
+// Audit - middleware that appends the mutating call to the audit log with the client, the payload and
+// the outcome of the call. The change of the balances appends the entry in its transaction, so the call fails
+// when the entry can't be appended, the entry has the status the call answers on success. The other calls are recorded after they are handled: the rejected calls
+// too, the calls without a valid key are recorded as anonymous
+func (a *App) Audit(status int, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		entry := func() models.AuditEntry {
+			e := models.AuditEntry{
+				Method:    string(ctx.Method()),
+				Endpoint:  string(ctx.Path()),
+				RequestID: string(ctx.Response.Header.Peek(requestIDHeader)),
+				SourceIP:  ctx.RemoteIP().String(),
+				Payload:   append(json.RawMessage(nil), ctx.PostBody()...),
+			}
+			// the client is known once the call is authorized
+			if client, ok := ctx.UserValue(clientKey).(models.APIKey); ok {
+				e.Client, e.KeyID = client.Client, client.KeyID
+			}
+			return e
+		}
+		reqCtx, record := a.services.WithAudit(tracing.FromRequest(ctx), status, entry)
+		ctx.SetUserValue(tracing.RequestContextKey, reqCtx)
+		h(ctx)
+		if record.Recorded() && ctx.Response.StatusCode() < 300 {
+			return
+		}
+		e := entry()
+		e.StatusCode = ctx.Response.StatusCode()
+		var resp response
+		if json.Unmarshal(ctx.Response.Body(), &resp) == nil {
+			e.Message = resp.Description
+		}
+		if err := a.services.RecordAudit(tracing.FromRequest(ctx), e); err != nil {
+			a.log(ctx).Errorf("audit log error: %s", err.Error())
+		}
+	}
+}
+
+// RequestID - middleware that assigns the ID to the request: the X-Request-ID header of the caller or
+// the generated one. The ID is returned in the response and added to the log lines and the span of the request
+func (a *App) RequestID(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		id := string(ctx.Request.Header.Peek(requestIDHeader))
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		ctx.Response.Header.Set(requestIDHeader, id)
+		trace.SpanFromContext(tracing.FromRequest(ctx)).SetAttributes(attribute.String("avito.request_id", id))
+		logFields(ctx, logger.Fields{"request_id": id})
+		h(ctx)
+	}
+}
+
+// validRequestID - the ID of the caller is kept when it is not too long and consists of the printable
+// characters without spaces, so it can't break the log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID - generates the random ID of the request
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// logFields - adds the fields to the log lines of the request
+func logFields(ctx *fasthttp.RequestCtx, fields logger.Fields) {
+	ctx.SetUserValue(tracing.RequestContextKey, logger.ContextWithFields(tracing.FromRequest(ctx), fields))
+}
+
+// logIDs - adds the IDs of the user and the order to the log lines of the request, the zero IDs are skipped
+func logIDs(ctx *fasthttp.RequestCtx, userID, orderID int) {
+	fields := logger.Fields{}
+	if userID != 0 {
+		fields["user_id"] = userID
+	}
+	if orderID != 0 {
+		fields["order_id"] = orderID
+	}
+	if len(fields) != 0 {
+		logFields(ctx, fields)
+	}
+}
+
+// log - returns the logger of the request, its lines carry the ID and the fields of the request
+func (a *App) log(ctx *fasthttp.RequestCtx) logger.Logger {
+	return a.logger.WithContext(tracing.FromRequest(ctx))
+}
+
+// Metrics - middleware that counts the requests and their duration by the pattern of the matched route
+func (a *App) Metrics(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		h(ctx)
+		route, ok := ctx.UserValue(router.MatchedRoutePathParam).(string)
+		if !ok {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(route, string(ctx.Method()), ctx.Response.StatusCode(), time.Since(start))
+	}
+}
+
+// Tracing - middleware that starts the span of the request, continuing the trace of the traceparent header.
+// The context with the span is passed to the handlers by the user value of the request
+func (a *App) Tracing(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		method := string(ctx.Method())
+		c, span := tracing.Tracer().Start(tracing.Extract(&ctx.Request.Header), method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(method),
+				semconv.HTTPTargetKey.String(string(ctx.RequestURI())),
+				semconv.NetPeerIPKey.String(ctx.RemoteIP().String()),
+			))
+		defer span.End()
+		ctx.SetUserValue(tracing.RequestContextKey, c)
+		h(ctx)
+		// the route is known only after the routing, the span is named by its pattern
+		if route, ok := ctx.UserValue(router.MatchedRoutePathParam).(string); ok {
+			span.SetName(method + " " + route)
+			span.SetAttributes(semconv.HTTPRouteKey.String(route))
+		}
+		status := ctx.Response.StatusCode()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= fasthttp.StatusInternalServerError {
+			span.SetStatus(codes.Error, fasthttp.StatusMessage(status))
+		}
 	}
 }
@@ -1,14 +1,17 @@
 package app
 
 import (
+	"avito/internal/parser"
 	"encoding/json"
+	"errors"
 	"github.com/valyala/fasthttp"
 )
 
-// response  - structure for writing response for requests
+// response  - structure for writing response for requests, Errors lists the invalid fields of the request
 type response struct {
-	Success     bool   `json:"success"`
-	Description string `json:"description"`
+	Success     bool                `json:"success"`
+	Description string              `json:"description"`
+	Errors      []parser.FieldError `json:"errors,omitempty"`
 }
 
 // Response - function for response for requests
@@ -26,3 +29,21 @@ func Response(ctx *fasthttp.RequestCtx, statusCode int, description string, stat
 		ctx.SetStatusCode(500)
 	}
 }
+
+// ParseError - function for response for requests with the invalid body: the status code of the error
+// and the list of the invalid fields
+func ParseError(ctx *fasthttp.RequestCtx, err error) {
+	var parseErr *parser.Error
+	if !errors.As(err, &parseErr) {
+		Response(ctx, 400, err.Error(), false)
+		return
+	}
+	ctx.Response.SetStatusCode(parseErr.Code)
+	ctx.SetContentType("application/json")
+	encoder := json.NewEncoder(ctx)
+	encoder.SetIndent("", "\t")
+	encoder.Encode(response{
+		Description: parseErr.Error(),
+		Errors:      parseErr.Fields,
+	})
+}
@@ -1,23 +1,67 @@
 package app
 
 import (
+	"avito/internal/metrics"
+	"avito/internal/models"
 	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpadaptor"
 )
 
 // Routing - method for registering all handlers in the router
 func (a *App) Routing() *router.Router {
 	router := router.New()
-	router.POST("/accrual", a.LogRequests(a.accrualFunds))
-	router.POST("/get_balance", a.LogRequests(a.getBalance))
-	router.POST("/create_order", a.LogRequests(a.blockFunds))
-	router.POST("/charge", a.LogRequests(a.chargeFunds))
-	router.POST("/get_report", a.LogRequests(a.getReport))
-	router.GET("/reports", a.LogRequests(a.downloadReport))
-	router.POST("/transfer", a.LogRequests(a.transferFunds))
-	router.POST("/transactions", a.LogRequests(a.getUserTransactions))
-	router.POST("/cancel_order", a.LogRequests(a.unblockFunds))
+	// the pattern of the matched route is the label of the metrics of the request
+	router.SaveMatchedRoutePath = true
+	// the preflight requests of the browsers are answered for all routes
+	router.HandleOPTIONS = true
+	router.GlobalOPTIONS = a.Preflight
+	// each route requires the scope of the API key, the admin scope grants all of them.
+	// The mutating calls are recorded in the audit log with the status of their success
+	router.POST("/accrual", a.LogRequests(a.Audit(fasthttp.StatusOK, a.Authorize(models.ScopeAccrual, a.accrualFunds))))
+	router.POST("/get_balance", a.LogRequests(a.Authorize(models.ScopeBalances, a.getBalance)))
+	router.POST("/create_order",
+		a.LogRequests(a.Audit(fasthttp.StatusCreated, a.Authorize(models.ScopeOrders, a.blockFunds))))
+	router.POST("/charge", a.LogRequests(a.Audit(fasthttp.StatusOK, a.Authorize(models.ScopeOrders, a.chargeFunds))))
+	router.POST("/get_report", a.LogRequests(a.Authorize(models.ScopeReports, a.getReport)))
+	router.GET("/reports", a.LogRequests(a.Authorize(models.ScopeReports, a.downloadReport)))
+	router.POST("/transfer",
+		a.LogRequests(a.Audit(fasthttp.StatusOK, a.Authorize(models.ScopeTransfer, a.transferFunds))))
+	router.POST("/transactions", a.LogRequests(a.Authorize(models.ScopeBalances, a.getUserTransactions)))
+	router.GET("/transactions/{id}", a.LogRequests(a.Authorize(models.ScopeBalances, a.getTransaction)))
+	router.GET("/stream", a.LogRequests(a.Authorize(models.ScopeBalances, a.streamEvents)))
+	router.POST("/cancel_order",
+		a.LogRequests(a.Audit(fasthttp.StatusOK, a.Authorize(models.ScopeOrders, a.unblockFunds))))
+	router.POST("/admin/reconcile", a.LogRequests(a.Authorize(models.ScopeAdmin, a.reconcile)))
+	router.POST("/admin/services",
+		a.LogRequests(a.Audit(fasthttp.StatusOK, a.Authorize(models.ScopeAdmin, a.upsertService))))
+	router.GET("/admin/services", a.LogRequests(a.Authorize(models.ScopeAdmin, a.getServices)))
+	router.POST("/admin/journal", a.LogRequests(a.Authorize(models.ScopeReports, a.exportJournal)))
+	router.GET("/admin/export/{table}", a.LogRequests(a.Authorize(models.ScopeAdmin, a.exportTable)))
+	router.GET("/admin/transactions/{id}", a.LogRequests(a.Authorize(models.ScopeAdmin, a.getTransactionAdmin)))
+	router.POST("/admin/webhooks",
+		a.LogRequests(a.Audit(fasthttp.StatusCreated, a.Authorize(models.ScopeAdmin, a.createWebhook))))
+	router.GET("/admin/webhooks", a.LogRequests(a.Authorize(models.ScopeAdmin, a.getWebhooks)))
+	router.GET("/admin/webhooks/deliveries", a.LogRequests(a.Authorize(models.ScopeAdmin, a.getWebhookDeliveries)))
+	router.DELETE("/admin/webhooks/{id}",
+		a.LogRequests(a.Audit(fasthttp.StatusOK, a.Authorize(models.ScopeAdmin, a.deleteWebhook))))
+	router.POST("/admin/webhooks/deliveries/{id}/replay",
+		a.LogRequests(a.Audit(fasthttp.StatusAccepted, a.Authorize(models.ScopeAdmin, a.replayWebhookDelivery))))
+	router.POST("/admin/keys",
+		a.LogRequests(a.Audit(fasthttp.StatusCreated, a.Authorize(models.ScopeAdmin, a.issueAPIKey))))
+	router.GET("/admin/keys", a.LogRequests(a.Authorize(models.ScopeAdmin, a.getAPIKeys)))
+	router.DELETE("/admin/keys/{id}",
+		a.LogRequests(a.Audit(fasthttp.StatusOK, a.Authorize(models.ScopeAdmin, a.revokeAPIKey))))
+	router.GET("/admin/audit", a.LogRequests(a.Authorize(models.ScopeAudit, a.getAudit)))
+	router.GET("/admin/audit/export", a.LogRequests(a.Authorize(models.ScopeAudit, a.exportAudit)))
+	router.GET("/admin/audit/verify", a.LogRequests(a.Authorize(models.ScopeAudit, a.verifyAudit)))
+	// the probes are not logged, they are called every few seconds
+	router.GET("/healthz", a.healthz)
+	router.GET("/readyz", a.readyz)
+	router.GET("/metrics", fasthttpadaptor.NewFastHTTPHandler(
+		promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
 	router.GET("/docs/{filepath:*}", fasthttpadaptor.NewFastHTTPHandlerFunc(httpSwagger.WrapHandler))
 	return router
 }
@@ -1,11 +1,16 @@
 package app
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
-// report storage object
+// report storage object, the reports older than the retention are removed (0 keeps them)
 type reportStore struct {
 	sync.RWMutex
-	reports map[string][]byte
+	reports   map[string][]byte
+	created   map[string]time.Time
+	retention time.Duration
 }
 
 // IsExist checks if the report is in the storage
@@ -13,5 +18,32 @@ func (s *reportStore) IsExist(key string) ([]byte, bool) {
 	s.RLock()
 	defer s.RUnlock()
 	data, ok := s.reports[key]
+	if ok && s.expired(key, time.Now()) {
+		return nil, false
+	}
 	return data, ok
 }
+
+// Put stores the report and removes the expired ones
+func (s *reportStore) Put(key string, data []byte) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for k := range s.reports {
+		if s.expired(k, now) {
+			delete(s.reports, k)
+			delete(s.created, k)
+		}
+	}
+	if s.created == nil {
+		s.created = make(map[string]time.Time)
+	}
+	s.reports[key] = data
+	s.created[key] = now
+}
+
+// expired checks if the report is older than the retention
+func (s *reportStore) expired(key string, now time.Time) bool {
+	created, ok := s.created[key]
+	return ok && s.retention > 0 && now.Sub(created) > s.retention
+}
@@ -0,0 +1,40 @@
+package broker
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"context"
+	"fmt"
+)
+
+// Consumer - interface describing the source of the commands. Consume passes the commands to handle
+// until the context is cancelled or the connection fails, a command is acknowledged when handle returns nil
+// and delivered again otherwise. Reply sends the result to the reply destination of the command or the
+// default one, DeadLetter moves the command that can't be executed to the dead-letter destination
+type Consumer interface {
+	Consume(ctx context.Context, handle func(ctx context.Context, cmd models.Command) error) error
+	Reply(ctx context.Context, cmd models.Command, reply models.CommandReply) error
+	DeadLetter(ctx context.Context, letter models.DeadLetter) error
+	Close() error
+}
+
+// Headers of the command messages, the payload is the body of the message
+const (
+	HeaderMessageID   = "message_id"
+	HeaderCommandType = "command_type"
+	HeaderReplyTo     = "reply_to"
+)
+
+// NewConsumer - creates the consumer configured by CommandConsumer, it is nil for none
+func NewConsumer(brokers configs.ConfigBroker, cfg configs.ConfigCommands) (Consumer, error) {
+	switch cfg.CommandConsumer {
+	case PublisherNone, "":
+		return nil, nil
+	case PublisherKafka:
+		return NewKafkaConsumer(brokers.KafkaBrokers, cfg), nil
+	case PublisherNats:
+		return NewNatsConsumer(brokers.NatsURL, cfg)
+	}
+	return nil, fmt.Errorf("unknown command consumer %q, expected one of: %s, %s, %s",
+		cfg.CommandConsumer, PublisherNone, PublisherKafka, PublisherNats)
+}
@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"avito/internal/models"
+	"context"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// KafkaPublisher - publisher of the events to the Kafka topic. The user id is the message key,
+// so the events of a user land in one partition in the order they were published
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher - constructor function for KafkaPublisher
+func NewKafkaPublisher(brokers []string, topic string, batch int) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchSize:    batch,
+			// the relay waits for every batch, so the writer must not wait for more messages
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+// Publish - writes the messages and waits for all in-sync replicas to acknowledge them
+func (k *KafkaPublisher) Publish(ctx context.Context, messages []models.OutboxMessage) error {
+	msgs := make([]kafka.Message, 0, len(messages))
+	for _, m := range messages {
+		msgs = append(msgs, kafka.Message{
+			Key:   []byte(m.Key),
+			Value: m.Payload,
+			Headers: []kafka.Header{
+				{Key: "event_id", Value: []byte(m.EventID)},
+				{Key: "event_type", Value: []byte(m.EventType)},
+			},
+			Time: m.CreatedAt,
+		})
+	}
+	return k.writer.WriteMessages(ctx, msgs...)
+}
+
+// Close - flushes and closes the writer
+func (k *KafkaPublisher) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,96 @@
+package broker
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"context"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaConsumer - consumer of the commands from the Kafka topic within the consumer group. The offset
+// is committed after the command is handled, so the commands are processed at least once
+type KafkaConsumer struct {
+	reader       *kafka.Reader
+	writer       *kafka.Writer
+	replyTopic   string
+	deadLetterTo string
+}
+
+// NewKafkaConsumer - constructor function for KafkaConsumer
+func NewKafkaConsumer(brokers []string, cfg configs.ConfigCommands) *KafkaConsumer {
+	return &KafkaConsumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			GroupID: cfg.CommandGroup,
+			Topic:   cfg.CommandTopic,
+		}),
+		// the topic is set for every message
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+		replyTopic:   cfg.ReplyTopic,
+		deadLetterTo: cfg.DeadLetterTopic,
+	}
+}
+
+// Consume - reads the commands one by one, a command that was not handled stops the consumer,
+// it is read again when the consumer restarts
+func (k *KafkaConsumer) Consume(ctx context.Context, handle func(ctx context.Context, cmd models.Command) error) error {
+	for {
+		m, err := k.reader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+		cmd := models.Command{Payload: m.Value}
+		for _, h := range m.Headers {
+			switch h.Key {
+			case HeaderMessageID:
+				cmd.ID = string(h.Value)
+			case HeaderCommandType:
+				cmd.Type = string(h.Value)
+			case HeaderReplyTo:
+				cmd.ReplyTo = string(h.Value)
+			}
+		}
+		if err = handle(ctx, cmd); err != nil {
+			return err
+		}
+		if err = k.reader.CommitMessages(ctx, m); err != nil {
+			return err
+		}
+	}
+}
+
+// Reply - writes the reply keyed by the command id
+func (k *KafkaConsumer) Reply(ctx context.Context, cmd models.Command, reply models.CommandReply) error {
+	topic := cmd.ReplyTo
+	if topic == "" {
+		topic = k.replyTopic
+	}
+	return k.write(ctx, topic, cmd.ID, reply)
+}
+
+// DeadLetter - writes the command with the reason to the dead-letter topic
+func (k *KafkaConsumer) DeadLetter(ctx context.Context, letter models.DeadLetter) error {
+	return k.write(ctx, k.deadLetterTo, letter.Command.ID, letter)
+}
+
+func (k *KafkaConsumer) write(ctx context.Context, topic, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return k.writer.WriteMessages(ctx, kafka.Message{Topic: topic, Key: []byte(key), Value: data})
+}
+
+// Close - closes the reader and the writer
+func (k *KafkaConsumer) Close() error {
+	if err := k.reader.Close(); err != nil {
+		k.writer.Close()
+		return err
+	}
+	return k.writer.Close()
+}
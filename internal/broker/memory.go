@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"avito/internal/models"
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// MemoryPublisher - publisher that keeps the events in memory, for the tests and the local runs
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []models.OutboxMessage
+}
+
+// NewMemoryPublisher - constructor function for MemoryPublisher
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{messages: make([]models.OutboxMessage, 0)}
+}
+
+// Publish - appends the messages
+func (m *MemoryPublisher) Publish(ctx context.Context, messages []models.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, messages...)
+	return nil
+}
+
+// Messages - returns the published messages in the order they were published
+func (m *MemoryPublisher) Messages() []models.OutboxMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.OutboxMessage(nil), m.messages...)
+}
+
+// Close - does nothing, the messages stay available
+func (m *MemoryPublisher) Close() error {
+	return nil
+}
+
+// FilePublisher - publisher that appends the events to the file as JSON lines
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher - constructor function for FilePublisher
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+// Publish - writes the messages and syncs the file, so the published events survive a crash
+func (f *FilePublisher) Publish(ctx context.Context, messages []models.OutboxMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := bufio.NewWriter(f.file)
+	encoder := json.NewEncoder(w)
+	for _, m := range messages {
+		if err := encoder.Encode(m); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Close - closes the file
+func (f *FilePublisher) Close() error {
+	return f.file.Close()
+}
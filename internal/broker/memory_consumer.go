@@ -0,0 +1,79 @@
+package broker
+
+import (
+	"avito/internal/models"
+	"context"
+	"sync"
+)
+
+// MemoryConsumer - consumer of the commands sent to it in memory, the stand-in for the brokers in the tests
+type MemoryConsumer struct {
+	commands    chan models.Command
+	mu          sync.Mutex
+	replies     []models.CommandReply
+	deadLetters []models.DeadLetter
+}
+
+// NewMemoryConsumer - constructor function for MemoryConsumer
+func NewMemoryConsumer() *MemoryConsumer {
+	return &MemoryConsumer{
+		commands:    make(chan models.Command, 64),
+		replies:     make([]models.CommandReply, 0),
+		deadLetters: make([]models.DeadLetter, 0),
+	}
+}
+
+// Send - queues the command
+func (m *MemoryConsumer) Send(cmd models.Command) {
+	m.commands <- cmd
+}
+
+// Consume - passes the queued commands to handle, a command that was not handled is queued again
+func (m *MemoryConsumer) Consume(ctx context.Context, handle func(ctx context.Context, cmd models.Command) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case cmd := <-m.commands:
+			if err := handle(ctx, cmd); err != nil {
+				go m.Send(cmd)
+				return err
+			}
+		}
+	}
+}
+
+// Reply - keeps the reply
+func (m *MemoryConsumer) Reply(ctx context.Context, cmd models.Command, reply models.CommandReply) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, reply)
+	return nil
+}
+
+// DeadLetter - keeps the dead letter
+func (m *MemoryConsumer) DeadLetter(ctx context.Context, letter models.DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadLetters = append(m.deadLetters, letter)
+	return nil
+}
+
+// Replies - returns the sent replies
+func (m *MemoryConsumer) Replies() []models.CommandReply {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.CommandReply(nil), m.replies...)
+}
+
+// DeadLetters - returns the dead-lettered commands
+func (m *MemoryConsumer) DeadLetters() []models.DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.DeadLetter(nil), m.deadLetters...)
+}
+
+// Close - does nothing, the replies and the dead letters stay available
+func (m *MemoryConsumer) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"avito/internal/models"
+	"context"
+	"github.com/nats-io/nats.go"
+)
+
+// NatsPublisher - publisher of the events to NATS JetStream. Every event goes to the subject
+// <prefix>.<event type>, the event id is the message id, so JetStream drops the republished events
+// within its duplicate window
+type NatsPublisher struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+// NewNatsPublisher - constructor function for NatsPublisher
+func NewNatsPublisher(url, subject string) (*NatsPublisher, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NatsPublisher{conn: conn, js: js, subject: subject}, nil
+}
+
+// Publish - publishes the messages one by one and waits for the acknowledgement of each of them,
+// which keeps their order in the stream
+func (n *NatsPublisher) Publish(ctx context.Context, messages []models.OutboxMessage) error {
+	for _, m := range messages {
+		msg := nats.NewMsg(n.subject + "." + m.EventType)
+		msg.Data = m.Payload
+		msg.Header.Set(nats.MsgIdHdr, m.EventID)
+		msg.Header.Set("Event-Type", m.EventType)
+		msg.Header.Set("Key", m.Key)
+		if _, err := n.js.PublishMsg(msg, nats.Context(ctx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close - drains and closes the connection
+func (n *NatsPublisher) Close() error {
+	return n.conn.Drain()
+}
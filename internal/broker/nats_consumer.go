@@ -0,0 +1,110 @@
+package broker
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go"
+)
+
+// NatsConsumer - consumer of the commands from the durable JetStream pull subscription. A command
+// is acknowledged after it is handled and delivered again when the acknowledgement does not come
+type NatsConsumer struct {
+	conn         *nats.Conn
+	js           nats.JetStreamContext
+	subject      string
+	durable      string
+	replyTo      string
+	deadLetterTo string
+}
+
+// NewNatsConsumer - constructor function for NatsConsumer
+func NewNatsConsumer(url string, cfg configs.ConfigCommands) (*NatsConsumer, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NatsConsumer{
+		conn:         conn,
+		js:           js,
+		subject:      cfg.CommandTopic,
+		durable:      cfg.CommandGroup,
+		replyTo:      cfg.ReplyTopic,
+		deadLetterTo: cfg.DeadLetterTopic,
+	}, nil
+}
+
+// Consume - fetches the commands one by one, a command that was not handled is delivered again at once
+func (n *NatsConsumer) Consume(ctx context.Context, handle func(ctx context.Context, cmd models.Command) error) error {
+	sub, err := n.js.PullSubscribe(n.subject, n.durable, nats.ManualAck())
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	for {
+		msgs, err := sub.Fetch(1, nats.Context(ctx))
+		// an empty fetch ends with the timeout of the JetStream context
+		if ctx.Err() == nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout)) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			cmd := models.Command{
+				ID:      m.Header.Get(nats.MsgIdHdr),
+				Type:    m.Header.Get(HeaderCommandType),
+				ReplyTo: m.Header.Get(HeaderReplyTo),
+				Payload: m.Data,
+			}
+			if cmd.ID == "" {
+				cmd.ID = m.Header.Get(HeaderMessageID)
+			}
+			if err = handle(ctx, cmd); err != nil {
+				m.Nak()
+				return err
+			}
+			if err = m.AckSync(nats.Context(ctx)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Reply - publishes the reply to the reply subject of the command or the default one
+func (n *NatsConsumer) Reply(ctx context.Context, cmd models.Command, reply models.CommandReply) error {
+	subject := cmd.ReplyTo
+	if subject == "" {
+		subject = n.replyTo
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	if err = n.conn.Publish(subject, data); err != nil {
+		return err
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
+// DeadLetter - publishes the command with the reason to the dead-letter subject of the stream
+func (n *NatsConsumer) DeadLetter(ctx context.Context, letter models.DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	_, err = n.js.Publish(n.deadLetterTo, data, nats.Context(ctx))
+	return err
+}
+
+// Close - drains and closes the connection
+func (n *NatsConsumer) Close() error {
+	return n.conn.Drain()
+}
@@ -0,0 +1,44 @@
+// Package broker contains the publishers through which the domain events of the outbox reach
+// the message brokers
+package broker
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"context"
+	"fmt"
+)
+
+// Kinds of the publishers
+const (
+	PublisherNone   = "none"
+	PublisherKafka  = "kafka"
+	PublisherNats   = "nats"
+	PublisherFile   = "file"
+	PublisherMemory = "memory"
+)
+
+// Publisher - interface describing the publisher of the domain events. Publish returns when the broker
+// has accepted all messages, the messages of one key must be delivered in the order of the slice
+type Publisher interface {
+	Publish(ctx context.Context, messages []models.OutboxMessage) error
+	Close() error
+}
+
+// NewPublisher - creates the publisher configured by OutboxPublisher, it is nil for none
+func NewPublisher(brokers configs.ConfigBroker, cfg configs.ConfigOutbox) (Publisher, error) {
+	switch cfg.OutboxPublisher {
+	case PublisherNone, "":
+		return nil, nil
+	case PublisherKafka:
+		return NewKafkaPublisher(brokers.KafkaBrokers, cfg.KafkaTopic, cfg.OutboxBatch), nil
+	case PublisherNats:
+		return NewNatsPublisher(brokers.NatsURL, cfg.NatsSubject)
+	case PublisherFile:
+		return NewFilePublisher(cfg.OutboxFile)
+	case PublisherMemory:
+		return NewMemoryPublisher(), nil
+	}
+	return nil, fmt.Errorf("unknown outbox publisher %q, expected one of: %s, %s, %s, %s, %s",
+		cfg.OutboxPublisher, PublisherNone, PublisherKafka, PublisherNats, PublisherFile, PublisherMemory)
+}
@@ -0,0 +1,164 @@
+// Package metrics contains the Prometheus metrics of the application: the HTTP requests, the connection pool
+// of the database and the money operations
+package metrics
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"strconv"
+	"time"
+)
+
+const namespace = "avito"
+
+// Registry - registry of all metrics of the application, exposed by /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of the HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the HTTP requests by route, method and status code.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"route", "method", "status"})
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Number of the successful money operations by operation.",
+	}, []string{"operation"})
+	operationAmounts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operation_amount_total",
+		Help:      "Amount of the successful money operations by operation.",
+	}, []string{"operation"})
+	operationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operation_failures_total",
+		Help:      "Number of the failed money operations by operation and status code.",
+	}, []string{"operation", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		operations,
+		operationAmounts,
+		operationFailures,
+	)
+}
+
+// ObserveRequest - counts the HTTP request and its duration, route is the pattern of the matched route
+func ObserveRequest(route, method string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// ObserveOperation - counts the money operation by the status code it finished with. The amount of
+// a successful operation is added to its total, a negative amount is added as the absolute value
+func ObserveOperation(operation string, amount float64, code int) {
+	if code >= 300 {
+		operationFailures.WithLabelValues(operation, strconv.Itoa(code)).Inc()
+		return
+	}
+	if amount < 0 {
+		amount = -amount
+	}
+	operations.WithLabelValues(operation).Inc()
+	operationAmounts.WithLabelValues(operation).Add(amount)
+}
+
+// RegisterPool - exposes the statistics of the connection pool of the database
+func RegisterPool(pool *pgxpool.Pool) error {
+	return Registry.Register(&poolCollector{pool: pool})
+}
+
+// RegisterReservations - exposes the number and the total amount of the open reservations,
+// they are read by the function on each scrape
+func RegisterReservations(read func() (count int64, amount float64, err error)) error {
+	return Registry.Register(&reservationsCollector{read: read})
+}
+
+var (
+	poolAcquired = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "acquired_conns"),
+		"Number of the connections currently acquired from the pool.", nil, nil)
+	poolIdle = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "idle_conns"),
+		"Number of the idle connections in the pool.", nil, nil)
+	poolTotal = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "total_conns"),
+		"Total number of the connections in the pool.", nil, nil)
+	poolMax = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "max_conns"),
+		"Maximum size of the pool.", nil, nil)
+	poolAcquires = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "acquires_total"),
+		"Number of the successful acquires of a connection from the pool.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "empty_acquires_total"),
+		"Number of the acquires that waited for a connection because the pool was empty.", nil, nil)
+	poolCanceledAcquires = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "canceled_acquires_total"),
+		"Number of the acquires cancelled by the context.", nil, nil)
+	poolAcquireDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "acquire_duration_seconds_total"),
+		"Total time spent acquiring the connections.", nil, nil)
+	reservationsCount = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "open_reservations"),
+		"Number of the reserved orders that are not charged or cancelled.", nil, nil)
+	reservationsAmount = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "open_reservations_amount"),
+		"Total amount of the open reservations.", nil, nil)
+)
+
+// poolCollector - collector of the statistics of the connection pool
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquired
+	ch <- poolIdle
+	ch <- poolTotal
+	ch <- poolMax
+	ch <- poolAcquires
+	ch <- poolEmptyAcquires
+	ch <- poolCanceledAcquires
+	ch <- poolAcquireDuration
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotal, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMax, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue,
+		float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquires, prometheus.CounterValue,
+		float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDuration, prometheus.CounterValue,
+		stat.AcquireDuration().Seconds())
+}
+
+// reservationsCollector - collector of the open reservations
+type reservationsCollector struct {
+	read func() (count int64, amount float64, err error)
+}
+
+func (c *reservationsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- reservationsCount
+	ch <- reservationsAmount
+}
+
+func (c *reservationsCollector) Collect(ch chan<- prometheus.Metric) {
+	count, amount, err := c.read()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(reservationsCount, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(reservationsCount, prometheus.GaugeValue, float64(count))
+	ch <- prometheus.MustNewConstMetric(reservationsAmount, prometheus.GaugeValue, amount)
+}
@@ -1,13 +1,21 @@
 // Package models contains all the necessary objects for transferring data and interacting with the application
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
 
-// AccrualFunds - structure for a request to credit funds to a user's balance
+// AccrualFunds - structure for a request to credit funds to a user's balance.
+// A refund returns funds charged for the order and must refer to it
 type AccrualFunds struct {
-	UserID  int     `json:"user_id" validate:"gte=1"`
-	Amount  float64 `json:"amount" validate:"gt=0"`
-	Message string
+	UserID            int     `json:"user_id" validate:"gte=1"`
+	Amount            float64 `json:"amount" validate:"gt=0"`
+	Operation         string  `json:"operation" validate:"omitempty,oneof=accrual refund"`
+	OrderID           int     `json:"order_id" validate:"required_if=Operation refund,gte=0"`
+	Comment           string  `json:"comment" validate:"max=255"`
+	ExternalReference string  `json:"external_reference" validate:"max=255"`
 }
 
 // UserBalance - structure to get the user's balance
@@ -16,12 +24,28 @@ type UserBalance struct {
 	Balance float64 `json:"balance"`
 }
 
-// Transaction - structure for transaction
+// Adjustment - manual correction of the user's balance by the operator, a negative amount debits the balance.
+// The comment is the reason of the correction
+type Adjustment struct {
+	UserID  int     `json:"user_id" validate:"gte=1"`
+	Amount  float64 `json:"amount" validate:"ne=0"`
+	Comment string  `json:"comment" validate:"required,max=255"`
+}
+
+// Transaction - structure for transaction, zero identifiers and empty reference mean that there is no link
 type Transaction struct {
-	UserID  int       `json:"user_id"`
-	Amount  float64   `json:"amount"`
-	Date    time.Time `json:"date"`
-	Message string    `json:"message"`
+	UserID            int       `json:"user_id"`
+	Amount            float64   `json:"amount"`
+	Date              time.Time `json:"date"`
+	Message           string    `json:"message"`
+	Operation         string    `json:"operation"`
+	OrderID           int       `json:"order_id"`
+	ServiceID         int       `json:"service_id"`
+	CounterpartyID    int       `json:"counterparty_user_id"`
+	ExternalReference string    `json:"external_reference"`
+	ParentID          int       `json:"parent_transaction_id"`
+	// MessageCode is empty when the message is a comment supplied by the caller
+	MessageCode string `json:"message_code"`
 }
 
 // Order - an object for reserving funds when creating an order and debiting these funds
@@ -32,13 +56,19 @@ type Order struct {
 	Amount    float64   `json:"amount" validate:"gt=0"`
 	Date      time.Time `json:"date"`
 	Block     bool
+	// Comment and ExternalReference are stored in the reservation transaction
+	Comment           string `json:"comment" validate:"max=255"`
+	ExternalReference string `json:"external_reference" validate:"max=255"`
 }
 
 // Report - object for working with a report for accounting
 type Report struct {
 	Year  int `json:"year" validate:"required,gte=2007"`
 	Month int `json:"month" validate:"required,min=1,max=12"`
-	Data  map[int]float64
+	// From and To - boundaries of the reporting period [From, To) in the accounting time zone
+	From time.Time `json:"-"`
+	To   time.Time `json:"-"`
+	Data map[int]float64
 }
 
 // Transfer - object for working with the transfer of funds between two users
@@ -46,28 +76,572 @@ type Transfer struct {
 	SenderID   int     `json:"sender_id" validate:"gte=1"`
 	ReceiverID int     `json:"receiver_id" validate:"gte=1"`
 	Amount     float64 `json:"amount" validate:"gt=0"`
+	Comment    string  `json:"comment" validate:"max=255"`
 }
 
 // TransactionList - object for working with the list of user transactions
 type TransactionList struct {
-	TransactionID int       `json:"transaction_id"`
-	UserID        int       `json:"user_id"`
-	Amount        float64   `json:"amount"`
-	Date          time.Time `json:"date"`
-	Message       string    `json:"message"`
+	TransactionID     int       `json:"transaction_id"`
+	UserID            int       `json:"user_id"`
+	Amount            float64   `json:"amount"`
+	Date              time.Time `json:"date"`
+	Message           string    `json:"message"`
+	Operation         string    `json:"operation"`
+	OrderID           *int      `json:"order_id,omitempty"`
+	ServiceID         *int      `json:"service_id,omitempty"`
+	CounterpartyID    *int      `json:"counterparty_user_id,omitempty"`
+	ExternalReference *string   `json:"external_reference,omitempty"`
+	ParentID          *int      `json:"parent_transaction_id,omitempty"`
+	// Description is rendered from the message template in the requested language
+	Description   string            `json:"description,omitempty"`
+	MessageCode   *string           `json:"message_code,omitempty"`
+	MessageParams map[string]string `json:"message_params,omitempty"`
 }
 
-// TransactionListRequest - structure for requesting a list of user transactions
+// TransactionListRequest - structure for requesting a list of user transactions.
+// The sort is set either by the sort keys or by the legacy order_by string.
+// Cursor is the opaque position returned as next_cursor of the previous page
 type TransactionListRequest struct {
-	UserID  int    `json:"user_id" validate:"gte=1"`
-	OrderBy string `json:"order_by"`
-	Limit   int    `json:"limit" validate:"gte=0"`
-	Offset  int    `json:"offset" validate:"gte=0"`
+	UserID      int         `json:"user_id" validate:"gte=1"`
+	OrderBy     string      `json:"order_by"`
+	Sort        []SortKey   `json:"sort" validate:"max=2,unique=Field,dive"`
+	Limit       int         `json:"limit" validate:"gte=0"`
+	Offset      int         `json:"offset" validate:"gte=0"`
+	Cursor      string      `json:"cursor"`
+	WithTotal   bool        `json:"with_total"`
+	WithSummary bool        `json:"with_summary"`
+	After       *PageCursor `json:"-"`
+	Language    string      `json:"-"`
+	TransactionFilter
+}
+
+// TransactionFilter - filters of the transaction history. The amount range is applied to the absolute
+// value of the amount, the direction selects incoming or outgoing transactions
+type TransactionFilter struct {
+	DateFrom       *time.Time `json:"date_from"`
+	DateTo         *time.Time `json:"date_to"`
+	AmountMin      *float64   `json:"amount_min" validate:"omitempty,gte=0"`
+	AmountMax      *float64   `json:"amount_max" validate:"omitempty,gte=0"`
+	Direction      string     `json:"direction" validate:"omitempty,oneof=in out"`
+	Operation      string     `json:"operation" validate:"omitempty,operation" enums:"accrual,reservation,charge,cancellation,transfer_in,transfer_out,refund,adjustment"`
+	OrderID        int        `json:"order_id" validate:"gte=0"`
+	CounterpartyID int        `json:"counterparty_user_id" validate:"gte=0"`
+}
+
+// SortKey - whitelisted column of the transaction history sort and its direction
+type SortKey struct {
+	Field     string `json:"field" validate:"oneof=amount date_time"`
+	Direction string `json:"direction" validate:"omitempty,oneof=asc desc"`
+}
+
+// PageCursor - decoded position of the keyset pagination: values of the sort keys
+// and the id of the last transaction of the page
+type PageCursor struct {
+	Sort          string   `json:"s"`
+	Values        []string `json:"v"`
+	TransactionID int      `json:"id"`
+}
+
+// TransactionPage - page of the user transaction history
+type TransactionPage struct {
+	Transactions []TransactionList   `json:"transactions"`
+	NextCursor   string              `json:"next_cursor,omitempty"`
+	Total        *int                `json:"total,omitempty"`
+	Summary      *TransactionSummary `json:"summary,omitempty"`
+}
+
+// TransactionSummary - aggregates of all transactions matching the filter of the history page,
+// outgoing is a positive sum of the debits
+type TransactionSummary struct {
+	Count    int     `json:"count"`
+	Incoming float64 `json:"incoming"`
+	Outgoing float64 `json:"outgoing"`
+	Net      float64 `json:"net"`
+}
+
+// TransactionDetailRequest - structure for requesting a single transaction, a non-zero UserID
+// restricts the search to the transactions of this user
+type TransactionDetailRequest struct {
+	TransactionID int
+	UserID        int
+	Language      string
+}
+
+// TransactionDetail - transaction with the linked order, the mirror transaction on the other side
+// of a transfer and the later reversals of it
+type TransactionDetail struct {
+	Transaction TransactionList   `json:"transaction"`
+	Order       *OrderDetail      `json:"order,omitempty"`
+	Mirror      *TransactionList  `json:"mirror,omitempty"`
+	Reversals   []TransactionList `json:"reversals"`
+}
+
+// OrderDetail - order with its current status and service
+type OrderDetail struct {
+	OrderID     int       `json:"order_id"`
+	UserID      int       `json:"user_id"`
+	ServiceID   int       `json:"service_id"`
+	ServiceName string    `json:"service_name,omitempty"`
+	Amount      float64   `json:"amount"`
+	Refunded    float64   `json:"refunded"`
+	Date        time.Time `json:"date"`
+	Status      string    `json:"status"`
+}
+
+// Statuses of the orders
+const (
+	OrderReserved  = "reserved"
+	OrderCharged   = "charged"
+	OrderCancelled = "cancelled"
+)
+
+// StreamRequest - structure for subscribing to the balance changes and new transactions of the user,
+// LastEventID is the id of the last transaction received before the reconnect
+type StreamRequest struct {
+	UserID      int
+	LastEventID int
+	Language    string
+}
+
+// TransactionEvent - new transaction of the user with the balance after it
+type TransactionEvent struct {
+	TransactionList
+	Balance float64 `json:"balance"`
+}
+
+// StreamEvent - event of the subscription, transaction events carry the transaction id as ID
+type StreamEvent struct {
+	ID   string
+	Type string
+	Data interface{}
+}
+
+// Types of the subscription events
+const (
+	EventTransaction = "transaction"
+	EventBalance     = "balance"
+)
+
+// Languages of the transaction descriptions
+const (
+	LanguageRu = "ru"
+	LanguageEn = "en"
+)
+
+// Sort keys and directions of the transaction history
+const (
+	SortAmount = "amount"
+	SortDate   = "date_time"
+	SortAsc    = "asc"
+	SortDesc   = "desc"
+)
+
+// Directions of the transaction history filter
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Operations of the transactions
+const (
+	OperationAccrual      = "accrual"
+	OperationReservation  = "reservation"
+	OperationCharge       = "charge"
+	OperationCancellation = "cancellation"
+	OperationTransferIn   = "transfer_in"
+	OperationTransferOut  = "transfer_out"
+	OperationRefund       = "refund"
+	OperationAdjustment   = "adjustment"
+)
+
+// Operations - all operations of the transactions, the filter of the history accepts them
+var Operations = []string{OperationAccrual, OperationReservation, OperationCharge, OperationCancellation,
+	OperationTransferIn, OperationTransferOut, OperationRefund, OperationAdjustment}
+
+// ValidationAliases - tags of the validation rules built from the lists of the models
+var ValidationAliases = map[string]string{
+	"operation": "oneof=" + strings.Join(Operations, " "),
 }
 
 // Unblock - structure for unlocking funds
 type Unblock struct {
-	OrderID int     `json:"order_id" validate:"gte=1"`
-	UserID  int     `json:"user_id"`
-	Amount  float64 `json:"amount"`
+	OrderID   int     `json:"order_id" validate:"gte=1"`
+	UserID    int     `json:"user_id" validate:"gte=0"`
+	Amount    float64 `json:"amount"`
+	ServiceID int     `json:"-"`
+	Comment   string  `json:"comment" validate:"max=255"`
+}
+
+// ReconciliationRequest - structure for requesting a reconciliation of the books,
+// if the year and month are not set, the revenue is checked for the whole time
+type ReconciliationRequest struct {
+	Year  int       `json:"year" validate:"omitempty,gte=2007"`
+	Month int       `json:"month" validate:"omitempty,min=1,max=12"`
+	From  time.Time `json:"-"`
+	To    time.Time `json:"-"`
+}
+
+// BalanceDiscrepancy - user whose funds, the balance and the amount reserved for the open orders,
+// do not match the sum of his settled transactions
+type BalanceDiscrepancy struct {
+	UserID     int     `json:"user_id"`
+	Balance    float64 `json:"balance"`
+	Reserved   float64 `json:"reserved"`
+	Ledger     float64 `json:"ledger"`
+	Difference float64 `json:"difference"`
+}
+
+// OrdersTotals - comparison of the funds debited for services according to the history
+// with the amount of reserved and charged orders
+type OrdersTotals struct {
+	Debited    float64 `json:"debited"`
+	Ordered    float64 `json:"ordered"`
+	Difference float64 `json:"difference"`
+}
+
+// RevenueDiscrepancy - service whose amount of charged orders does not match the charges in the history
+type RevenueDiscrepancy struct {
+	ServiceID  int     `json:"service_id"`
+	Charged    float64 `json:"charged"`
+	Ledger     float64 `json:"ledger"`
+	Difference float64 `json:"difference"`
+}
+
+// Reconciliation - discrepancy report of the books
+type Reconciliation struct {
+	Balanced bool                 `json:"balanced"`
+	From     time.Time            `json:"from"`
+	To       time.Time            `json:"to"`
+	Balances []BalanceDiscrepancy `json:"balances"`
+	Orders   OrdersTotals         `json:"orders"`
+	Revenue  []RevenueDiscrepancy `json:"revenue"`
+}
+
+// Books - figures of the books for the reconciliation read from one snapshot of the database: the users
+// whose funds don't match the history, the totals of the orders and the revenue of the period by service
+// according to the orders and to the history
+type Books struct {
+	Balances       []BalanceDiscrepancy
+	Orders         OrdersTotals
+	ChargedRevenue map[int]float64
+	LedgerRevenue  map[int]float64
+}
+
+// ServiceInfo - service catalog entry, the accounts are used for the journal entries of charges
+type ServiceInfo struct {
+	ServiceID     int    `json:"service_id" validate:"gte=1"`
+	Name          string `json:"name" validate:"required,max=255"`
+	DebitAccount  string `json:"debit_account" validate:"max=32"`
+	CreditAccount string `json:"credit_account" validate:"max=32"`
+}
+
+// JournalRequest - structure for requesting the export of journal entries for the month
+type JournalRequest struct {
+	Year   int       `json:"year" validate:"required,gte=2007"`
+	Month  int       `json:"month" validate:"required,min=1,max=12"`
+	Format string    `json:"format" validate:"omitempty,oneof=csv jsonl"`
+	From   time.Time `json:"-"`
+	To     time.Time `json:"-"`
+}
+
+// Movement - money movement recorded in the database from which a journal entry is made
+type Movement struct {
+	Operation      string
+	SourceID       int
+	Date           time.Time
+	UserID         int
+	CounterpartyID int
+	ServiceID      int
+	OrderID        int
+	Amount         float64
+}
+
+// JournalEntry - double-entry record for the general ledger system
+type JournalEntry struct {
+	EntryID        string    `json:"entry_id"`
+	Date           time.Time `json:"date"`
+	Operation      string    `json:"operation"`
+	DebitAccount   string    `json:"debit_account"`
+	CreditAccount  string    `json:"credit_account"`
+	Amount         float64   `json:"amount"`
+	UserID         int       `json:"user_id"`
+	CounterpartyID int       `json:"counterparty_user_id,omitempty"`
+	ServiceID      int       `json:"service_id,omitempty"`
+	OrderID        int       `json:"order_id,omitempty"`
+	Description    string    `json:"description"`
+}
+
+// Operations of the journal entries
+const (
+	JournalAccrual      = "accrual"
+	JournalReservation  = "reservation"
+	JournalCancellation = "cancellation"
+	JournalCharge       = "charge"
+	JournalRefund       = "refund"
+	JournalTransfer     = "transfer"
+	JournalAdjustment   = "adjustment"
+)
+
+// ExportRequest - structure for requesting a bulk export of the table.
+// The period [DateFrom, DateTo) accepts RFC 3339 timestamps or dates in the accounting time zone
+type ExportRequest struct {
+	Table    string    `json:"table" validate:"oneof=transactions orders"`
+	Format   string    `json:"format" validate:"omitempty,oneof=csv ndjson parquet"`
+	UserID   int       `json:"user_id" validate:"gte=0"`
+	DateFrom string    `json:"from"`
+	DateTo   string    `json:"to"`
+	From     time.Time `json:"-"`
+	To       time.Time `json:"-"`
+}
+
+// Event - domain event about a money movement, it is delivered to the webhook subscribers
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Types of the domain events
+const (
+	EventFundsAccrued      = "funds.accrued"
+	EventFundsRefunded     = "funds.refunded"
+	EventOrderReserved     = "order.reserved"
+	EventOrderCharged      = "order.charged"
+	EventOrderCancelled    = "order.cancelled"
+	EventTransferCompleted = "transfer.completed"
+	EventBalanceAdjusted   = "balance.adjusted"
+)
+
+// FundsEventData - data of the funds.accrued, funds.refunded and balance.adjusted events
+type FundsEventData struct {
+	TransactionID     int     `json:"transaction_id"`
+	UserID            int     `json:"user_id"`
+	Amount            float64 `json:"amount"`
+	OrderID           int     `json:"order_id,omitempty"`
+	ExternalReference string  `json:"external_reference,omitempty"`
+}
+
+// OrderEventData - data of the order events
+type OrderEventData struct {
+	TransactionID int     `json:"transaction_id"`
+	OrderID       int     `json:"order_id"`
+	UserID        int     `json:"user_id"`
+	ServiceID     int     `json:"service_id"`
+	Amount        float64 `json:"amount"`
+}
+
+// TransferEventData - data of the transfer.completed event, the transaction is the debit of the sender
+type TransferEventData struct {
+	TransactionID int     `json:"transaction_id"`
+	SenderID      int     `json:"sender_id"`
+	ReceiverID    int     `json:"receiver_id"`
+	Amount        float64 `json:"amount"`
+}
+
+// WebhookSubscription - endpoint that receives the events of the given types. The secret signs the payloads,
+// it is generated when not supplied and returned only when the subscription is created
+type WebhookSubscription struct {
+	SubscriptionID int       `json:"subscription_id"`
+	URL            string    `json:"url" validate:"required,url,max=2048"`
+	EventTypes     []string  `json:"event_types" validate:"required,min=1,unique,dive,oneof=funds.accrued funds.refunded order.reserved order.charged order.cancelled transfer.completed balance.adjusted"`
+	Secret         string    `json:"secret,omitempty" validate:"omitempty,min=16,max=255"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// WebhookDelivery - delivery of the event to the subscriber and the result of the last attempt
+type WebhookDelivery struct {
+	DeliveryID     int64           `json:"delivery_id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	URL            string          `json:"-"`
+	Secret         string          `json:"-"`
+}
+
+// WebhookDeliveryFilter - filter of the delivery list, zero values mean no filter
+type WebhookDeliveryFilter struct {
+	SubscriptionID int
+	Status         string
+	Limit          int
+}
+
+// DeliveryAttempt - result of an attempt to deliver the event. Status is pending when the delivery is retried
+// at NextAttemptAt
+type DeliveryAttempt struct {
+	DeliveryID    int64
+	Status        string
+	StatusCode    int
+	Error         string
+	NextAttemptAt time.Time
+}
+
+// Statuses of the webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// OutboxMessage - domain event in the outbox, Key is the id of the user the event belongs to. The events
+// of a user are published in the order of their ids
+type OutboxMessage struct {
+	OutboxID  int64           `json:"-"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Key       string          `json:"key"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Command - command received from the message broker, ID is the message id by which the repeated
+// deliveries are recognized. Payload is the body of the corresponding HTTP request
+type Command struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	ReplyTo string          `json:"reply_to,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Types of the commands
+const (
+	CommandAccrual = "accrual"
+	CommandReserve = "reserve"
+	CommandCharge  = "charge"
+	CommandCancel  = "cancel"
+)
+
+// CommandReply - result of the command sent to its reply destination, Duplicate is set when the command
+// has already been executed and the stored result is sent again
+type CommandReply struct {
+	CommandID   string `json:"command_id"`
+	Type        string `json:"type"`
+	Success     bool   `json:"success"`
+	StatusCode  int    `json:"status_code"`
+	Description string `json:"description"`
+	Duplicate   bool   `json:"duplicate,omitempty"`
+}
+
+// DeadLetter - command that can't be executed with the reason
+type DeadLetter struct {
+	Command Command `json:"command"`
+	Reason  string  `json:"reason"`
+}
+
+// CommandResult - processing of the command by its message id, StatusCode is nil while the command
+// is being executed
+type CommandResult struct {
+	MessageID   string
+	CommandType string
+	StatusCode  *int
+	Description string
+	ClaimedAt   time.Time
+}
+
+// Migration - version of the database schema, AppliedAt is nil while the migration is pending
+type Migration struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// HealthCheck - result of the check of a dependency of the service
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness - readiness of the service to take the traffic with the results of the checks
+type Readiness struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Scopes of the API keys, the admin scope grants all of them
+const (
+	ScopeAccrual  = "funds:accrue"
+	ScopeTransfer = "funds:transfer"
+	ScopeOrders   = "orders:write"
+	ScopeBalances = "balances:read"
+	ScopeReports  = "reports:read"
+	ScopeAudit    = "audit:read"
+	ScopeAdmin    = "admin"
+)
+
+// APIKey - key of the client service with its scopes. The key is returned only when it is issued, its SHA-256
+// hash is stored, the prefix identifies the key in the list. The key issued for a user has UserID,
+// the user-facing calls with it are limited to this user
+type APIKey struct {
+	KeyID     int        `json:"key_id"`
+	Client    string     `json:"client" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,unique,dive,oneof=funds:accrue funds:transfer orders:write balances:read reports:read audit:read admin"`
+	UserID    *int       `json:"user_id,omitempty" validate:"omitempty,gte=1"`
+	Prefix    string     `json:"prefix"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Outcomes of the audited calls
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEntry - entry of the append-only audit log of the mutating call. Balances are the balances of the users
+// of the successful call read right after it. Hash is the SHA-256 of the previous hash and the entry, so a changed
+// or removed entry breaks the chain. The entry is chained after it is appended, ChainSeq is its position
+// in the chain, the entry that is not chained yet has no position and no hashes
+type AuditEntry struct {
+	AuditID    int64              `json:"audit_id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Client     string             `json:"client"`
+	KeyID      int                `json:"key_id,omitempty"`
+	Method     string             `json:"method"`
+	Endpoint   string             `json:"endpoint"`
+	RequestID  string             `json:"request_id"`
+	SourceIP   string             `json:"source_ip"`
+	Payload    json.RawMessage    `json:"payload" swaggertype:"object"`
+	StatusCode int                `json:"status_code"`
+	Outcome    string             `json:"outcome"`
+	Message    string             `json:"message"`
+	Balances   map[string]float64 `json:"balances,omitempty"`
+	ChainSeq   int64              `json:"chain_seq,omitempty"`
+	PrevHash   string             `json:"prev_hash,omitempty"`
+	Hash       string             `json:"hash,omitempty"`
+}
+
+// AuditFilter - filter of the audit log, zero values mean no filter. UserID matches the user, the sender
+// and the receiver of the payload, the entries are returned after AfterID in the order of the log. Chained returns
+// only the chained entries after AfterSeq in the order of the chain
+type AuditFilter struct {
+	Client   string
+	UserID   int
+	Endpoint string
+	DateFrom string
+	DateTo   string
+	From     time.Time
+	To       time.Time
+	AfterID  int64
+	Chained  bool
+	AfterSeq int64
+	Limit    int
+}
+
+// AuditVerification - result of the check of the hash chain of the audit log, BrokenAt is the first entry
+// that doesn't match the chain
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
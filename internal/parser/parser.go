@@ -2,34 +2,307 @@
 package parser
 
 import (
+	"avito/internal/models"
+	"avito/internal/tracing"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"mime"
+	"reflect"
+	"strings"
 )
 
+// FieldError - invalid field of the request: the path of the field by its JSON names, the violated rule
+// and the message for the caller
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error - error of the request body with the status code of the response. Fields lists the invalid fields,
+// so the callers can fix the requests programmatically
+type Error struct {
+	Code    int
+	Message string
+	Fields  []FieldError
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Field+" "+f.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Message, strings.Join(messages, "; "))
+}
+
 // Parser - structure for working with data parsing and validation
 type Parser struct {
-	validator *validator.Validate
+	validator   *validator.Validate
+	maxBodySize int
 }
 
-// NewParser - constructor function for Parser
-func NewParser() *Parser {
+// NewParser - constructor function for Parser, the request bodies larger than maxBodySize bytes are rejected,
+// 0 means no limit
+func NewParser(maxBodySize int) *Parser {
+	v := validator.New()
+	// the fields are reported by the names the caller sends
+	v.RegisterTagNameFunc(jsonName)
+	for alias, tags := range models.ValidationAliases {
+		v.RegisterAlias(alias, tags)
+	}
 	return &Parser{
-		validator: validator.New(),
+		validator:   v,
+		maxBodySize: maxBodySize,
 	}
 }
 
 // UnmarshalBody -  function converts the data from the request body to json format
-// and, if necessary, validates the received data
-func (p *Parser) UnmarshalBody(ctx *fasthttp.RequestCtx, data interface{}, validate bool) error {
-	if err := json.Unmarshal(ctx.Request.Body(), &data); err != nil {
-		return err
+// and, if necessary, validates the received data. The body must be a JSON object of the limited size
+// with the known fields only, the request without the Content-Type header is treated as JSON
+func (p *Parser) UnmarshalBody(ctx *fasthttp.RequestCtx, data interface{}, validate bool) (err error) {
+	body := ctx.Request.Body()
+	_, span := tracing.Start(tracing.FromRequest(ctx), "Parser.UnmarshalBody",
+		attribute.Int("avito.body_size", len(body)))
+	defer func() {
+		// the invalid body is the error of the client, the span is not marked as failed
+		code := 0
+		var parseErr *Error
+		if errors.As(err, &parseErr) {
+			code = parseErr.Code
+		}
+		tracing.End(span, code, err)
+	}()
+	if contentType := ctx.Request.Header.ContentType(); len(contentType) != 0 && !isJSON(string(contentType)) {
+		return &Error{Code: fasthttp.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("unsupported content type %q, expected application/json", contentType)}
+	}
+	if p.maxBodySize > 0 && len(body) > p.maxBodySize {
+		return &Error{Code: fasthttp.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("request body must not be larger than %d bytes", p.maxBodySize)}
+	}
+	return p.Unmarshal(body, data, validate)
+}
+
+// Unmarshal - function converts the json data and, if necessary, validates it. The data must be a single
+// JSON value without the unknown fields
+func (p *Parser) Unmarshal(body []byte, data interface{}, validate bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(data); err != nil {
+		return decodeError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return &Error{Code: fasthttp.StatusBadRequest, Message: "request body must contain a single JSON value"}
 	}
 	if validate {
-		if err := p.validator.Struct(data); err != nil {
-			return fmt.Errorf("invalid data for request: %s", err.Error())
+		return p.Validate(data)
+	}
+	return nil
+}
+
+// Validate - function validates the data by the validate tags of its fields
+func (p *Parser) Validate(data interface{}) error {
+	err := p.validator.Struct(data)
+	if err == nil {
+		return nil
+	}
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return &Error{Code: fasthttp.StatusBadRequest, Message: fmt.Sprintf("invalid data for request: %s", err)}
+	}
+	fields := make([]FieldError, 0, len(fieldErrors))
+	for _, e := range fieldErrors {
+		// the namespace starts with the name of the type of the data
+		field := e.Namespace()
+		if i := strings.IndexByte(field, '.'); i >= 0 {
+			field = field[i+1:]
+		}
+		parent := parentType(reflect.TypeOf(data), e.StructNamespace())
+		fields = append(fields, FieldError{Field: field, Rule: e.ActualTag(), Message: ruleMessage(e, parent)})
+	}
+	return &Error{Code: fasthttp.StatusBadRequest, Message: "invalid data for request", Fields: fields}
+}
+
+// decodeError - converts the error of the JSON decoder into the error of the request
+func decodeError(err error) *Error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return &Error{Code: fasthttp.StatusBadRequest, Message: "request body must not be empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &Error{Code: fasthttp.StatusBadRequest, Message: "request body contains malformed JSON"}
+	case errors.As(err, &syntaxErr):
+		return &Error{Code: fasthttp.StatusBadRequest,
+			Message: fmt.Sprintf("request body contains malformed JSON at position %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &Error{Code: fasthttp.StatusBadRequest,
+				Message: fmt.Sprintf("request body must be %s, not %s", jsonType(typeErr.Type), typeErr.Value)}
+		}
+		return &Error{Code: fasthttp.StatusBadRequest, Message: "invalid data for request", Fields: []FieldError{{
+			Field: typeErr.Field, Rule: "type", Message: fmt.Sprintf("must be %s", jsonType(typeErr.Type)),
+		}}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &Error{Code: fasthttp.StatusBadRequest, Message: "invalid data for request", Fields: []FieldError{{
+			Field: field, Rule: "unknown", Message: "is not a known field",
+		}}}
+	}
+	return &Error{Code: fasthttp.StatusBadRequest, Message: err.Error()}
+}
+
+// ruleMessage - returns the message of the violated rule of the validate tag, the fields of the param
+// are named by their JSON names in the parent struct
+func ruleMessage(e validator.FieldError, parent reflect.Type) string {
+	param := e.Param()
+	numeric := false
+	switch e.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		numeric = true
+	}
+	switch e.ActualTag() {
+	case "required":
+		return "is required"
+	case "required_if":
+		// the param is the pairs of the field and its value
+		words := strings.Fields(param)
+		conditions := make([]string, 0, len(words)/2)
+		for i := 0; i+1 < len(words); i += 2 {
+			conditions = append(conditions, fieldName(parent, words[i])+" is "+words[i+1])
+		}
+		return "is required when " + strings.Join(conditions, " and ")
+	case "gt":
+		return "must be greater than " + param
+	case "gte":
+		return "must be greater than or equal to " + param
+	case "lt":
+		return "must be less than " + param
+	case "lte":
+		return "must be less than or equal to " + param
+	case "ne":
+		return "must not be equal to " + param
+	case "min":
+		if numeric {
+			return "must be at least " + param
+		}
+		return fmt.Sprintf("must have at least %s items or characters", param)
+	case "max":
+		if numeric {
+			return "must be at most " + param
+		}
+		return fmt.Sprintf("must have at most %s items or characters", param)
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(param, " ", ", ")
+	case "unique":
+		return "must not contain duplicates"
+	case "url":
+		return "must be a valid URL"
+	}
+	if param != "" {
+		return fmt.Sprintf("must satisfy %s=%s", e.ActualTag(), param)
+	}
+	return "must satisfy " + e.ActualTag()
+}
+
+// jsonName - returns the JSON name of the field, the name of the field without the json tag
+// and "" for the skipped one
+func jsonName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// fieldName - returns the JSON name of the field of the struct by its Go name, the Go name
+// if the struct has no such field
+func fieldName(t reflect.Type, name string) string {
+	if t == nil {
+		return name
+	}
+	field, ok := t.FieldByName(name)
+	if !ok {
+		return name
+	}
+	if tag := jsonName(field); tag != "" {
+		return tag
+	}
+	return name
+}
+
+// parentType - returns the type of the struct holding the field of the namespace by the Go names,
+// e.g. "Order.Items[0].Price", nil if the namespace doesn't match the type
+func parentType(t reflect.Type, namespace string) reflect.Type {
+	t = structType(t)
+	names := strings.Split(namespace, ".")
+	// the namespace starts with the name of the type and ends with the name of the field
+	for i := 1; t != nil && i < len(names)-1; i++ {
+		name := names[i]
+		if j := strings.IndexByte(name, '['); j >= 0 {
+			name = name[:j]
+		}
+		field, ok := t.FieldByName(name)
+		if !ok {
+			return nil
+		}
+		t = structType(field.Type)
+	}
+	return t
+}
+
+// structType - returns the struct type under the pointers and the elements of the collections,
+// nil if there is no struct
+func structType(t reflect.Type) reflect.Type {
+	for t != nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		case reflect.Struct:
+			return t
+		default:
+			return nil
 		}
 	}
 	return nil
 }
+
+// jsonType - returns the name of the JSON type of the Go type for the messages
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
+
+// isJSON - reports whether the media type of the content type is JSON: application/json or a +json type
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
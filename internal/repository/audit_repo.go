@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"strconv"
+	"strings"
+)
+
+const (
+	tableAudit      = "audit_log"
+	columnAuditId   = "audit_id"
+	columnMethod    = "method"
+	columnEndpoint  = "endpoint"
+	columnRequestId = "request_id"
+	columnSourceIP  = "source_ip"
+	columnOutcome   = "outcome"
+	columnBalances  = "balances"
+	columnPrevHash  = "prev_hash"
+	columnHash      = "hash"
+	columnChainSeq  = "chain_seq"
+	// auditLockKey - key of the advisory lock held while the entries are chained, so the entries chained
+	// by the concurrent calls follow one another
+	auditLockKey = 40002
+	// auditBatchSize - number of the entries fetched at once while the log is streamed
+	auditBatchSize = 1000
+)
+
+// auditColumns - columns of the entries in the order of scanAuditEntry
+var auditColumns = []string{columnAuditId, columnCreatedAt, columnClient, columnKeyId, columnMethod, columnEndpoint,
+	columnRequestId, columnSourceIP, columnPayload, columnStatusCode, columnOutcome, columnMessage, columnBalances,
+	columnChainSeq, columnPrevHash, columnHash}
+
+// AuditRepo - audit log object in the repository layer
+type AuditRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewAuditRepo - constructor function for AuditRepo
+func NewAuditRepo(db *pgxpool.Pool) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+// AuditRecord - entry of the audit log of the call that is appended by the transaction changing the balances,
+// so the entry is committed if and only if the change is, with the balances the change left
+type AuditRecord struct {
+	entry    func() models.AuditEntry
+	recorded bool
+}
+
+// auditRecordKey - key of the context holding the audit record of the call
+type auditRecordKey struct{}
+
+// NewAuditRecord - constructor function for AuditRecord, entry returns the entry of the call when it is
+// appended
+func NewAuditRecord(entry func() models.AuditEntry) *AuditRecord {
+	return &AuditRecord{entry: entry}
+}
+
+// Recorded - reports whether the entry was appended by the transaction of the call. The transaction that
+// failed to commit is rolled back with the entry, the call then fails and is recorded as such
+func (r *AuditRecord) Recorded() bool {
+	return r.recorded
+}
+
+// WithAuditRecord - returns the context whose balance changes append the entry of the record
+func WithAuditRecord(ctx context.Context, r *AuditRecord) context.Context {
+	return context.WithValue(ctx, auditRecordKey{}, r)
+}
+
+// AppendAudit - method appends the entry to the log, it is chained by ChainAudit
+func (r *AuditRepo) AppendAudit(ctx context.Context, e *models.AuditEntry) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err = appendAudit(ctx, tx, e); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// recordAudit - appends the entry of the audit record of the context with the balances of the users after
+// the change, it is called last in the transaction that changes the balances. The entry is not chained there,
+// so the transactions of the unrelated users don't wait for each other's commit
+func recordAudit(ctx context.Context, tx pgx.Tx, balances map[int]float64) error {
+	r, ok := ctx.Value(auditRecordKey{}).(*AuditRecord)
+	if !ok {
+		return nil
+	}
+	e := r.entry()
+	for userID, balance := range balances {
+		if e.Balances == nil {
+			e.Balances = make(map[string]float64, len(balances))
+		}
+		e.Balances[strconv.Itoa(userID)] = balance
+	}
+	if err := appendAudit(ctx, tx, &e); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	r.recorded = true
+	return nil
+}
+
+// appendAudit - appends the entry to the log in the transaction without its position in the chain
+func appendAudit(ctx context.Context, tx pgx.Tx, e *models.AuditEntry) error {
+	var keyID *int
+	if e.KeyID != 0 {
+		keyID = &e.KeyID
+	}
+	e.ChainSeq, e.PrevHash, e.Hash = 0, "", ""
+	appendEntry := fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) "+
+		"RETURNING %s", tableAudit, strings.Join(auditColumns[1:13], ", "), columnAuditId)
+	return tx.QueryRow(ctx, appendEntry, e.CreatedAt, e.Client, keyID, e.Method, e.Endpoint, e.RequestID, e.SourceIP,
+		string(e.Payload), e.StatusCode, e.Outcome, e.Message, e.Balances).Scan(&e.AuditID)
+}
+
+// ChainAudit - method chains at most limit appended entries in the order of their ids and returns the number
+// of the chained entries. The hash of the last chained entry is set as PrevHash of the entry, then seal sets
+// its hash. The chaining is serialized, so the chain has no branches. An entry committed after the entries
+// with the greater ids were chained follows them in the chain
+func (r *AuditRepo) ChainAudit(ctx context.Context, limit int, seal func(e *models.AuditEntry)) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := chainAudit(ctx, tx, limit, seal)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return 0, err
+	}
+	return len(entries), tx.Commit(ctx)
+}
+
+// chainAudit - chains the appended entries in the transaction, the advisory lock of the log is held until the commit
+func chainAudit(ctx context.Context, tx pgx.Tx, limit int, seal func(e *models.AuditEntry)) ([]models.AuditEntry,
+	error) {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", auditLockKey); err != nil {
+		return nil, err
+	}
+	getLast := fmt.Sprintf("SELECT %[1]s, %[2]s FROM %[3]s WHERE %[1]s IS NOT NULL ORDER BY %[1]s DESC LIMIT 1",
+		columnChainSeq, columnHash, tableAudit)
+	var seq int64
+	var prev string
+	if err := tx.QueryRow(ctx, getLast).Scan(&seq, &prev); err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	getAppended := fmt.Sprintf("SELECT %s FROM %s WHERE %s IS NULL ORDER BY %s LIMIT $1",
+		strings.Join(auditColumns, ", "), tableAudit, columnChainSeq, columnAuditId)
+	rows, err := tx.Query(ctx, getAppended, limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	chainEntry := fmt.Sprintf("UPDATE %s SET %s=$1, %s=$2, %s=$3 WHERE %s=$4", tableAudit, columnChainSeq,
+		columnPrevHash, columnHash, columnAuditId)
+	for i := range entries {
+		e := &entries[i]
+		seq++
+		e.ChainSeq, e.PrevHash = seq, prev
+		seal(e)
+		if _, err = tx.Exec(ctx, chainEntry, e.ChainSeq, e.PrevHash, e.Hash, e.AuditID); err != nil {
+			return nil, err
+		}
+		prev = e.Hash
+	}
+	return entries, nil
+}
+
+// GetAuditEntries - method returns the entries of the filter in the order of the log
+func (r *AuditRepo) GetAuditEntries(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, error) {
+	query, args := auditQuery(f)
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// StreamAudit - method passes the entries of the filter to fn in the order of the log or of the chain, they are
+// fetched in batches, so memory usage does not depend on the size of the log
+func (r *AuditRepo) StreamAudit(ctx context.Context, f models.AuditFilter, fn func(e models.AuditEntry) error) error {
+	f.Limit = auditBatchSize
+	for {
+		entries, err := r.GetAuditEntries(ctx, f)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err = fn(e); err != nil {
+				return err
+			}
+		}
+		if len(entries) < auditBatchSize {
+			return nil
+		}
+		f.AfterID, f.AfterSeq = entries[len(entries)-1].AuditID, entries[len(entries)-1].ChainSeq
+	}
+}
+
+// auditQuery - builds the query of the entries of the filter
+func auditQuery(f models.AuditFilter) (string, []interface{}) {
+	order := columnAuditId
+	args := []interface{}{f.AfterID}
+	if f.Chained {
+		order, args[0] = columnChainSeq, f.AfterSeq
+	}
+	conditions := []string{order + ">$1"}
+	if f.Client != "" {
+		args = append(args, f.Client)
+		conditions = append(conditions, fmt.Sprintf("%s=$%d", columnClient, len(args)))
+	}
+	if f.Endpoint != "" {
+		args = append(args, f.Endpoint)
+		conditions = append(conditions, fmt.Sprintf("%s=$%d", columnEndpoint, len(args)))
+	}
+	if f.UserID != 0 {
+		args = append(args, strconv.Itoa(f.UserID))
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf("(%[1]s->>'user_id'=$%[2]d OR %[1]s->>'sender_id'=$%[2]d "+
+			"OR %[1]s->>'receiver_id'=$%[2]d)", columnPayload, n))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		conditions = append(conditions, fmt.Sprintf("%s>=$%d", columnCreatedAt, len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		conditions = append(conditions, fmt.Sprintf("%s<$%d", columnCreatedAt, len(args)))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s", strings.Join(auditColumns, ", "), tableAudit,
+		strings.Join(conditions, " AND "), order)
+	if f.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(f.Limit)
+	}
+	return query, args
+}
+
+// scanAuditEntry - scans the entry from the row of auditColumns
+func scanAuditEntry(row pgx.Row) (models.AuditEntry, error) {
+	e := models.AuditEntry{}
+	var keyID *int
+	var chainSeq *int64
+	var prevHash, hash *string
+	var payload string
+	err := row.Scan(&e.AuditID, &e.CreatedAt, &e.Client, &keyID, &e.Method, &e.Endpoint, &e.RequestID, &e.SourceIP,
+		&payload, &e.StatusCode, &e.Outcome, &e.Message, &e.Balances, &chainSeq, &prevHash, &hash)
+	if keyID != nil {
+		e.KeyID = *keyID
+	}
+	if chainSeq != nil {
+		e.ChainSeq, e.PrevHash, e.Hash = *chainSeq, *prevHash, *hash
+	}
+	e.Payload = []byte(payload)
+	return e, err
+}
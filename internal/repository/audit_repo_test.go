@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"avito/schema"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecordAudit(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	migrator, err := NewMigrator(db, schema.Migrations, "UTC")
+	assert.Nil(t, err)
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	users, audit := NewUserRepo(db), NewAuditRepo(db)
+	newRecord := func(endpoint string) *AuditRecord {
+		return NewAuditRecord(func() models.AuditEntry {
+			return models.AuditEntry{CreatedAt: time.Now().UTC(), Client: "billing", Method: "POST",
+				Endpoint: endpoint, Payload: json.RawMessage(`{}`), StatusCode: 200, Outcome: models.AuditSuccess}
+		})
+	}
+
+	tableTest := []struct {
+		testName         string
+		endpoint         string
+		call             func(ctx context.Context) error
+		expectedBalances map[string]float64
+	}{
+		{
+			"accrual of the new user",
+			"/accrual",
+			func(ctx context.Context) error {
+				return users.AccrualFunds(ctx, models.AccrualFunds{UserID: 1, Amount: 100})
+			},
+			map[string]float64{"1": 100},
+		},
+		{
+			"accrual",
+			"/accrual",
+			func(ctx context.Context) error {
+				return users.AccrualFunds(ctx, models.AccrualFunds{UserID: 2, Amount: 5})
+			},
+			map[string]float64{"2": 5},
+		},
+		{
+			"transfer",
+			"/transfer",
+			func(ctx context.Context) error {
+				return users.TransferFunds(ctx, models.Transfer{SenderID: 1, ReceiverID: 2, Amount: 30})
+			},
+			map[string]float64{"1": 70, "2": 35},
+		},
+		{
+			"adjustment",
+			"user adjust",
+			func(ctx context.Context) error {
+				return users.AdjustBalance(ctx, models.Adjustment{UserID: 2, Amount: -5, Comment: "duplicate"})
+			},
+			map[string]float64{"2": 30},
+		},
+	}
+	for _, testCase := range tableTest {
+		record := newRecord(testCase.endpoint)
+		assert.Nil(t, testCase.call(WithAuditRecord(ctx, record)), testCase.testName)
+		assert.True(t, record.Recorded(), testCase.testName)
+		entries, err := audit.GetAuditEntries(ctx, models.AuditFilter{Endpoint: testCase.endpoint})
+		if assert.Nil(t, err, testCase.testName) && assert.NotEmpty(t, entries, testCase.testName) {
+			assert.Equal(t, testCase.expectedBalances, entries[len(entries)-1].Balances, testCase.testName)
+		}
+	}
+
+	// the change is rolled back with the entry that can't be appended
+	_, err = db.Exec(ctx, "ALTER TABLE audit_log RENAME TO audit_log_broken")
+	assert.Nil(t, err)
+	record := newRecord("/accrual")
+	err = users.AccrualFunds(WithAuditRecord(ctx, record), models.AccrualFunds{UserID: 1, Amount: 10})
+	assert.NotNil(t, err, "failed audit")
+	assert.False(t, record.Recorded(), "failed audit")
+	ub, err := users.GetBalance(ctx, &models.UserBalance{UserID: 1})
+	if assert.Nil(t, err, "failed audit") {
+		assert.Equal(t, 70.0, ub.Balance, "failed audit")
+	}
+}
+
+func TestChainAudit(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	migrator, err := NewMigrator(db, schema.Migrations, "UTC")
+	assert.Nil(t, err)
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	audit := NewAuditRepo(db)
+	hash := func(seq int64) string { return fmt.Sprintf("%064d", seq) }
+	seal := func(e *models.AuditEntry) {
+		if e.PrevHash == "" {
+			e.PrevHash = hash(0)
+		}
+		e.Hash = hash(e.ChainSeq)
+	}
+	for _, endpoint := range []string{"a", "b", "c"} {
+		e := models.AuditEntry{CreatedAt: time.Now().UTC(), Client: "billing", Method: "POST", Endpoint: endpoint,
+			Payload: json.RawMessage(`{}`), StatusCode: 200, Outcome: models.AuditSuccess}
+		assert.Nil(t, audit.AppendAudit(ctx, &e), endpoint)
+	}
+
+	// the appended entries have no position until they are chained
+	entries, err := audit.GetAuditEntries(ctx, models.AuditFilter{Chained: true})
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+	n, err := audit.ChainAudit(ctx, 2, seal)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = audit.ChainAudit(ctx, 2, seal)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	entries, err = audit.GetAuditEntries(ctx, models.AuditFilter{Chained: true})
+	assert.Nil(t, err)
+	if assert.Len(t, entries, 3) {
+		for i, e := range entries {
+			assert.Equal(t, int64(i+1), e.ChainSeq)
+			assert.Equal(t, hash(int64(i)), e.PrevHash)
+			assert.Equal(t, hash(e.ChainSeq), e.Hash)
+		}
+		assert.Equal(t, "c", entries[2].Endpoint)
+	}
+
+	// the chained entry can't be chained again or changed
+	_, err = db.Exec(ctx, "UPDATE audit_log SET chain_seq=10, prev_hash='x', hash='y' WHERE chain_seq=1")
+	assert.NotNil(t, err)
+	_, err = db.Exec(ctx, "UPDATE audit_log SET message='changed' WHERE chain_seq=1")
+	assert.NotNil(t, err)
+}
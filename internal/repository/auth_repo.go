@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"strings"
+)
+
+const (
+	tableAPIKeys    = "api_keys"
+	columnKeyId     = "key_id"
+	columnClient    = "client"
+	columnScopes    = "scopes"
+	columnPrefix    = "prefix"
+	columnKeyHash   = "key_hash"
+	columnRevokedAt = "revoked_at"
+)
+
+// apiKeyColumns - columns of the keys in the order of scanAPIKey
+var apiKeyColumns = []string{columnKeyId, columnClient, columnScopes, columnUserId, columnPrefix, columnCreatedAt,
+	columnRevokedAt}
+
+// AuthRepo - API keys object in the repository layer
+type AuthRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewAuthRepo - constructor function for AuthRepo
+func NewAuthRepo(db *pgxpool.Pool) *AuthRepo {
+	return &AuthRepo{db: db}
+}
+
+// CreateAPIKey - method stores the hash of the key and sets its id and creation time
+func (r *AuthRepo) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error {
+	createKey := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s, %s) VALUES ($1, $2, $3, $4, $5) RETURNING %s, %s",
+		tableAPIKeys, columnClient, columnScopes, columnUserId, columnPrefix, columnKeyHash, columnKeyId, columnCreatedAt)
+	return r.db.QueryRow(ctx, createKey, key.Client, key.Scopes, key.UserID, key.Prefix, hash).
+		Scan(&key.KeyID, &key.CreatedAt)
+}
+
+// GetAPIKeys - method returns all keys including the revoked ones, without their hashes
+func (r *AuthRepo) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	getKeys := fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", strings.Join(apiKeyColumns, ", "), tableAPIKeys,
+		columnKeyId)
+	rows, err := r.db.Query(ctx, getKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetActiveAPIKey - method returns the key that is not revoked by the hash of the key
+func (r *AuthRepo) GetActiveAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	getKey := fmt.Sprintf("SELECT %s FROM %s WHERE %s=$1 AND %s IS NULL", strings.Join(apiKeyColumns, ", "),
+		tableAPIKeys, columnKeyHash, columnRevokedAt)
+	return scanAPIKey(r.db.QueryRow(ctx, getKey, hash))
+}
+
+// RevokeAPIKey - method revokes the key, pgx.ErrNoRows is returned when there is no active key with the id
+func (r *AuthRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	revokeKey := fmt.Sprintf("UPDATE %s SET %s=now() WHERE %s=$1 AND %s IS NULL", tableAPIKeys, columnRevokedAt,
+		columnKeyId, columnRevokedAt)
+	result, err := r.db.Exec(ctx, revokeKey, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// scanAPIKey - scans the key from the row of apiKeyColumns
+func scanAPIKey(row pgx.Row) (models.APIKey, error) {
+	key := models.APIKey{}
+	err := row.Scan(&key.KeyID, &key.Client, &key.Scopes, &key.UserID, &key.Prefix, &key.CreatedAt, &key.RevokedAt)
+	return key, err
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	tableServices       = "services"
+	columnName          = "name"
+	columnDebitAccount  = "debit_account"
+	columnCreditAccount = "credit_account"
+)
+
+// CatalogRepo - service catalog object in the repository layer
+type CatalogRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewCatalogRepo - constructor function for CatalogRepo
+func NewCatalogRepo(db *pgxpool.Pool) *CatalogRepo {
+	return &CatalogRepo{db: db}
+}
+
+// UpsertService - method adds the service to the catalog or updates the existing one
+func (c *CatalogRepo) UpsertService(ctx context.Context, s models.ServiceInfo) error {
+	upsertService := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		ON CONFLICT (%[2]s) DO UPDATE SET %[3]s=EXCLUDED.%[3]s, %[4]s=EXCLUDED.%[4]s, %[5]s=EXCLUDED.%[5]s`,
+		tableServices, columnServiceId, columnName, columnDebitAccount, columnCreditAccount)
+	result, err := c.db.Exec(ctx, upsertService, s.ServiceID, s.Name, s.DebitAccount, s.CreditAccount)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() != 1 {
+		return errInsertRow
+	}
+	return nil
+}
+
+// GetServices - method returns all services of the catalog
+func (c *CatalogRepo) GetServices(ctx context.Context) ([]models.ServiceInfo, error) {
+	getServices := fmt.Sprintf("SELECT %s, %s, COALESCE(%s, ''), COALESCE(%s, '') FROM %s ORDER BY %s",
+		columnServiceId, columnName, columnDebitAccount, columnCreditAccount, tableServices, columnServiceId)
+	rows, err := c.db.Query(ctx, getServices)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	services := make([]models.ServiceInfo, 0)
+	for rows.Next() {
+		s := models.ServiceInfo{}
+		err = rows.Scan(&s.ServiceID, &s.Name, &s.DebitAccount, &s.CreditAccount)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, s)
+	}
+	return services, rows.Err()
+}
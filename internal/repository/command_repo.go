@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	tableCommands     = "processed_commands"
+	columnMessageId   = "message_id"
+	columnCommandType = "command_type"
+	columnStatusCode  = "status_code"
+	columnDescription = "description"
+	columnClaimedAt   = "claimed_at"
+	columnProcessedAt = "processed_at"
+)
+
+// CommandRepo - object in the repository layer that remembers the processed commands by their message ids
+type CommandRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewCommandRepo - constructor function for CommandRepo
+func NewCommandRepo(db *pgxpool.Pool) *CommandRepo {
+	return &CommandRepo{db: db}
+}
+
+// ClaimCommand - method claims the message id for execution. When the message id has already been claimed
+// it returns false with the stored processing of the command
+func (c *CommandRepo) ClaimCommand(ctx context.Context, messageID, commandType string) (models.CommandResult, bool,
+	error) {
+	result := models.CommandResult{MessageID: messageID, CommandType: commandType}
+	claimCommand := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2) ON CONFLICT (%s) DO NOTHING RETURNING %s",
+		tableCommands, columnMessageId, columnCommandType, columnMessageId, columnClaimedAt)
+	err := c.db.QueryRow(ctx, claimCommand, messageID, commandType).Scan(&result.ClaimedAt)
+	if err == nil {
+		return result, true, nil
+	}
+	if err != pgx.ErrNoRows {
+		return result, false, err
+	}
+	getCommand := fmt.Sprintf("SELECT %s, %s, COALESCE(%s, ''), %s FROM %s WHERE %s=$1",
+		columnCommandType, columnStatusCode, columnDescription, columnClaimedAt, tableCommands, columnMessageId)
+	err = c.db.QueryRow(ctx, getCommand, messageID).
+		Scan(&result.CommandType, &result.StatusCode, &result.Description, &result.ClaimedAt)
+	return result, false, err
+}
+
+// CompleteCommand - method stores the result of the claimed command
+func (c *CommandRepo) CompleteCommand(ctx context.Context, result models.CommandResult) error {
+	completeCommand := fmt.Sprintf("UPDATE %s SET %s=$1, %s=$2, %s=now() WHERE %s=$3",
+		tableCommands, columnStatusCode, columnDescription, columnProcessedAt, columnMessageId)
+	_, err := c.db.Exec(ctx, completeCommand, result.StatusCode, result.Description,
+		result.MessageID)
+	return err
+}
+
+// ReleaseCommand - method forgets the claim of the command that has not been executed,
+// so its next delivery is executed again
+func (c *CommandRepo) ReleaseCommand(ctx context.Context, messageID string) error {
+	releaseCommand := fmt.Sprintf("DELETE FROM %s WHERE %s=$1 AND %s IS NULL",
+		tableCommands, columnMessageId, columnStatusCode)
+	_, err := c.db.Exec(ctx, releaseCommand, messageID)
+	return err
+}
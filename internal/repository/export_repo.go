@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"io"
+	"strings"
+	"time"
+)
+
+// exportBatchSize - number of rows fetched from the server-side cursor at a time
+const exportBatchSize = 1000
+
+// exportColumns - columns of the exported tables in the output order
+var exportColumns = map[string][]string{
+	tableTransactions: {columnTransactionId, columnUserId, columnAmount, columnDate, columnMessage, columnOperation,
+		columnOrderId, columnServiceId, columnCounterpart, columnExternalRef, columnParentId, columnMessageCode,
+		columnMessageParams},
+	tableOrders: {columnOrderId, columnUserId, columnServiceId, columnAmount, columnDate, columnBlock},
+}
+
+// ExportRepo - object in the repository layer for streaming bulk exports
+type ExportRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewExportRepo - constructor function for ExportRepo
+func NewExportRepo(db *pgxpool.Pool) *ExportRepo {
+	return &ExportRepo{db: db}
+}
+
+// CopyCSV - method streams the table into w in CSV format with a header using COPY ... TO STDOUT
+func (e *ExportRepo) CopyCSV(ctx context.Context, req models.ExportRequest, w io.Writer) error {
+	query, err := exportQuery(req)
+	if err != nil {
+		return err
+	}
+	conn, err := e.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	_, err = conn.Conn().PgConn().CopyTo(ctx, w, fmt.Sprintf("COPY (%s) TO STDOUT WITH (FORMAT csv, HEADER)", query))
+	return err
+}
+
+// StreamTransactions - method passes the transactions to fn one by one reading them with a server-side cursor
+func (e *ExportRepo) StreamTransactions(ctx context.Context, req models.ExportRequest,
+	fn func(tr models.TransactionList) error) error {
+	req.Table = tableTransactions
+	return e.stream(ctx, req, func(rows pgx.Rows) error {
+		tr := models.TransactionList{}
+		if err := scanTransaction(rows, &tr); err != nil {
+			return err
+		}
+		return fn(tr)
+	})
+}
+
+// StreamOrders - method passes the orders to fn one by one reading them with a server-side cursor
+func (e *ExportRepo) StreamOrders(ctx context.Context, req models.ExportRequest, fn func(order models.Order) error) error {
+	req.Table = tableOrders
+	return e.stream(ctx, req, func(rows pgx.Rows) error {
+		order := models.Order{}
+		if err := rows.Scan(&order.OrderID, &order.UserID, &order.ServiceID, &order.Amount, &order.Date,
+			&order.Block); err != nil {
+			return err
+		}
+		return fn(order)
+	})
+}
+
+// stream - declares a cursor for the export query in a read-only snapshot and fetches it in batches,
+// so memory usage does not depend on the size of the table
+func (e *ExportRepo) stream(ctx context.Context, req models.ExportRequest, scan func(rows pgx.Rows) error) error {
+	query, err := exportQuery(req)
+	if err != nil {
+		return err
+	}
+	tx, err := e.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+	if _, err = tx.Exec(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+query); err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf("FETCH %d FROM export_cursor", exportBatchSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return err
+		}
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			if err = scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		if fetched < exportBatchSize {
+			break
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// exportQuery - builds the query of the export. COPY and DECLARE do not accept bind parameters,
+// so the filter values are rendered as literals, they are only integers and formatted timestamps
+func exportQuery(req models.ExportRequest) (string, error) {
+	columns, ok := exportColumns[req.Table]
+	if !ok {
+		return "", fmt.Errorf("table %s cannot be exported", req.Table)
+	}
+	conditions := make([]string, 0, 3)
+	if !req.From.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s>='%s'::timestamptz", columnDate,
+			req.From.UTC().Format(time.RFC3339Nano)))
+	}
+	if !req.To.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s<'%s'::timestamptz", columnDate,
+			req.To.UTC().Format(time.RFC3339Nano)))
+	}
+	if req.UserID != 0 {
+		conditions = append(conditions, fmt.Sprintf("%s=%d", columnUserId, req.UserID))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), req.Table)
+	if len(conditions) != 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query + fmt.Sprintf(" ORDER BY %s", columns[0]), nil
+}
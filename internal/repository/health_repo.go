@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"avito/schema"
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// HealthRepo - object in the repository layer that checks the database for the readiness of the service
+type HealthRepo struct {
+	db       *pgxpool.Pool
+	migrator *Migrator
+	err      error
+}
+
+// NewHealthRepo - constructor function for HealthRepo
+func NewHealthRepo(db *pgxpool.Pool) *HealthRepo {
+	migrator, err := NewMigrator(db, schema.Migrations, "")
+	return &HealthRepo{db: db, migrator: migrator, err: err}
+}
+
+// Ping - method checks the connection to the database
+func (h *HealthRepo) Ping(ctx context.Context) error {
+	return h.db.Ping(ctx)
+}
+
+// GetPendingMigrations - method returns the migrations embedded into the binary that are not applied,
+// the check doesn't change the database
+func (h *HealthRepo) GetPendingMigrations(ctx context.Context) ([]models.Migration, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	return h.migrator.Pending(ctx)
+}
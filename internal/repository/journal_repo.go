@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+const columnTransactionId = "transaction_id"
+
+// JournalRepo - object in the repository layer that collects money movements for the journal
+type JournalRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewJournalRepo - constructor function for JournalRepo
+func NewJournalRepo(db *pgxpool.Pool) *JournalRepo {
+	return &JournalRepo{db: db}
+}
+
+// GetMovements - method returns the money movements of the history for the period [from, to): accruals,
+// reservations, charges, cancellations, refunds, outgoing transfers and adjustments. The charge is recorded
+// with zero amount, so it is journaled with the amount of its order on the date of the charge
+func (j *JournalRepo) GetMovements(ctx context.Context, from, to time.Time) ([]models.Movement, error) {
+	getTransactions := fmt.Sprintf(`SELECT t.%[1]s, t.%[2]s, CASE WHEN t.%[5]s=$3 THEN COALESCE(o.%[3]s, 0) ELSE t.%[3]s END,
+		t.%[4]s, t.%[5]s, COALESCE(t.%[6]s, 0), COALESCE(t.%[7]s, 0), COALESCE(t.%[8]s, 0)
+		FROM %[9]s t LEFT JOIN %[10]s o ON o.%[6]s=t.%[6]s
+		WHERE t.%[4]s>=$1 AND t.%[4]s<$2 ORDER BY t.%[4]s, t.%[1]s`,
+		columnTransactionId, columnUserId, columnAmount, columnDate, columnOperation, columnOrderId, columnServiceId,
+		columnCounterpart, tableTransactions, tableOrders)
+	rows, err := j.db.Query(ctx, getTransactions, from, to, models.OperationCharge)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	movements := make([]models.Movement, 0)
+	var operation string
+	for rows.Next() {
+		m := models.Movement{}
+		err = rows.Scan(&m.SourceID, &m.UserID, &m.Amount, &m.Date, &operation, &m.OrderID, &m.ServiceID,
+			&m.CounterpartyID)
+		if err != nil {
+			return nil, err
+		}
+		if classifyMovement(&m, operation) {
+			movements = append(movements, m)
+		}
+	}
+	return movements, rows.Err()
+}
+
+// classifyMovement - sets the operation of the movement by the operation of the transaction,
+// returns false for records that are not journaled separately, like the incoming side of a transfer.
+// The charge is identified by its order, which is charged once
+func classifyMovement(m *models.Movement, operation string) bool {
+	switch operation {
+	case models.OperationAccrual:
+		m.Operation = models.JournalAccrual
+	case models.OperationReservation:
+		m.Operation = models.JournalReservation
+		m.Amount = -m.Amount
+	case models.OperationCharge:
+		m.Operation = models.JournalCharge
+		m.SourceID = m.OrderID
+	case models.OperationCancellation:
+		m.Operation = models.JournalCancellation
+	case models.OperationRefund:
+		m.Operation = models.JournalRefund
+	case models.OperationTransferOut:
+		m.Operation = models.JournalTransfer
+		m.Amount = -m.Amount
+	case models.OperationAdjustment:
+		m.Operation = models.JournalAdjustment
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"avito/schema"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGetMovementsCharge(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	migrator, err := NewMigrator(db, schema.Migrations, "UTC")
+	assert.Nil(t, err)
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	users, orders, journal := NewUserRepo(db), NewOrdersRepo(db), NewJournalRepo(db)
+
+	// the order is reserved in the previous month and charged in this one
+	month := time.Date(time.Now().UTC().Year(), time.Now().UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	reserved := month.AddDate(0, 0, -3)
+	assert.Nil(t, users.AccrualFunds(ctx, models.AccrualFunds{UserID: 1, Amount: 100}))
+	order := models.Order{OrderID: 7, UserID: 1, ServiceID: 3, Amount: 40, Date: reserved, Block: true}
+	assert.Nil(t, users.BlockFunds(ctx, order))
+	order.Block = false
+	assert.Nil(t, orders.ChargeFunds(ctx, order))
+
+	tableTest := []struct {
+		testName          string
+		from              time.Time
+		expectedOperation []string
+	}{
+		{
+			"month of the reservation",
+			month.AddDate(0, -1, 0),
+			[]string{models.JournalReservation},
+		},
+		{
+			"month of the charge",
+			month,
+			[]string{models.JournalAccrual, models.JournalCharge},
+		},
+	}
+	for _, testCase := range tableTest {
+		movements, err := journal.GetMovements(ctx, testCase.from, testCase.from.AddDate(0, 1, 0))
+		if !assert.Nil(t, err, testCase.testName) {
+			continue
+		}
+		operations := make([]string, 0, len(movements))
+		for _, m := range movements {
+			operations = append(operations, m.Operation)
+			if m.Operation == models.JournalCharge {
+				assert.Equal(t, 7, m.SourceID, testCase.testName)
+				assert.Equal(t, 40.0, m.Amount, testCase.testName)
+				assert.Equal(t, 3, m.ServiceID, testCase.testName)
+				assert.True(t, !m.Date.Before(month), testCase.testName)
+			}
+		}
+		assert.Equal(t, testCase.expectedOperation, operations, testCase.testName)
+	}
+}
@@ -0,0 +1,375 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	// legacyTimezoneSetting - setting of the migration transaction with the time zone of the timestamps written
+	// without the zone, the migrations read it with current_setting
+	legacyTimezoneSetting = "avito.legacy_timezone"
+	tableMigrations       = "schema_migrations"
+	columnVersion         = "version"
+	columnAppliedAt       = "applied_at"
+	// migrationLockKey - key of the advisory lock held while the migrations are applied,
+	// so the replicas started at once don't apply them in parallel
+	migrationLockKey = 40001
+	// undefinedTable - code of the Postgres error of the missing table
+	undefinedTable = "42P01"
+)
+
+// createMigrationsTable - statement that creates the table of the applied migrations
+var createMigrationsTable = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+	(%s bigint PRIMARY KEY, %s varchar(255) NOT NULL, %s timestamptz NOT NULL DEFAULT now())`,
+	tableMigrations, columnVersion, columnName, columnAppliedAt)
+
+// legacyProbes - checks of the migrations that the docker initdb scripts applied to the databases created
+// before the migrations were tracked: each query reports whether the schema already has the changes
+// of the version. The scripts ran in the order of the versions, so the applied ones are a prefix
+var legacyProbes = []struct {
+	version int64
+	query   string
+}{
+	{1, "SELECT to_regclass('users') IS NOT NULL"},
+	{2, `SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema()
+		AND table_name = 'transactions' AND column_name = 'date_time' AND data_type = 'timestamp with time zone')`},
+	{3, "SELECT to_regclass('services') IS NOT NULL"},
+	{4, "SELECT to_regclass('transactions_user_id_date_time_idx') IS NOT NULL"},
+	{5, legacyColumnProbe("operation")},
+	{6, legacyColumnProbe("parent_transaction_id")},
+	{7, legacyColumnProbe("message_code")},
+	{8, "SELECT to_regprocedure('notify_transaction()') IS NOT NULL"},
+	{9, "SELECT to_regclass('webhook_subscriptions') IS NOT NULL"},
+	{10, "SELECT to_regclass('outbox') IS NOT NULL"},
+	{11, "SELECT to_regclass('processed_commands') IS NOT NULL"},
+}
+
+// legacyColumnProbe - returns the query that checks the column of the transactions table
+func legacyColumnProbe(column string) string {
+	return fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema()
+		AND table_name = 'transactions' AND column_name = '%s')`, column)
+}
+
+// migrationFile - name of the migration file: version, name and direction
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migration - version of the schema with the statements that apply and revert it
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+// Migrator - object in the repository layer that applies the versioned migrations of the schema
+type Migrator struct {
+	db             *pgxpool.Pool
+	migrations     []migration
+	legacyTimezone string
+}
+
+// NewMigrator - constructor function for Migrator, reads the migrations from fsys. legacyTimezone is
+// the time zone in which the timestamps without the zone are converted
+func NewMigrator(db *pgxpool.Pool, fsys fs.FS, legacyTimezone string) (*Migrator, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*migration)
+	for _, file := range files {
+		parts := migrationFile.FindStringSubmatch(file.Name())
+		if parts == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.name != parts[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up step", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, k int) bool {
+		return migrations[i].version < migrations[k].version
+	})
+	return &Migrator{db: db, migrations: migrations, legacyTimezone: legacyTimezone}, nil
+}
+
+// Up - method applies the pending migrations in the order of their versions, each one in its own
+// transaction. Returns the applied migrations
+func (m *Migrator) Up(ctx context.Context) ([]models.Migration, error) {
+	applied := make([]models.Migration, 0)
+	err := m.locked(ctx, func(conn *pgxpool.Conn, versions map[int64]bool) error {
+		for _, mg := range m.migrations {
+			if versions[mg.version] {
+				continue
+			}
+			insertVersion := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2)",
+				tableMigrations, columnVersion, columnName)
+			err := m.apply(ctx, conn, mg.up, insertVersion, mg.version, mg.name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.version, mg.name, err)
+			}
+			applied = append(applied, models.Migration{Version: mg.version, Name: mg.name})
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down - method reverts the given number of the latest applied migrations, returns the reverted migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]models.Migration, error) {
+	reverted := make([]models.Migration, 0, steps)
+	err := m.locked(ctx, func(conn *pgxpool.Conn, versions map[int64]bool) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mg := m.migrations[i]
+			if !versions[mg.version] {
+				continue
+			}
+			if mg.down == "" {
+				return fmt.Errorf("migration %d_%s has no down step", mg.version, mg.name)
+			}
+			deleteVersion := fmt.Sprintf("DELETE FROM %s WHERE %s=$1", tableMigrations, columnVersion)
+			if err := m.apply(ctx, conn, mg.down, deleteVersion, mg.version); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.version, mg.name, err)
+			}
+			reverted = append(reverted, models.Migration{Version: mg.version, Name: mg.name})
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status - method returns all migrations with the time they were applied, the database without the table
+// of the applied migrations has all of them pending
+func (m *Migrator) Status(ctx context.Context) ([]models.Migration, error) {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+	// the status doesn't create the table, so the database created before the migrations were tracked
+	// is still adopted by the next run of the migrations
+	var tracked bool
+	if err = conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", tableMigrations).Scan(&tracked); err != nil {
+		return nil, err
+	}
+	if !tracked {
+		status := make([]models.Migration, 0, len(m.migrations))
+		for _, mg := range m.migrations {
+			status = append(status, models.Migration{Version: mg.version, Name: mg.name})
+		}
+		return status, nil
+	}
+	getApplied := fmt.Sprintf("SELECT %s, %s, %s FROM %s", columnVersion, columnName, columnAppliedAt,
+		tableMigrations)
+	rows, err := conn.Query(ctx, getApplied)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]models.Migration)
+	for rows.Next() {
+		mg := models.Migration{}
+		if err = rows.Scan(&mg.Version, &mg.Name, &mg.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[mg.Version] = mg
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	status := make([]models.Migration, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		st := models.Migration{Version: mg.version, Name: mg.name}
+		if a, ok := applied[mg.version]; ok {
+			st.AppliedAt = a.AppliedAt
+			delete(applied, mg.version)
+		}
+		status = append(status, st)
+	}
+	// versions applied by a newer binary are shown as well
+	for _, a := range applied {
+		status = append(status, a)
+	}
+	sort.Slice(status, func(i, k int) bool {
+		return status[i].Version < status[k].Version
+	})
+	return status, nil
+}
+
+// Pending - method returns the migrations that are not applied. It only reads the applied versions,
+// the database without the table of the applied migrations has all of them pending
+func (m *Migrator) Pending(ctx context.Context) ([]models.Migration, error) {
+	versions := make(map[int64]bool)
+	rows, err := m.db.Query(ctx, fmt.Sprintf("SELECT %s FROM %s", columnVersion, tableMigrations))
+	if err == nil {
+		for rows.Next() {
+			var version int64
+			if err = rows.Scan(&version); err != nil {
+				break
+			}
+			versions[version] = true
+		}
+		rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	var pgErr *pgconn.PgError
+	if err != nil && !(errors.As(err, &pgErr) && pgErr.Code == undefinedTable) {
+		return nil, err
+	}
+	pending := make([]models.Migration, 0)
+	for _, mg := range m.migrations {
+		if !versions[mg.version] {
+			pending = append(pending, models.Migration{Version: mg.version, Name: mg.name})
+		}
+	}
+	return pending, nil
+}
+
+// locked - runs fn on a dedicated connection holding the migration lock with the applied versions
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn, versions map[int64]bool) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	var tracked, legacy bool
+	err = conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL, to_regclass($2) IS NOT NULL",
+		tableMigrations, tableUsers).Scan(&tracked, &legacy)
+	if err != nil {
+		return err
+	}
+	// the database created by the docker initdb scripts has the schema without the table of the migrations,
+	// the migrations it already has are recorded instead of being applied again
+	if !tracked && legacy {
+		err = m.adopt(ctx, conn)
+	} else {
+		err = m.createTable(ctx, conn)
+	}
+	if err != nil {
+		return err
+	}
+	// the versions are read under the lock, so the migrations applied by another replica are skipped
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT %s FROM %s", columnVersion, tableMigrations))
+	if err != nil {
+		return err
+	}
+	versions := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		versions[version] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return fn(conn, versions)
+}
+
+// adopt - creates the table of the applied migrations with the versions the existing schema already has,
+// the probes stop at the first migration the schema lacks. The table is created in the same transaction,
+// so the failed adoption is retried by the next run
+func (m *Migrator) adopt(ctx context.Context, conn *pgxpool.Conn) error {
+	names := make(map[int64]string, len(m.migrations))
+	for _, mg := range m.migrations {
+		names[mg.version] = mg.name
+	}
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+	if _, err = tx.Exec(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("adopting the existing schema: %w", err)
+	}
+	insertVersion := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2)", tableMigrations, columnVersion, columnName)
+	for _, probe := range legacyProbes {
+		name, ok := names[probe.version]
+		if !ok {
+			break
+		}
+		var applied bool
+		if err = tx.QueryRow(ctx, probe.query).Scan(&applied); err != nil {
+			return fmt.Errorf("adopting the existing schema: %w", err)
+		}
+		if !applied {
+			break
+		}
+		if _, err = tx.Exec(ctx, insertVersion, probe.version, name); err != nil {
+			return fmt.Errorf("adopting the existing schema: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// createTable - creates the table of the applied migrations
+func (m *Migrator) createTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx, createMigrationsTable)
+	return err
+}
+
+// apply - runs the statements of the migration and records its version in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, statements, record string,
+	args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	// the setting is local to the transaction of the migration
+	if _, err = tx.Exec(ctx, "SELECT set_config($1, $2, true)", legacyTimezoneSetting, m.legacyTimezone); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	// without arguments the statements are sent with the simple protocol, which allows several of them
+	if _, err = tx.Exec(ctx, statements); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	if _, err = tx.Exec(ctx, record, args...); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	return tx.Commit(ctx)
+}
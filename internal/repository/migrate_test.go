@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"avito/schema"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestNewMigrator(t *testing.T) {
+	tableTest := []struct {
+		testName         string
+		files            fstest.MapFS
+		expectedVersions []int64
+		expectedError    string
+	}{
+		{
+			"sorted by version",
+			fstest.MapFS{
+				"000010_outbox.up.sql":     {Data: []byte("SELECT 10")},
+				"000002_services.up.sql":   {Data: []byte("SELECT 2")},
+				"000002_services.down.sql": {Data: []byte("SELECT -2")},
+				"schema.go":                {Data: []byte("package schema")},
+			},
+			[]int64{2, 10},
+			"",
+		},
+		{
+			"missing up step",
+			fstest.MapFS{
+				"000001_init.up.sql":       {Data: []byte("SELECT 1")},
+				"000002_services.down.sql": {Data: []byte("SELECT -2")},
+			},
+			nil,
+			"migration 2_services has no up step",
+		},
+		{
+			"two names",
+			fstest.MapFS{
+				"000001_init.up.sql":  {Data: []byte("SELECT 1")},
+				"000001_users.up.sql": {Data: []byte("SELECT 1")},
+			},
+			nil,
+			"migration 1 has two names: init and users",
+		},
+	}
+	for _, testCase := range tableTest {
+		migrator, err := NewMigrator(nil, testCase.files, "UTC")
+		if testCase.expectedError != "" {
+			if assert.NotNil(t, err, testCase.testName) {
+				assert.Equal(t, testCase.expectedError, err.Error(), testCase.testName)
+			}
+			continue
+		}
+		if assert.Nil(t, err, testCase.testName) {
+			versions := make([]int64, 0, len(migrator.migrations))
+			for _, mg := range migrator.migrations {
+				versions = append(versions, mg.version)
+			}
+			assert.Equal(t, testCase.expectedVersions, versions, testCase.testName)
+		}
+	}
+}
+
+// testMigrations - migrations of the tests, the second one takes a while to widen the window of the race
+var testMigrations = fstest.MapFS{
+	"000001_users.up.sql":      {Data: []byte("CREATE TABLE users (user_id integer PRIMARY KEY)")},
+	"000001_users.down.sql":    {Data: []byte("DROP TABLE users")},
+	"000002_orders.up.sql":     {Data: []byte("SELECT pg_sleep(0.2); CREATE TABLE orders (order_id integer)")},
+	"000002_orders.down.sql":   {Data: []byte("DROP TABLE orders")},
+	"000003_services.up.sql":   {Data: []byte("CREATE TABLE services (service_id integer)")},
+	"000003_services.down.sql": {Data: []byte("DROP TABLE services")},
+}
+
+func TestMigratorUpDownStatus(t *testing.T) {
+	db := newTestDB(t)
+	migrator, err := NewMigrator(db, testMigrations, "UTC")
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	status, err := migrator.Status(ctx)
+	assert.Nil(t, err, "status of the new database")
+	assert.Equal(t, []int64{}, appliedVersions(status), "status of the new database")
+	assert.False(t, tableExists(t, db, tableMigrations), "the status doesn't create the table")
+
+	applied, err := migrator.Up(ctx)
+	assert.Nil(t, err, "up")
+	assert.Equal(t, []models.Migration{{Version: 1, Name: "users"}, {Version: 2, Name: "orders"},
+		{Version: 3, Name: "services"}}, applied, "up")
+
+	applied, err = migrator.Up(ctx)
+	assert.Nil(t, err, "repeated up")
+	assert.Equal(t, 0, len(applied), "repeated up")
+
+	status, err = migrator.Status(ctx)
+	assert.Nil(t, err, "status after up")
+	assert.Equal(t, []int64{1, 2, 3}, appliedVersions(status), "status after up")
+
+	reverted, err := migrator.Down(ctx, 2)
+	assert.Nil(t, err, "down")
+	assert.Equal(t, []models.Migration{{Version: 3, Name: "services"}, {Version: 2, Name: "orders"}}, reverted,
+		"down")
+	assert.False(t, tableExists(t, db, "orders"), "down")
+
+	status, err = migrator.Status(ctx)
+	assert.Nil(t, err, "status after down")
+	assert.Equal(t, []int64{1}, appliedVersions(status), "status after down")
+}
+
+func TestMigratorPending(t *testing.T) {
+	db := newTestDB(t)
+	migrator, err := NewMigrator(db, testMigrations, "UTC")
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	pending, err := migrator.Pending(ctx)
+	assert.Nil(t, err, "new database")
+	assert.Equal(t, 3, len(pending), "new database")
+	assert.False(t, tableExists(t, db, tableMigrations), "the check doesn't create the table")
+
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	_, err = migrator.Down(ctx, 1)
+	assert.Nil(t, err)
+	pending, err = migrator.Pending(ctx)
+	assert.Nil(t, err, "reverted migration")
+	assert.Equal(t, []models.Migration{{Version: 3, Name: "services"}}, pending, "reverted migration")
+}
+
+func TestMigratorFailedMigration(t *testing.T) {
+	db := newTestDB(t)
+	files := fstest.MapFS{
+		"000001_users.up.sql":  {Data: []byte("CREATE TABLE users (user_id integer PRIMARY KEY)")},
+		"000002_broken.up.sql": {Data: []byte("CREATE TABLE broken (id integer); SELECT * FROM missing")},
+	}
+	migrator, err := NewMigrator(db, files, "UTC")
+	assert.Nil(t, err)
+
+	applied, err := migrator.Up(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, []models.Migration{{Version: 1, Name: "users"}}, applied)
+	assert.False(t, tableExists(t, db, "broken"), "the failed migration is rolled back")
+	status, err := migrator.Status(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, appliedVersions(status))
+}
+
+func TestMigratorLockContention(t *testing.T) {
+	db := newTestDB(t)
+	const replicas = 3
+	results := make([][]models.Migration, replicas)
+	errs := make([]error, replicas)
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			migrator, err := NewMigrator(db, testMigrations, "UTC")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i], errs[i] = migrator.Up(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	versions := make(map[int64]int)
+	for i := 0; i < replicas; i++ {
+		assert.Nil(t, errs[i], fmt.Sprintf("replica %d", i))
+		for _, m := range results[i] {
+			versions[m.Version]++
+		}
+	}
+	assert.Equal(t, map[int64]int{1: 1, 2: 1, 3: 1}, versions, "each migration is applied by one replica")
+}
+
+func TestMigratorAdopt(t *testing.T) {
+	tableTest := []struct {
+		testName        string
+		initdb          int64
+		expectedApplied []int64
+	}{
+		{
+			"baseline of the first image",
+			1,
+			[]int64{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17},
+		},
+		{
+			"all initdb scripts",
+			11,
+			[]int64{12, 13, 14, 15, 16, 17},
+		},
+	}
+	for _, testCase := range tableTest {
+		db := newTestDB(t)
+		ctx := context.Background()
+		migrator, err := NewMigrator(db, schema.Migrations, "UTC")
+		assert.Nil(t, err, testCase.testName)
+		// the docker initdb scripts ran the up steps without recording them
+		for _, mg := range migrator.migrations {
+			if mg.version > testCase.initdb {
+				break
+			}
+			_, err = db.Exec(ctx, mg.up)
+			assert.Nil(t, err, fmt.Sprintf("%s: initdb %d_%s", testCase.testName, mg.version, mg.name))
+		}
+
+		applied, err := migrator.Up(ctx)
+		assert.Nil(t, err, testCase.testName)
+		versions := make([]int64, 0, len(applied))
+		for _, m := range applied {
+			versions = append(versions, m.Version)
+		}
+		assert.Equal(t, testCase.expectedApplied, versions, testCase.testName)
+
+		status, err := migrator.Status(ctx)
+		assert.Nil(t, err, testCase.testName)
+		assert.Equal(t, len(migrator.migrations), len(appliedVersions(status)), testCase.testName)
+	}
+}
+
+// newTestDB - returns the pool of the database set by TEST_DATABASE_URL with the search path set to a new
+// schema, which is dropped after the test. The test is skipped without the database
+func newTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	admin, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %s", err.Error())
+	}
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err = admin.Exec(ctx, "CREATE SCHEMA "+name); err != nil {
+		admin.Close()
+		t.Fatalf("creating the test schema: %s", err.Error())
+	}
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parsing TEST_DATABASE_URL: %s", err.Error())
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = name
+	config.ConnConfig.RuntimeParams["timezone"] = "UTC"
+	db, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("connecting to the test schema: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec(context.Background(), "DROP SCHEMA "+name+" CASCADE")
+		admin.Close()
+	})
+	return db
+}
+
+// tableExists - reports whether the table exists in the schema of the test
+func tableExists(t *testing.T, db *pgxpool.Pool, table string) bool {
+	t.Helper()
+	var exists bool
+	if err := db.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+		t.Fatalf("checking the table %s: %s", table, err.Error())
+	}
+	return exists
+}
+
+// appliedVersions - returns the versions of the applied migrations of the status
+func appliedVersions(status []models.Migration) []int64 {
+	versions := make([]int64, 0, len(status))
+	for _, m := range status {
+		if m.AppliedAt != nil {
+			versions = append(versions, m.Version)
+		}
+	}
+	return versions
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
 )
 
 const (
@@ -24,27 +25,97 @@ func NewOrdersRepo(db *pgxpool.Pool) *OrdersRepo {
 	return &OrdersRepo{db: db}
 }
 
-// ChargeFunds - method for charging previously reserved funds
-func (o *OrdersRepo) ChargeFunds(order models.Order) error {
+// ChargeFunds - method for charging previously reserved funds. The funds have already been debited
+// from the balance, so the charge is recorded in the history with zero amount
+func (o *OrdersRepo) ChargeFunds(ctx context.Context, order models.Order) error {
+	tx, err := o.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
 	updateOrderStatus := fmt.Sprintf("UPDATE %s SET %s=$1 WHERE %s=$2 AND %s=$3 AND %s=$4 AND %s=$5 AND %s=$6",
 		tableOrders, columnBlock, columnOrderId, columnUserId, columnServiceId, columnAmount, columnBlock)
-	result, err := o.db.Exec(context.Background(), updateOrderStatus, order.Block, order.OrderID, order.UserID,
+	result, err := tx.Exec(ctx, updateOrderStatus, order.Block, order.OrderID, order.UserID,
 		order.ServiceID, order.Amount, true)
 	if err != nil {
+		tx.Rollback(context.Background())
 		return err
 	}
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
+		tx.Rollback(context.Background())
 		return fmt.Errorf("order does not exist")
 	}
+	reservationID, err := orderTransactionID(ctx, tx, order.OrderID, models.OperationReservation)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	t := models.Transaction{
+		UserID:            order.UserID,
+		Date:              time.Now().UTC().Truncate(time.Second),
+		Message:           order.Comment,
+		Operation:         models.OperationCharge,
+		OrderID:           order.OrderID,
+		ServiceID:         order.ServiceID,
+		ExternalReference: order.ExternalReference,
+		ParentID:          reservationID,
+	}
+	id, err := insertTransaction(ctx, tx, t)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	err = recordEvent(ctx, tx, models.EventOrderCharged, order.UserID, models.OrderEventData{
+		TransactionID: id,
+		OrderID:       order.OrderID,
+		UserID:        order.UserID,
+		ServiceID:     order.ServiceID,
+		Amount:        order.Amount,
+	})
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	// the charge doesn't change the balance, the audit log gets the balance the order was charged with
+	var balance float64
+	getBalance := fmt.Sprintf("SELECT %s FROM %s WHERE %s=$1", columnBalance, tableUsers, columnUserId)
+	if err = tx.QueryRow(ctx, getBalance, order.UserID).Scan(&balance); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err = recordAudit(ctx, tx, map[int]float64{order.UserID: balance}); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
 	return nil
 }
 
+// GetOrderDetail - method returns the order with its status, the name of the service from the catalog
+// and the refunded amount
+func (o *OrdersRepo) GetOrderDetail(ctx context.Context, orderID int) (models.OrderDetail, error) {
+	getOrder := fmt.Sprintf(`SELECT o.%[1]s, o.%[2]s, o.%[3]s, COALESCE(s.%[4]s, ''), o.%[5]s, o.%[6]s,
+		CASE WHEN o.%[7]s THEN $2 WHEN o.%[5]s=0 THEN $3 ELSE $4 END,
+		(SELECT COALESCE(sum(t.%[5]s), 0) FROM %[8]s t WHERE t.%[1]s=o.%[1]s AND t.%[9]s=$5)
+		FROM %[10]s o LEFT JOIN %[11]s s ON s.%[3]s=o.%[3]s WHERE o.%[1]s=$1`,
+		columnOrderId, columnUserId, columnServiceId, columnName, columnAmount, columnDate, columnBlock,
+		tableTransactions, columnOperation, tableOrders, tableServices)
+	order := models.OrderDetail{}
+	err := o.db.QueryRow(ctx, getOrder, orderID, models.OrderReserved, models.OrderCancelled,
+		models.OrderCharged, models.OperationRefund).Scan(&order.OrderID, &order.UserID, &order.ServiceID,
+		&order.ServiceName, &order.Amount, &order.Date, &order.Status, &order.Refunded)
+	return order, err
+}
+
 // GetReport - method for providing a summary report for accounting
-func (o *OrdersRepo) GetReport(report *models.Report) error {
-	getReport := fmt.Sprintf("SELECT %s, sum(%s) FROM %s  WHERE DATE_PART('year',%s)=$1 AND DATE_PART('month',%s)=$2 AND %s<>$3 GROUP BY %s",
+func (o *OrdersRepo) GetReport(ctx context.Context, report *models.Report) error {
+	getReport := fmt.Sprintf("SELECT %s, sum(%s) FROM %s WHERE %s>=$1 AND %s<$2 AND %s<>$3 GROUP BY %s",
 		columnServiceId, columnAmount, tableOrders, columnDate, columnDate, columnAmount, columnServiceId)
-	rows, err := o.db.Query(context.Background(), getReport, report.Year, report.Month, 0)
+	rows, err := o.db.Query(ctx, getReport, report.From, report.To, 0)
 	if err != nil {
 		return err
 	}
@@ -62,3 +133,12 @@ func (o *OrdersRepo) GetReport(report *models.Report) error {
 	}
 	return nil
 }
+
+// GetOpenReservations - method returns the number and the total amount of the reserved orders
+// that are not charged or cancelled yet
+func (o *OrdersRepo) GetOpenReservations(ctx context.Context) (count int64, amount float64, err error) {
+	getReservations := fmt.Sprintf("SELECT count(*), COALESCE(sum(%s), 0) FROM %s WHERE %s=$1",
+		columnAmount, tableOrders, columnBlock)
+	err = o.db.QueryRow(ctx, getReservations, true).Scan(&count, &amount)
+	return count, amount, err
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"sort"
+	"time"
+)
+
+const (
+	tableOutbox       = "outbox"
+	columnOutboxId    = "outbox_id"
+	columnPublishedAt = "published_at"
+	columnClaimId     = "claim_id"
+	// columnClaimedUntil - end of the lease of the claim
+	columnClaimedUntil = "claimed_until"
+	// outboxLockKey - key of the advisory lock held by the replica that claims the events of the outbox
+	outboxLockKey = 38001
+)
+
+// OutboxRepo - object in the repository layer that hands the events of the outbox to the publisher
+type OutboxRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewOutboxRepo - constructor function for OutboxRepo
+func NewOutboxRepo(db *pgxpool.Pool) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+// ClaimOutbox - method claims the oldest unpublished events for the lease, returns the id of the claim
+// and the events in the order they were recorded. Only one batch is claimed at a time, while the claim
+// of another relay is active nothing is returned, so the events are published in order. The claim
+// of a relay that stopped expires and its events are claimed again, so they are published at least once
+func (o *OutboxRepo) ClaimOutbox(ctx context.Context, limit int,
+	lease time.Duration) (string, []models.OutboxMessage, error) {
+	tx, err := o.db.Begin(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	var locked bool
+	err = tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxLockKey).Scan(&locked)
+	if err != nil || !locked {
+		tx.Rollback(context.Background())
+		return "", nil, err
+	}
+	var claimed bool
+	getClaimed := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s IS NULL AND %s>now())",
+		tableOutbox, columnPublishedAt, columnClaimedUntil)
+	err = tx.QueryRow(ctx, getClaimed).Scan(&claimed)
+	if err != nil || claimed {
+		tx.Rollback(context.Background())
+		return "", nil, err
+	}
+	claimID, err := newEventID()
+	if err != nil {
+		tx.Rollback(context.Background())
+		return "", nil, err
+	}
+	claimEvents := fmt.Sprintf(`UPDATE %[1]s SET %[2]s=$1, %[3]s=now() + $2 * interval '1 millisecond'
+		WHERE %[4]s IN (SELECT %[4]s FROM %[1]s WHERE %[5]s IS NULL ORDER BY %[4]s LIMIT $3)
+		RETURNING %[4]s, %[6]s, %[7]s, %[8]s::text, %[9]s, %[10]s`,
+		tableOutbox, columnClaimId, columnClaimedUntil, columnOutboxId, columnPublishedAt, columnEventId,
+		columnEventType, columnUserId, columnPayload, columnCreatedAt)
+	rows, err := tx.Query(ctx, claimEvents, claimID, lease.Milliseconds(), limit)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return "", nil, err
+	}
+	messages := make([]models.OutboxMessage, 0, limit)
+	for rows.Next() {
+		m := models.OutboxMessage{}
+		err = rows.Scan(&m.OutboxID, &m.EventID, &m.EventType, &m.Key, &m.Payload, &m.CreatedAt)
+		if err != nil {
+			rows.Close()
+			tx.Rollback(context.Background())
+			return "", nil, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		tx.Rollback(context.Background())
+		return "", nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		tx.Rollback(context.Background())
+		return "", nil, err
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].OutboxID < messages[j].OutboxID })
+	return claimID, messages, nil
+}
+
+// MarkPublished - method marks the claimed events published. The events claimed again after the claim
+// expired are left to the new claim
+func (o *OutboxRepo) MarkPublished(ctx context.Context, claimID string) error {
+	markPublished := fmt.Sprintf("UPDATE %s SET %s=now(), %s=NULL, %s=NULL WHERE %s=$1 AND %s IS NULL",
+		tableOutbox, columnPublishedAt, columnClaimId, columnClaimedUntil, columnClaimId, columnPublishedAt)
+	_, err := o.db.Exec(ctx, markPublished, claimID)
+	return err
+}
+
+// ReleaseOutbox - method releases the claimed events that were not published, so they are claimed
+// again without waiting for the claim to expire
+func (o *OutboxRepo) ReleaseOutbox(ctx context.Context, claimID string) error {
+	release := fmt.Sprintf("UPDATE %s SET %s=NULL, %s=NULL WHERE %s=$1 AND %s IS NULL",
+		tableOutbox, columnClaimId, columnClaimedUntil, columnClaimId, columnPublishedAt)
+	_, err := o.db.Exec(ctx, release, claimID)
+	return err
+}
+
+// DeletePublished - method removes the events published before the given time, returns their number
+func (o *OutboxRepo) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	deletePublished := fmt.Sprintf("DELETE FROM %s WHERE %s<$1", tableOutbox, columnPublishedAt)
+	result, err := o.db.Exec(ctx, deletePublished, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -2,20 +2,43 @@ package repository
 
 import (
 	"avito/configs"
+	"avito/internal/tracing"
 	"context"
 	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"strconv"
 )
 
-// NewPostgresDB returns the pool for connecting to the database
+// NewPostgresDB returns the pool for connecting to the database.
+// Sessions are pinned to UTC so that timestamps never depend on the server time zone
 func NewPostgresDB(cfg configs.ConfigDB) (*pgxpool.Pool, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=%s",
-		cfg.DbHost, cfg.DbPort, cfg.DbUsername, cfg.DbName, cfg.DbPassword, cfg.DbSslmode)
-	dbPool, err := pgxpool.Connect(context.Background(), dsn)
+	dsn := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s timezone=UTC",
+		cfg.DbHost, cfg.DbPort, cfg.DbUsername, cfg.DbName, cfg.DbSslmode)
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// the password is not a part of the DSN, so it may contain any characters
+	poolConfig.ConnConfig.Password = cfg.DbPassword
+	poolConfig.ConnConfig.ConnectTimeout = cfg.DbConnectTimeout
+	poolConfig.MaxConns = cfg.DbMaxConns
+	poolConfig.MinConns = cfg.DbMinConns
+	poolConfig.MaxConnLifetime = cfg.DbMaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.DbMaxConnIdleTime
+	if cfg.DbStatementTimeout > 0 {
+		timeout := strconv.FormatInt(cfg.DbStatementTimeout.Milliseconds(), 10)
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = timeout
+	}
+	// the executed statements are recorded as the spans of the traced calls
+	poolConfig.ConnConfig.Logger = tracing.NewQueryLogger(cfg.DbHost, cfg.DbPort, cfg.DbName, cfg.DbUsername)
+	poolConfig.ConnConfig.LogLevel = pgx.LogLevelInfo
+	dbPool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, err
 	}
 	if err = dbPool.Ping(context.Background()); err != nil {
+		dbPool.Close()
 		return nil, err
 	}
 	return dbPool, nil
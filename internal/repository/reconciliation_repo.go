@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// ReconciliationRepo - reconciliation object in the repository layer
+type ReconciliationRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewReconciliationRepo - constructor function for ReconciliationRepo
+func NewReconciliationRepo(db *pgxpool.Pool) *ReconciliationRepo {
+	return &ReconciliationRepo{db: db}
+}
+
+// GetBooks - method reads the figures of the reconciliation for the revenue of the period [from, to).
+// All of them are read in one read-only snapshot, so the writes made meanwhile can't show up as discrepancies
+func (r *ReconciliationRepo) GetBooks(ctx context.Context, from, to time.Time) (books models.Books, err error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return books, err
+	}
+	defer tx.Rollback(context.Background())
+	if books.Balances, err = balanceDiscrepancies(ctx, tx); err != nil {
+		return books, err
+	}
+	if books.Orders, err = ordersTotals(ctx, tx); err != nil {
+		return books, err
+	}
+	if books.ChargedRevenue, err = chargedRevenue(ctx, tx, from, to); err != nil {
+		return books, err
+	}
+	if books.LedgerRevenue, err = ledgerRevenue(ctx, tx, from, to); err != nil {
+		return books, err
+	}
+	return books, tx.Commit(ctx)
+}
+
+// balanceDiscrepancies - returns users whose funds, the balance and the amount held for the open
+// orders, do not match the sum of their settled transactions. The open orders are taken from the orders
+// and the open reservations of the history are the ones that are neither charged nor cancelled,
+// so an order whose status does not match the history is reported as well
+func balanceDiscrepancies(ctx context.Context, tx pgx.Tx) ([]models.BalanceDiscrepancy, error) {
+	getDiscrepancies := fmt.Sprintf(`SELECT u.%[1]s, u.%[2]s, COALESCE(o.reserved, 0), COALESCE(t.ledger, 0)
+		FROM %[3]s u
+		LEFT JOIN (SELECT %[1]s, sum(%[4]s) AS reserved FROM %[5]s WHERE %[6]s=$1 GROUP BY %[1]s) o ON o.%[1]s=u.%[1]s
+		LEFT JOIN (SELECT r.%[1]s, sum(r.%[4]s) AS ledger FROM %[7]s r
+			WHERE r.%[8]s<>$2 OR EXISTS (SELECT 1 FROM %[7]s s WHERE s.%[9]s=r.%[10]s)
+			GROUP BY r.%[1]s) t ON t.%[1]s=u.%[1]s
+		WHERE u.%[2]s + COALESCE(o.reserved, 0)<>COALESCE(t.ledger, 0) ORDER BY u.%[1]s`,
+		columnUserId, columnBalance, tableUsers, columnAmount, tableOrders, columnBlock, tableTransactions,
+		columnOperation, columnParentId, columnTransactionId)
+	rows, err := tx.Query(ctx, getDiscrepancies, true, models.OperationReservation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	discrepancies := make([]models.BalanceDiscrepancy, 0)
+	for rows.Next() {
+		d := models.BalanceDiscrepancy{}
+		err = rows.Scan(&d.UserID, &d.Balance, &d.Reserved, &d.Ledger)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies, rows.Err()
+}
+
+// ordersTotals - returns the amount debited from users for services according to the history
+// and the amount of reserved and charged orders
+func ordersTotals(ctx context.Context, tx pgx.Tx) (models.OrdersTotals, error) {
+	var totals models.OrdersTotals
+	getDebited := fmt.Sprintf("SELECT COALESCE(sum(-%s) FILTER (WHERE %s=$1), 0) - COALESCE(sum(%s) FILTER (WHERE %s=$2), 0) FROM %s",
+		columnAmount, columnOperation, columnAmount, columnOperation, tableTransactions)
+	err := tx.QueryRow(ctx, getDebited, models.OperationReservation, models.OperationCancellation).
+		Scan(&totals.Debited)
+	if err != nil {
+		return totals, err
+	}
+	getOrdered := fmt.Sprintf("SELECT COALESCE(sum(%s), 0) FROM %s", columnAmount, tableOrders)
+	err = tx.QueryRow(ctx, getOrdered).Scan(&totals.Ordered)
+	if err != nil {
+		return totals, err
+	}
+	return totals, nil
+}
+
+// chargedRevenue - returns the amount of charged orders for each service for the period [from, to)
+// according to the orders
+func chargedRevenue(ctx context.Context, tx pgx.Tx, from, to time.Time) (map[int]float64, error) {
+	getRevenue := fmt.Sprintf("SELECT %s, sum(%s) FROM %s WHERE %s>=$1 AND %s<$2 AND %s=$3 AND %s>$4 GROUP BY %s",
+		columnServiceId, columnAmount, tableOrders, columnDate, columnDate, columnBlock, columnAmount, columnServiceId)
+	rows, err := tx.Query(ctx, getRevenue, from, to, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revenue := make(map[int]float64)
+	var (
+		serviceID int
+		amount    float64
+	)
+	for rows.Next() {
+		err = rows.Scan(&serviceID, &amount)
+		if err != nil {
+			return nil, err
+		}
+		revenue[serviceID] = amount
+	}
+	return revenue, rows.Err()
+}
+
+// ledgerRevenue - returns the amount charged for each service according to the history
+// for the orders reserved in the period [from, to): the charge is recorded with zero amount,
+// the charged funds are the debit of the reservation it refers to
+func ledgerRevenue(ctx context.Context, tx pgx.Tx, from, to time.Time) (map[int]float64, error) {
+	getRevenue := fmt.Sprintf(`SELECT COALESCE(c.%[1]s, 0), sum(-r.%[2]s) FROM %[3]s c
+		JOIN %[3]s r ON r.%[4]s=c.%[5]s
+		WHERE c.%[6]s=$1 AND r.%[7]s>=$2 AND r.%[7]s<$3 GROUP BY COALESCE(c.%[1]s, 0)`,
+		columnServiceId, columnAmount, tableTransactions, columnTransactionId, columnParentId, columnOperation,
+		columnDate)
+	rows, err := tx.Query(ctx, getRevenue, models.OperationCharge, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revenue := make(map[int]float64)
+	var (
+		serviceID int
+		amount    float64
+	)
+	for rows.Next() {
+		err = rows.Scan(&serviceID, &amount)
+		if err != nil {
+			return nil, err
+		}
+		if amount != 0 {
+			revenue[serviceID] = amount
+		}
+	}
+	return revenue, rows.Err()
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"avito/schema"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGetBooks(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	migrator, err := NewMigrator(db, schema.Migrations, "UTC")
+	assert.Nil(t, err)
+	_, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	users, orders, reconciliation := NewUserRepo(db), NewOrdersRepo(db), NewReconciliationRepo(db)
+
+	now := time.Now().UTC()
+	assert.Nil(t, users.AccrualFunds(ctx, models.AccrualFunds{UserID: 1, Amount: 100}))
+	charged := models.Order{OrderID: 1, UserID: 1, ServiceID: 2, Amount: 30, Date: now, Block: true}
+	assert.Nil(t, users.BlockFunds(ctx, charged))
+	charged.Block = false
+	assert.Nil(t, orders.ChargeFunds(ctx, charged))
+	assert.Nil(t, users.BlockFunds(ctx, models.Order{OrderID: 2, UserID: 1, ServiceID: 2, Amount: 20, Date: now,
+		Block: true}))
+
+	books, err := reconciliation.GetBooks(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	if assert.Nil(t, err) {
+		assert.Empty(t, books.Balances, "balances")
+		assert.Equal(t, models.OrdersTotals{Debited: 50, Ordered: 50}, books.Orders, "orders")
+		assert.Equal(t, map[int]float64{2: 30}, books.ChargedRevenue, "charged revenue")
+		assert.Equal(t, map[int]float64{2: 30}, books.LedgerRevenue, "ledger revenue")
+	}
+
+	// the balance changed behind the history is a discrepancy
+	_, err = db.Exec(ctx, "UPDATE users SET balance=balance+5 WHERE user_id=1")
+	assert.Nil(t, err)
+	books, err = reconciliation.GetBooks(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	if assert.Nil(t, err) && assert.Len(t, books.Balances, 1, "changed balance") {
+		assert.Equal(t, models.BalanceDiscrepancy{UserID: 1, Balance: 55, Reserved: 20, Ledger: 70},
+			books.Balances[0], "changed balance")
+	}
+}
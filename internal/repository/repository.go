@@ -4,27 +4,114 @@ package repository
 
 import (
 	"avito/internal/models"
+	"context"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"io"
+	"time"
 )
 
 // User - Interface describing the user entity
 type User interface {
-	AccrualFunds(ac models.AccrualFunds) error
-	GetBalance(ub *models.UserBalance) (*models.UserBalance, error)
-	BlockFunds(order models.Order) error
-	TransferFunds(t models.Transfer) error
-	UnblockFunds(unblock models.Unblock) error
+	AccrualFunds(ctx context.Context, ac models.AccrualFunds) error
+	GetBalance(ctx context.Context, ub *models.UserBalance) (*models.UserBalance, error)
+	BlockFunds(ctx context.Context, order models.Order) error
+	TransferFunds(ctx context.Context, t models.Transfer) error
+	UnblockFunds(ctx context.Context, unblock *models.Unblock) error
+	AdjustBalance(ctx context.Context, adj models.Adjustment) error
 }
 
 // Transaction - interface describing the transaction object
 type Transaction interface {
-	GetUserTransactions(t models.TransactionListRequest) ([]models.TransactionList, error)
+	GetUserTransactions(ctx context.Context, t models.TransactionListRequest) ([]models.TransactionList, error)
+	SummarizeUserTransactions(ctx context.Context, t models.TransactionListRequest) (models.TransactionSummary, error)
+	GetTransaction(ctx context.Context, id int) (models.TransactionList, error)
+	GetMirrorTransaction(ctx context.Context, tr models.TransactionList) (*models.TransactionList, error)
+	GetOrderReversals(ctx context.Context, orderID, afterID int, operations []string) ([]models.TransactionList, error)
 }
 
 // Order - interface describing the Order object
 type Order interface {
-	ChargeFunds(order models.Order) error
-	GetReport(report *models.Report) error
+	ChargeFunds(ctx context.Context, order models.Order) error
+	GetReport(ctx context.Context, report *models.Report) error
+	GetOrderDetail(ctx context.Context, orderID int) (models.OrderDetail, error)
+	GetOpenReservations(ctx context.Context) (count int64, amount float64, err error)
+}
+
+// Reconciliation - interface describing the reconciliation of the books
+type Reconciliation interface {
+	GetBooks(ctx context.Context, from, to time.Time) (models.Books, error)
+}
+
+// Catalog - interface describing the service catalog
+type Catalog interface {
+	UpsertService(ctx context.Context, s models.ServiceInfo) error
+	GetServices(ctx context.Context) ([]models.ServiceInfo, error)
+}
+
+// Journal - interface describing the source of journal entries
+type Journal interface {
+	GetMovements(ctx context.Context, from, to time.Time) ([]models.Movement, error)
+}
+
+// Export - interface describing streaming bulk exports of the tables
+type Export interface {
+	CopyCSV(ctx context.Context, req models.ExportRequest, w io.Writer) error
+	StreamTransactions(ctx context.Context, req models.ExportRequest, fn func(tr models.TransactionList) error) error
+	StreamOrders(ctx context.Context, req models.ExportRequest, fn func(order models.Order) error) error
+}
+
+// Stream - interface describing the source of the real-time transaction events
+type Stream interface {
+	ListenTransactions(ctx context.Context, fn func(event models.TransactionEvent)) error
+	GetTransactionsAfter(ctx context.Context, userID, afterID, limit int) ([]models.TransactionList, error)
+}
+
+// Webhook - interface describing the webhook subscriptions and the queue of their deliveries
+type Webhook interface {
+	CreateSubscription(ctx context.Context, s *models.WebhookSubscription) error
+	GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int) error
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, a models.DeliveryAttempt) error
+	GetDeliveries(ctx context.Context, f models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, id int64) error
+}
+
+// Outbox - interface describing the outbox of the domain events
+type Outbox interface {
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) (string, []models.OutboxMessage, error)
+	MarkPublished(ctx context.Context, claimID string) error
+	ReleaseOutbox(ctx context.Context, claimID string) error
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Command - interface describing the processed commands of the message broker
+type Command interface {
+	ClaimCommand(ctx context.Context, messageID, commandType string) (models.CommandResult, bool, error)
+	CompleteCommand(ctx context.Context, result models.CommandResult) error
+	ReleaseCommand(ctx context.Context, messageID string) error
+}
+
+// Health - interface describing the checks of the database for the readiness of the service
+type Health interface {
+	Ping(ctx context.Context) error
+	GetPendingMigrations(ctx context.Context) ([]models.Migration, error)
+}
+
+// Auth - interface describing the API keys of the client services
+type Auth interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error
+	GetAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	GetActiveAPIKey(ctx context.Context, hash string) (models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+}
+
+// Audit - interface describing the append-only audit log of the mutating calls
+type Audit interface {
+	AppendAudit(ctx context.Context, e *models.AuditEntry) error
+	ChainAudit(ctx context.Context, limit int, seal func(e *models.AuditEntry)) (int, error)
+	GetAuditEntries(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, error)
+	StreamAudit(ctx context.Context, f models.AuditFilter, fn func(e models.AuditEntry) error) error
 }
 
 // Repository - object responsible for the work of logic with the database
@@ -32,13 +119,35 @@ type Repository struct {
 	User
 	Transaction
 	Order
+	Reconciliation
+	Catalog
+	Journal
+	Export
+	Stream
+	Webhook
+	Outbox
+	Command
+	Health
+	Auth
+	Audit
 }
 
 // NewRepository - constructor function for Repository
 func NewRepository(db *pgxpool.Pool) *Repository {
 	return &Repository{
-		User:        NewUserRepo(db),
-		Transaction: NewTransactionRepo(db),
-		Order:       NewOrdersRepo(db),
+		User:           NewUserRepo(db),
+		Transaction:    NewTransactionRepo(db),
+		Order:          NewOrdersRepo(db),
+		Reconciliation: NewReconciliationRepo(db),
+		Catalog:        NewCatalogRepo(db),
+		Journal:        NewJournalRepo(db),
+		Export:         NewExportRepo(db),
+		Stream:         NewStreamRepo(db),
+		Webhook:        NewWebhookRepo(db),
+		Outbox:         NewOutboxRepo(db),
+		Command:        NewCommandRepo(db),
+		Health:         NewHealthRepo(db),
+		Auth:           NewAuthRepo(db),
+		Audit:          NewAuditRepo(db),
 	}
 }
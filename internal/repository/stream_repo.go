@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"strings"
+)
+
+// channelTransactions - channel to which the trigger publishes new transactions
+const channelTransactions = "transactions"
+
+// StreamRepo - object in the repository layer that receives new transactions from the database
+type StreamRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewStreamRepo - constructor function for StreamRepo
+func NewStreamRepo(db *pgxpool.Pool) *StreamRepo {
+	return &StreamRepo{db: db}
+}
+
+// ListenTransactions - method listens to the notifications about committed transactions on a dedicated
+// connection and passes them to fn until the context is cancelled or the connection fails
+func (s *StreamRepo) ListenTransactions(ctx context.Context, fn func(event models.TransactionEvent)) error {
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	// the listening connection must not return to the pool
+	defer conn.Conn().Close(context.Background())
+	if _, err = conn.Exec(ctx, "LISTEN "+channelTransactions); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var event models.TransactionEvent
+		if err = json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			return fmt.Errorf("invalid notification payload: %w", err)
+		}
+		fn(event)
+	}
+}
+
+// GetTransactionsAfter - method returns the user's transactions with id greater than afterID in the order
+// they were created, at most limit of them
+func (s *StreamRepo) GetTransactionsAfter(ctx context.Context, userID, afterID,
+	limit int) ([]models.TransactionList, error) {
+	getTransactions := fmt.Sprintf("SELECT %s FROM %s WHERE %s=$1 AND %s>$2 ORDER BY %s LIMIT $3",
+		strings.Join(exportColumns[tableTransactions], ", "), tableTransactions, columnUserId, columnTransactionId,
+		columnTransactionId)
+	rows, err := s.db.Query(ctx, getTransactions, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tl := make([]models.TransactionList, 0)
+	for rows.Next() {
+		tr := models.TransactionList{}
+		if err = scanTransaction(rows, &tr); err != nil {
+			return nil, err
+		}
+		tl = append(tl, tr)
+	}
+	return tl, rows.Err()
+}
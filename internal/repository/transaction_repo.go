@@ -3,11 +3,19 @@ package repository
 import (
 	"avito/internal/models"
 	"context"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"strings"
 )
 
+// sortColumns - whitelist of the sort keys of the history and the casts of their cursor values
+var sortColumns = map[string]string{
+	models.SortAmount: "::numeric",
+	models.SortDate:   "::timestamptz",
+}
+
 // TransactionRepo - transaction object in the repository layer
 type TransactionRepo struct {
 	db *pgxpool.Pool
@@ -18,18 +26,37 @@ func NewTransactionRepo(db *pgxpool.Pool) *TransactionRepo {
 	return &TransactionRepo{db: db}
 }
 
-// GetUserTransactions - method to get list of user's transactions
-func (tx *TransactionRepo) GetUserTransactions(t models.TransactionListRequest) ([]models.TransactionList, error) {
-	getTransactionsList := fmt.Sprintf("SELECT * FROM %s WHERE %s=$1",
-		tableTransactions, columnUserId)
-	if strings.Contains(t.OrderBy, columnAmount) || strings.Contains(t.OrderBy, columnDate) {
-		getTransactionsList += fmt.Sprintf(" ORDER BY %s", t.OrderBy)
+// GetUserTransactions - method to get list of user's transactions. Rows are always ordered by the requested
+// keys and transaction_id as a tie-breaker, so the keyset condition of the cursor is stable between pages.
+// One extra row is requested to find out whether there is a next page
+func (tx *TransactionRepo) GetUserTransactions(ctx context.Context,
+	t models.TransactionListRequest) ([]models.TransactionList, error) {
+	filter, args := transactionFilter(t.UserID, t.TransactionFilter)
+	getTransactionsList := fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+		strings.Join(exportColumns[tableTransactions], ", "), tableTransactions, filter)
+	orderBy := make([]string, 0, len(t.Sort)+1)
+	for _, key := range t.Sort {
+		if _, ok := sortColumns[key.Field]; !ok {
+			return nil, fmt.Errorf("unsupported sort key %s", key.Field)
+		}
+		orderBy = append(orderBy, fmt.Sprintf("%s %s", key.Field, sortDirection(key.Direction)))
+	}
+	tieBreaker := models.SortAsc
+	if len(t.Sort) != 0 {
+		tieBreaker = t.Sort[len(t.Sort)-1].Direction
 	}
+	orderBy = append(orderBy, fmt.Sprintf("%s %s", columnTransactionId, sortDirection(tieBreaker)))
+	if t.After != nil {
+		condition, keysetArgs := keysetCondition(t.Sort, tieBreaker, t.After, len(args)+1)
+		getTransactionsList += " AND " + condition
+		args = append(args, keysetArgs...)
+	}
+	getTransactionsList += " ORDER BY " + strings.Join(orderBy, ", ")
 	if t.Limit != 0 {
-		getTransactionsList += fmt.Sprintf(" LIMIT %d", t.Limit)
+		getTransactionsList += fmt.Sprintf(" LIMIT %d", t.Limit+1)
 	}
 	getTransactionsList += fmt.Sprintf(" OFFSET %d", t.Offset)
-	rows, err := tx.db.Query(context.Background(), getTransactionsList, t.UserID)
+	rows, err := tx.db.Query(ctx, getTransactionsList, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -37,11 +64,169 @@ func (tx *TransactionRepo) GetUserTransactions(t models.TransactionListRequest)
 	tl := make([]models.TransactionList, 0, 1)
 	for rows.Next() {
 		tr := models.TransactionList{}
-		err = rows.Scan(&tr.TransactionID, &tr.UserID, &tr.Amount, &tr.Date, &tr.Message)
+		err = scanTransaction(rows, &tr)
 		if err != nil {
 			return nil, err
 		}
 		tl = append(tl, tr)
 	}
-	return tl, nil
+	return tl, rows.Err()
+}
+
+// SummarizeUserTransactions - method returns the number of user's transactions matching the filter
+// and the sums of their incoming and outgoing amounts in a single query
+func (tx *TransactionRepo) SummarizeUserTransactions(ctx context.Context,
+	t models.TransactionListRequest) (models.TransactionSummary, error) {
+	filter, args := transactionFilter(t.UserID, t.TransactionFilter)
+	summarize := fmt.Sprintf("SELECT count(*), COALESCE(sum(%[1]s) FILTER (WHERE %[1]s>0), 0), COALESCE(sum(-%[1]s) FILTER (WHERE %[1]s<0), 0) FROM %[2]s WHERE %[3]s",
+		columnAmount, tableTransactions, filter)
+	var summary models.TransactionSummary
+	err := tx.db.QueryRow(ctx, summarize, args...).Scan(&summary.Count, &summary.Incoming,
+		&summary.Outgoing)
+	return summary, err
+}
+
+// GetTransaction - method returns the transaction by id
+func (tx *TransactionRepo) GetTransaction(ctx context.Context, id int) (models.TransactionList, error) {
+	getTransaction := fmt.Sprintf("SELECT %s FROM %s WHERE %s=$1",
+		strings.Join(exportColumns[tableTransactions], ", "), tableTransactions, columnTransactionId)
+	tr := models.TransactionList{}
+	err := scanTransaction(tx.db.QueryRow(ctx, getTransaction, id), &tr)
+	return tr, err
+}
+
+// GetMirrorTransaction - method returns the other side of the transfer, nil if there is none
+func (tx *TransactionRepo) GetMirrorTransaction(ctx context.Context,
+	tr models.TransactionList) (*models.TransactionList, error) {
+	getMirror := fmt.Sprintf("SELECT %s FROM %s WHERE ",
+		strings.Join(exportColumns[tableTransactions], ", "), tableTransactions)
+	var arg int
+	switch {
+	case tr.Operation == models.OperationTransferOut:
+		getMirror += fmt.Sprintf("%s=$1 AND %s=$2", columnParentId, columnOperation)
+		arg = tr.TransactionID
+	case tr.Operation == models.OperationTransferIn && tr.ParentID != nil:
+		getMirror += fmt.Sprintf("%s=$1 AND %s=$2", columnTransactionId, columnOperation)
+		arg = *tr.ParentID
+	default:
+		return nil, nil
+	}
+	operation := models.OperationTransferOut
+	if tr.Operation == models.OperationTransferOut {
+		operation = models.OperationTransferIn
+	}
+	mirror := &models.TransactionList{}
+	err := scanTransaction(tx.db.QueryRow(ctx, getMirror, arg, operation), mirror)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mirror, nil
+}
+
+// GetOrderReversals - method returns the transactions of the order with the given operations
+// that were made after the transaction with id afterID
+func (tx *TransactionRepo) GetOrderReversals(ctx context.Context, orderID, afterID int,
+	operations []string) ([]models.TransactionList, error) {
+	getReversals := fmt.Sprintf("SELECT %s FROM %s WHERE %s=$1 AND %s>$2 AND %s=ANY($3) ORDER BY %s",
+		strings.Join(exportColumns[tableTransactions], ", "), tableTransactions, columnOrderId, columnTransactionId,
+		columnOperation, columnTransactionId)
+	rows, err := tx.db.Query(ctx, getReversals, orderID, afterID, operations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reversals := make([]models.TransactionList, 0)
+	for rows.Next() {
+		tr := models.TransactionList{}
+		if err = scanTransaction(rows, &tr); err != nil {
+			return nil, err
+		}
+		reversals = append(reversals, tr)
+	}
+	return reversals, rows.Err()
+}
+
+// scanTransaction - scans a row with the transaction columns in the order of exportColumns
+func scanTransaction(row pgx.Row, tr *models.TransactionList) error {
+	return row.Scan(&tr.TransactionID, &tr.UserID, &tr.Amount, &tr.Date, &tr.Message, &tr.Operation, &tr.OrderID,
+		&tr.ServiceID, &tr.CounterpartyID, &tr.ExternalReference, &tr.ParentID, &tr.MessageCode, &tr.MessageParams)
+}
+
+// transactionFilter - builds the condition of the history filter, all values are bound as parameters
+func transactionFilter(userID int, f models.TransactionFilter) (string, []interface{}) {
+	args := []interface{}{userID}
+	conditions := []string{fmt.Sprintf("%s=$1", columnUserId)}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.DateFrom != nil {
+		add(columnDate+">=$%d", *f.DateFrom)
+	}
+	if f.DateTo != nil {
+		add(columnDate+"<$%d", *f.DateTo)
+	}
+	if f.AmountMin != nil {
+		add("abs("+columnAmount+")>=$%d", *f.AmountMin)
+	}
+	if f.AmountMax != nil {
+		add("abs("+columnAmount+")<=$%d", *f.AmountMax)
+	}
+	switch f.Direction {
+	case models.DirectionIn:
+		conditions = append(conditions, columnAmount+">0")
+	case models.DirectionOut:
+		conditions = append(conditions, columnAmount+"<0")
+	}
+	if f.Operation != "" {
+		add(columnOperation+"=$%d", f.Operation)
+	}
+	if f.OrderID != 0 {
+		add(columnOrderId+"=$%d", f.OrderID)
+	}
+	if f.CounterpartyID != 0 {
+		add(columnCounterpart+"=$%d", f.CounterpartyID)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// keysetCondition - builds the condition selecting rows after the cursor for the sort keys with any
+// combination of directions: (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ... OR (k1 = v1 AND ... AND id > last id)
+func keysetCondition(sort []models.SortKey, tieBreaker string, after *models.PageCursor,
+	firstArg int) (string, []interface{}) {
+	args := make([]interface{}, 0, len(sort)+1)
+	equal := make([]string, 0, len(sort))
+	alternatives := make([]string, 0, len(sort)+1)
+	for i, key := range sort {
+		placeholder := fmt.Sprintf("$%d%s", firstArg+i, sortColumns[key.Field])
+		args = append(args, after.Values[i])
+		alternative := append(append([]string{}, equal...),
+			fmt.Sprintf("%s %s %s", key.Field, keysetOperator(key.Direction), placeholder))
+		alternatives = append(alternatives, "("+strings.Join(alternative, " AND ")+")")
+		equal = append(equal, fmt.Sprintf("%s = %s", key.Field, placeholder))
+	}
+	args = append(args, after.TransactionID)
+	alternative := append(equal, fmt.Sprintf("%s %s $%d", columnTransactionId, keysetOperator(tieBreaker),
+		firstArg+len(sort)))
+	alternatives = append(alternatives, "("+strings.Join(alternative, " AND ")+")")
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// sortDirection - converts the validated direction to SQL
+func sortDirection(direction string) string {
+	if direction == models.SortDesc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// keysetOperator - comparison that selects rows following the cursor in the given direction
+func keysetOperator(direction string) string {
+	if direction == models.SortDesc {
+		return "<"
+	}
+	return ">"
 }
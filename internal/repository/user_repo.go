@@ -5,23 +5,43 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"strconv"
 	"time"
 )
 
 const (
-	tableUsers        = "users"
-	columnBalance     = "balance"
-	columnUserId      = "user_id"
-	tableTransactions = "transactions"
-	columnAmount      = "amount"
-	columnDate        = "date_time"
-	columnMessage     = "message"
+	tableUsers          = "users"
+	columnBalance       = "balance"
+	columnUserId        = "user_id"
+	tableTransactions   = "transactions"
+	columnAmount        = "amount"
+	columnDate          = "date_time"
+	columnMessage       = "message"
+	columnCounterpart   = "counterparty_user_id"
+	columnOperation     = "operation"
+	columnExternalRef   = "external_reference"
+	columnParentId      = "parent_transaction_id"
+	columnMessageCode   = "message_code"
+	columnMessageParams = "message_params"
+
+	messageAccrual             = "replenishment of the balance"
+	messageServicePayment      = "service payment"
+	messageServiceCancellation = "cancellation of service payment"
+	messageTransferOut         = "outgoing transfer to the user %d"
+	messageTransferIn          = "incoming transfer from user %d"
+	messageServiceCharge       = "charge of service payment"
+	messageRefund              = "refund for the order %d"
 )
 
 var (
 	errInsertRow = errors.New("failed to insert data into database")
 	errUpdate    = errors.New("data update error")
+	// ErrRefund - the refund is not possible for the order
+	ErrRefund = errors.New("refund is not possible")
+	// ErrAdjustment - the adjustment is not possible for the user
+	ErrAdjustment = errors.New("adjustment is not possible")
 )
 
 // UserRepo - user object in the repository layer
@@ -34,39 +54,72 @@ func NewUserRepo(db *pgxpool.Pool) *UserRepo {
 	return &UserRepo{db: db}
 }
 
-// AccrualFunds - method of accruing cash to the balance
-func (u *UserRepo) AccrualFunds(ac models.AccrualFunds) error {
-	tx, err := u.db.Begin(context.Background())
+// AccrualFunds - method of accruing cash to the balance. A refund is accepted only for a charged order
+// of the same user and the refunds of the order must not exceed its amount
+func (u *UserRepo) AccrualFunds(ctx context.Context, ac models.AccrualFunds) error {
+	tx, err := u.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	updateUserBalance := fmt.Sprintf("UPDATE %s SET %s=%s+$1 WHERE %s=$2",
-		tableUsers, columnBalance, columnBalance, columnUserId)
-	result, err := tx.Exec(context.Background(), updateUserBalance, ac.Amount, ac.UserID)
-	if err != nil {
-		tx.Rollback(context.Background())
-		return err
-	}
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		err = u.addUser(ac)
+	t := models.Transaction{
+		UserID:            ac.UserID,
+		Amount:            ac.Amount,
+		Date:              time.Now().UTC().Truncate(time.Second),
+		Message:           ac.Comment,
+		Operation:         models.OperationAccrual,
+		ExternalReference: ac.ExternalReference,
+	}
+	if ac.Operation == models.OperationRefund {
+		t.ServiceID, err = checkRefund(ctx, tx, ac)
+		if err != nil {
+			tx.Rollback(context.Background())
+			return err
+		}
+		t.Operation = models.OperationRefund
+		t.OrderID = ac.OrderID
+		t.ParentID, err = orderTransactionID(ctx, tx, ac.OrderID, models.OperationCharge)
 		if err != nil {
 			tx.Rollback(context.Background())
 			return err
 		}
 	}
-	t := models.Transaction{
-		UserID:  ac.UserID,
-		Amount:  ac.Amount,
-		Date:    time.Now().Truncate(time.Second),
-		Message: ac.Message,
+	updateUserBalance := fmt.Sprintf("UPDATE %s SET %s=%s+$1 WHERE %s=$2 RETURNING %s",
+		tableUsers, columnBalance, columnBalance, columnUserId, columnBalance)
+	var balance float64
+	err = tx.QueryRow(ctx, updateUserBalance, ac.Amount, ac.UserID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = addUser(ctx, tx, ac)
+		balance = ac.Amount
+	}
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
 	}
-	err = u.addTransaction(t)
+	id, err := insertTransaction(ctx, tx, t)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	err = tx.Commit(context.Background())
+	eventType := models.EventFundsAccrued
+	if t.Operation == models.OperationRefund {
+		eventType = models.EventFundsRefunded
+	}
+	err = recordEvent(ctx, tx, eventType, t.UserID, models.FundsEventData{
+		TransactionID:     id,
+		UserID:            t.UserID,
+		Amount:            t.Amount,
+		OrderID:           t.OrderID,
+		ExternalReference: t.ExternalReference,
+	})
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err = recordAudit(ctx, tx, map[int]float64{ac.UserID: balance}); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	err = tx.Commit(ctx)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
@@ -74,50 +127,156 @@ func (u *UserRepo) AccrualFunds(ac models.AccrualFunds) error {
 	return nil
 }
 
-// BlockFunds - method of reserving funds from the main balance in a separate account
-func (u *UserRepo) BlockFunds(order models.Order) error {
-	tx, err := u.db.Begin(context.Background())
+// checkRefund - locks the refunded order and checks that the refund is possible, returns the service of the order
+func checkRefund(ctx context.Context, tx pgx.Tx, ac models.AccrualFunds) (serviceID int, err error) {
+	var (
+		userID  int
+		amount  float64
+		blocked bool
+	)
+	getOrder := fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s WHERE %s=$1 FOR UPDATE",
+		columnUserId, columnServiceId, columnAmount, columnBlock, tableOrders, columnOrderId)
+	err = tx.QueryRow(ctx, getOrder, ac.OrderID).Scan(&userID, &serviceID, &amount, &blocked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: order %d does not exist", ErrRefund, ac.OrderID)
+	}
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if userID != ac.UserID {
+		return 0, fmt.Errorf("%w: order %d does not belong to the user %d", ErrRefund, ac.OrderID, ac.UserID)
 	}
-	updateUserBalance := fmt.Sprintf("UPDATE %s SET %s=%s-$1 WHERE %s=$2",
-		tableUsers, columnBalance, columnBalance, columnUserId)
-	result, err := tx.Exec(context.Background(), updateUserBalance, order.Amount, order.UserID)
+	if blocked || amount == 0 {
+		return 0, fmt.Errorf("%w: order %d has not been charged", ErrRefund, ac.OrderID)
+	}
+	var refunded float64
+	getRefunded := fmt.Sprintf("SELECT COALESCE(sum(%s), 0) FROM %s WHERE %s=$1 AND %s=$2",
+		columnAmount, tableTransactions, columnOrderId, columnOperation)
+	err = tx.QueryRow(ctx, getRefunded, ac.OrderID, models.OperationRefund).Scan(&refunded)
+	if err != nil {
+		return 0, err
+	}
+	if refunded+ac.Amount > amount {
+		return 0, fmt.Errorf("%w: refunds of the order %d would exceed its amount %.2f, already refunded %.2f",
+			ErrRefund, ac.OrderID, amount, refunded)
+	}
+	return serviceID, nil
+}
+
+// BlockFunds - method of reserving funds from the main balance in a separate account
+func (u *UserRepo) BlockFunds(ctx context.Context, order models.Order) error {
+	tx, err := u.db.Begin(ctx)
 	if err != nil {
-		tx.Rollback(context.Background())
 		return err
 	}
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
+	updateUserBalance := fmt.Sprintf("UPDATE %s SET %s=%s-$1 WHERE %s=$2 RETURNING %s",
+		tableUsers, columnBalance, columnBalance, columnUserId, columnBalance)
+	var balance float64
+	err = tx.QueryRow(ctx, updateUserBalance, order.Amount, order.UserID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
 		tx.Rollback(context.Background())
 		return fmt.Errorf("user with id %d does not exist", order.UserID)
 	}
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
 
 	createOrder := fmt.Sprintf("INSERT INTO %s VALUES ($1, $2, $3, $4, $5, $6)", tableOrders)
-	result, err = tx.Exec(context.Background(), createOrder, order.OrderID, order.UserID, order.ServiceID,
+	result, err := tx.Exec(ctx, createOrder, order.OrderID, order.UserID, order.ServiceID,
 		order.Amount, order.Date, order.Block)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	rowsAffected = result.RowsAffected()
+	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
 		tx.Rollback(context.Background())
 		return errInsertRow
 	}
 
 	t := models.Transaction{
-		UserID:  order.UserID,
-		Amount:  -order.Amount,
-		Date:    order.Date,
-		Message: "service payment",
+		UserID:            order.UserID,
+		Amount:            -order.Amount,
+		Date:              order.Date,
+		Message:           order.Comment,
+		Operation:         models.OperationReservation,
+		OrderID:           order.OrderID,
+		ServiceID:         order.ServiceID,
+		ExternalReference: order.ExternalReference,
+	}
+	id, err := insertTransaction(ctx, tx, t)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	err = recordEvent(ctx, tx, models.EventOrderReserved, order.UserID, models.OrderEventData{
+		TransactionID: id,
+		OrderID:       order.OrderID,
+		UserID:        order.UserID,
+		ServiceID:     order.ServiceID,
+		Amount:        order.Amount,
+	})
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err = recordAudit(ctx, tx, map[int]float64{order.UserID: balance}); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	return nil
+}
+
+// AdjustBalance - method corrects the user's balance by the amount and records the adjustment in the history
+func (u *UserRepo) AdjustBalance(ctx context.Context, adj models.Adjustment) error {
+	tx, err := u.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// the negative adjustment is applied only while the balance covers it
+	updateUserBalance := fmt.Sprintf("UPDATE %s SET %s=%s+$1 WHERE %s=$2 AND %s+$1>=0 RETURNING %s",
+		tableUsers, columnBalance, columnBalance, columnUserId, columnBalance, columnBalance)
+	var balance float64
+	err = tx.QueryRow(ctx, updateUserBalance, adj.Amount, adj.UserID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = checkAdjustment(ctx, tx, adj)
+	}
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	t := models.Transaction{
+		UserID:    adj.UserID,
+		Amount:    adj.Amount,
+		Date:      time.Now().UTC().Truncate(time.Second),
+		Message:   adj.Comment,
+		Operation: models.OperationAdjustment,
 	}
-	err = u.addTransaction(t)
+	id, err := insertTransaction(ctx, tx, t)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	err = tx.Commit(context.Background())
+	err = recordEvent(ctx, tx, models.EventBalanceAdjusted, adj.UserID, models.FundsEventData{
+		TransactionID: id,
+		UserID:        adj.UserID,
+		Amount:        adj.Amount,
+	})
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	if err = recordAudit(ctx, tx, map[int]float64{adj.UserID: balance}); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	err = tx.Commit(ctx)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
@@ -125,11 +284,26 @@ func (u *UserRepo) BlockFunds(order models.Order) error {
 	return nil
 }
 
+// checkAdjustment - returns the reason the balance of the user was not adjusted
+func checkAdjustment(ctx context.Context, tx pgx.Tx, adj models.Adjustment) error {
+	var balance float64
+	getBalance := fmt.Sprintf("SELECT %s FROM %s WHERE %s=$1", columnBalance, tableUsers, columnUserId)
+	err := tx.QueryRow(ctx, getBalance, adj.UserID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: user with id %d does not exist", ErrAdjustment, adj.UserID)
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: the balance %.2f of the user %d is less than the debit %.2f",
+		ErrAdjustment, balance, adj.UserID, -adj.Amount)
+}
+
 // GetBalance - method to get user balance
-func (u *UserRepo) GetBalance(ub *models.UserBalance) (*models.UserBalance, error) {
+func (u *UserRepo) GetBalance(ctx context.Context, ub *models.UserBalance) (*models.UserBalance, error) {
 	updateUserBalance := fmt.Sprintf("SELECT %s FROM %s WHERE %s=$1",
 		columnBalance, tableUsers, columnUserId)
-	row := u.db.QueryRow(context.Background(), updateUserBalance, ub.UserID)
+	row := u.db.QueryRow(ctx, updateUserBalance, ub.UserID)
 	err := row.Scan(&ub.Balance)
 	if err != nil {
 		return ub, err
@@ -138,59 +312,82 @@ func (u *UserRepo) GetBalance(ub *models.UserBalance) (*models.UserBalance, erro
 }
 
 // TransferFunds - method for transferring funds between users
-func (u *UserRepo) TransferFunds(t models.Transfer) error {
-	tx, err := u.db.Begin(context.Background())
-	if err != nil {
-		tx.Rollback(context.Background())
-		return err
-	}
-	updateSenderBalance := fmt.Sprintf("UPDATE %s SET %s=%s-$1 WHERE %s=$2",
-		tableUsers, columnBalance, columnBalance, columnUserId)
-	result, err := tx.Exec(context.Background(), updateSenderBalance, t.Amount, t.SenderID)
+func (u *UserRepo) TransferFunds(ctx context.Context, t models.Transfer) error {
+	tx, err := u.db.Begin(ctx)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
+	updateSenderBalance := fmt.Sprintf("UPDATE %s SET %s=%s-$1 WHERE %s=$2 RETURNING %s",
+		tableUsers, columnBalance, columnBalance, columnUserId, columnBalance)
+	balances := make(map[int]float64, 2)
+	var balance float64
+	err = tx.QueryRow(ctx, updateSenderBalance, t.Amount, t.SenderID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
 		tx.Rollback(context.Background())
 		return fmt.Errorf("user with id %d does not exist", t.SenderID)
 	}
-	tr := models.Transaction{
-		UserID:  t.SenderID,
-		Amount:  -t.Amount,
-		Date:    time.Now().Truncate(time.Second),
-		Message: fmt.Sprintf("outgoing transfer to the user %d", t.ReceiverID),
-	}
-	err = u.addTransaction(tr)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	updateReceiverBalance := fmt.Sprintf("UPDATE %s SET %s=%s+$1 WHERE %s=$2",
-		tableUsers, columnBalance, columnBalance, columnUserId)
-	result, err = tx.Exec(context.Background(), updateReceiverBalance, t.Amount, t.ReceiverID)
+	balances[t.SenderID] = balance
+	date := time.Now().UTC().Truncate(time.Second)
+	tr := models.Transaction{
+		UserID:         t.SenderID,
+		Amount:         -t.Amount,
+		Date:           date,
+		Message:        t.Comment,
+		Operation:      models.OperationTransferOut,
+		CounterpartyID: t.ReceiverID,
+	}
+	parentID, err := insertTransaction(ctx, tx, tr)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	rowsAffected = result.RowsAffected()
-	if rowsAffected == 0 {
+	updateReceiverBalance := fmt.Sprintf("UPDATE %s SET %s=%s+$1 WHERE %s=$2 RETURNING %s",
+		tableUsers, columnBalance, columnBalance, columnUserId, columnBalance)
+	err = tx.QueryRow(ctx, updateReceiverBalance, t.Amount, t.ReceiverID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
 		tx.Rollback(context.Background())
 		return fmt.Errorf("user with id %d does not exist", t.ReceiverID)
 	}
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	balances[t.ReceiverID] = balance
 	tr = models.Transaction{
-		UserID:  t.ReceiverID,
-		Amount:  t.Amount,
-		Date:    time.Now().Truncate(time.Second),
-		Message: fmt.Sprintf("incoming transfer from user %d", t.SenderID),
+		UserID:         t.ReceiverID,
+		Amount:         t.Amount,
+		Date:           date,
+		Message:        t.Comment,
+		Operation:      models.OperationTransferIn,
+		CounterpartyID: t.SenderID,
+		ParentID:       parentID,
+	}
+	_, err = insertTransaction(ctx, tx, tr)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
 	}
-	err = u.addTransaction(tr)
+	// the transfer changes both balances, the event is recorded for each of the users
+	err = recordEvents(ctx, tx, models.EventTransferCompleted, []int{t.SenderID, t.ReceiverID}, models.TransferEventData{
+		TransactionID: parentID,
+		SenderID:      t.SenderID,
+		ReceiverID:    t.ReceiverID,
+		Amount:        t.Amount,
+	})
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	err = tx.Commit(context.Background())
+	if err = recordAudit(ctx, tx, balances); err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	err = tx.Commit(ctx)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
@@ -199,24 +396,25 @@ func (u *UserRepo) TransferFunds(t models.Transfer) error {
 }
 
 // UnblockFunds - method of reserving money if it was not possible to apply the service
-func (u *UserRepo) UnblockFunds(unblock models.Unblock) error {
-	tx, err := u.db.Begin(context.Background())
+func (u *UserRepo) UnblockFunds(ctx context.Context, unblock *models.Unblock) error {
+	tx, err := u.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	updateUserBalance := fmt.Sprintf("UPDATE %s SET %s=%s+%s.%s FROM %s WHERE %s.%s=%s.%s AND %s.%s=$1 AND %s.%s=$2 RETURNING %s.%s, %s.%s",
+	updateUserBalance := fmt.Sprintf("UPDATE %s SET %s=%s+%s.%s FROM %s WHERE %s.%s=%s.%s AND %s.%s=$1 AND %s.%s=$2 RETURNING %s.%s, %s.%s, %s.%s, %s.%s",
 		tableUsers, columnBalance, columnBalance, tableOrders, columnAmount, tableOrders, tableUsers,
 		columnUserId, tableOrders, columnUserId, tableOrders, columnOrderId, tableOrders, columnBlock, tableUsers, columnUserId,
-		tableOrders, columnAmount)
-	row := tx.QueryRow(context.Background(), updateUserBalance, unblock.OrderID, true)
-	err = row.Scan(&unblock.UserID, &unblock.Amount)
+		tableOrders, columnAmount, tableOrders, columnServiceId, tableUsers, columnBalance)
+	var balance float64
+	row := tx.QueryRow(ctx, updateUserBalance, unblock.OrderID, true)
+	err = row.Scan(&unblock.UserID, &unblock.Amount, &unblock.ServiceID, &balance)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
 	updateOrderStatus := fmt.Sprintf("UPDATE %s SET %s=$1, %s=$2 WHERE %s=$3",
 		tableOrders, columnAmount, columnBlock, columnOrderId)
-	result, err := tx.Exec(context.Background(), updateOrderStatus, 0, false, unblock.OrderID)
+	result, err := tx.Exec(ctx, updateOrderStatus, 0, false, unblock.OrderID)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
@@ -226,46 +424,42 @@ func (u *UserRepo) UnblockFunds(unblock models.Unblock) error {
 		tx.Rollback(context.Background())
 		return errUpdate
 	}
-	t := models.Transaction{
-		UserID:  unblock.UserID,
-		Amount:  unblock.Amount,
-		Date:    time.Now().Truncate(time.Second),
-		Message: "cancellation of service payment",
-	}
-	err = u.addTransaction(t)
+	reservationID, err := orderTransactionID(ctx, tx, unblock.OrderID, models.OperationReservation)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	err = tx.Commit(context.Background())
+	t := models.Transaction{
+		UserID:    unblock.UserID,
+		Amount:    unblock.Amount,
+		Date:      time.Now().UTC().Truncate(time.Second),
+		Message:   unblock.Comment,
+		Operation: models.OperationCancellation,
+		OrderID:   unblock.OrderID,
+		ServiceID: unblock.ServiceID,
+		ParentID:  reservationID,
+	}
+	id, err := insertTransaction(ctx, tx, t)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	return nil
-}
-
-// addTransaction - adds information about the new transaction to the database
-func (u *UserRepo) addTransaction(t models.Transaction) error {
-	tx, err := u.db.Begin(context.Background())
+	err = recordEvent(ctx, tx, models.EventOrderCancelled, unblock.UserID, models.OrderEventData{
+		TransactionID: id,
+		OrderID:       unblock.OrderID,
+		UserID:        unblock.UserID,
+		ServiceID:     unblock.ServiceID,
+		Amount:        unblock.Amount,
+	})
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	insertTx := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) VALUES ($1, $2, $3, $4)",
-		tableTransactions, columnUserId, columnAmount, columnDate, columnMessage)
-	result, err := tx.Exec(context.Background(), insertTx, t.UserID, t.Amount, t.Date, t.Message)
-	if err != nil {
+	if err = recordAudit(ctx, tx, map[int]float64{unblock.UserID: balance}); err != nil {
 		tx.Rollback(context.Background())
 		return err
 	}
-	rowsAffected := result.RowsAffected()
-	if rowsAffected != 1 {
-		tx.Rollback(context.Background())
-		return errInsertRow
-
-	}
-	err = tx.Commit(context.Background())
+	err = tx.Commit(ctx)
 	if err != nil {
 		tx.Rollback(context.Background())
 		return err
@@ -273,29 +467,82 @@ func (u *UserRepo) addTransaction(t models.Transaction) error {
 	return nil
 }
 
-// addUser - method for inserting a new user with replenished balance
-func (u *UserRepo) addUser(ac models.AccrualFunds) error {
-	tx, err := u.db.Begin(context.Background())
+// insertTransaction - adds information about the new transaction to the database within the transaction
+// that changes the balance, so the history and the balances can't diverge. Without the comment of the caller
+// the default message is written with its code and parameters, from which the description is rendered
+// at read time. Returns the id of the transaction
+func insertTransaction(ctx context.Context, tx pgx.Tx, t models.Transaction) (id int, err error) {
+	var params interface{}
+	if t.Message == "" {
+		t.Message, t.MessageCode = defaultMessage(t), t.Operation
+		params = messageParams(t)
+	}
+	insertTx := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s) VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), NULLIF($8, 0), NULLIF($9, ''), NULLIF($10, 0), NULLIF($11, ''), $12) RETURNING %s",
+		tableTransactions, columnUserId, columnAmount, columnDate, columnMessage, columnOperation, columnOrderId,
+		columnServiceId, columnCounterpart, columnExternalRef, columnParentId, columnMessageCode, columnMessageParams,
+		columnTransactionId)
+	err = tx.QueryRow(ctx, insertTx, t.UserID, t.Amount, t.Date, t.Message, t.Operation,
+		t.OrderID, t.ServiceID, t.CounterpartyID, t.ExternalReference, t.ParentID, t.MessageCode, params).Scan(&id)
 	if err != nil {
-		tx.Rollback(context.Background())
-		return err
+		return 0, err
 	}
+	return id, nil
+}
+
+// defaultMessage - the message stored for the operation when the caller did not supply a comment
+func defaultMessage(t models.Transaction) string {
+	switch t.Operation {
+	case models.OperationReservation:
+		return messageServicePayment
+	case models.OperationCharge:
+		return messageServiceCharge
+	case models.OperationCancellation:
+		return messageServiceCancellation
+	case models.OperationTransferOut:
+		return fmt.Sprintf(messageTransferOut, t.CounterpartyID)
+	case models.OperationTransferIn:
+		return fmt.Sprintf(messageTransferIn, t.CounterpartyID)
+	case models.OperationRefund:
+		return fmt.Sprintf(messageRefund, t.OrderID)
+	}
+	return messageAccrual
+}
+
+// messageParams - parameters of the message template, only the links of the transaction are stored
+func messageParams(t models.Transaction) map[string]string {
+	params := make(map[string]string)
+	for key, id := range map[string]int{
+		columnOrderId:     t.OrderID,
+		columnServiceId:   t.ServiceID,
+		columnCounterpart: t.CounterpartyID,
+	} {
+		if id != 0 {
+			params[key] = strconv.Itoa(id)
+		}
+	}
+	return params
+}
+
+// orderTransactionID - returns the id of the first transaction of the order with the given operation,
+// zero if there is none
+func orderTransactionID(ctx context.Context, tx pgx.Tx, orderID int, operation string) (id int, err error) {
+	getID := fmt.Sprintf("SELECT COALESCE(min(%s), 0) FROM %s WHERE %s=$1 AND %s=$2",
+		columnTransactionId, tableTransactions, columnOrderId, columnOperation)
+	err = tx.QueryRow(ctx, getID, orderID, operation).Scan(&id)
+	return id, err
+}
+
+// addUser - method for inserting a new user with replenished balance
+func addUser(ctx context.Context, tx pgx.Tx, ac models.AccrualFunds) error {
 	insertUser := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2)",
 		tableUsers, columnUserId, columnBalance)
-	result, err := tx.Exec(context.Background(), insertUser, ac.UserID, ac.Amount)
+	result, err := tx.Exec(ctx, insertUser, ac.UserID, ac.Amount)
 	if err != nil {
-		tx.Rollback(context.Background())
 		return err
 	}
 	rowsAffected := result.RowsAffected()
 	if rowsAffected != 1 {
-		tx.Rollback(context.Background())
 		return errInsertRow
 	}
-	err = tx.Commit(context.Background())
-	if err != nil {
-		tx.Rollback(context.Background())
-		return err
-	}
 	return nil
 }
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"avito/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"strings"
+	"time"
+)
+
+const (
+	tableSubscriptions   = "webhook_subscriptions"
+	tableDeliveries      = "webhook_deliveries"
+	columnSubscriptionId = "subscription_id"
+	columnDeliveryId     = "delivery_id"
+	columnURL            = "url"
+	columnEventTypes     = "event_types"
+	columnSecret         = "secret"
+	columnCreatedAt      = "created_at"
+	columnDeletedAt      = "deleted_at"
+	columnEventId        = "event_id"
+	columnEventType      = "event_type"
+	columnPayload        = "payload"
+	columnStatus         = "status"
+	columnAttempts       = "attempts"
+	columnNextAttemptAt  = "next_attempt_at"
+	columnLastStatusCode = "last_status_code"
+	columnLastError      = "last_error"
+	columnDeliveredAt    = "delivered_at"
+)
+
+// deliveryColumns - columns of the deliveries in the order of scanDelivery
+var deliveryColumns = []string{columnDeliveryId, columnSubscriptionId, columnEventId, columnEventType, columnPayload,
+	columnStatus, columnAttempts, columnNextAttemptAt, columnLastStatusCode, columnLastError, columnCreatedAt,
+	columnDeliveredAt}
+
+// WebhookRepo - webhook subscriptions and deliveries object in the repository layer
+type WebhookRepo struct {
+	db *pgxpool.Pool
+}
+
+// NewWebhookRepo - constructor function for WebhookRepo
+func NewWebhookRepo(db *pgxpool.Pool) *WebhookRepo {
+	return &WebhookRepo{db: db}
+}
+
+// CreateSubscription - method adds the subscription and sets its id and creation time
+func (w *WebhookRepo) CreateSubscription(ctx context.Context, s *models.WebhookSubscription) error {
+	createSubscription := fmt.Sprintf("INSERT INTO %s (%s, %s, %s) VALUES ($1, $2, $3) RETURNING %s, %s",
+		tableSubscriptions, columnURL, columnEventTypes, columnSecret, columnSubscriptionId, columnCreatedAt)
+	return w.db.QueryRow(ctx, createSubscription, s.URL, s.EventTypes, s.Secret).
+		Scan(&s.SubscriptionID, &s.CreatedAt)
+}
+
+// GetSubscriptions - method returns the active subscriptions without their secrets
+func (w *WebhookRepo) GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	getSubscriptions := fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s WHERE %s IS NULL ORDER BY %s",
+		columnSubscriptionId, columnURL, columnEventTypes, columnCreatedAt, tableSubscriptions, columnDeletedAt,
+		columnSubscriptionId)
+	rows, err := w.db.Query(ctx, getSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subscriptions := make([]models.WebhookSubscription, 0)
+	for rows.Next() {
+		s := models.WebhookSubscription{}
+		if err = rows.Scan(&s.SubscriptionID, &s.URL, &s.EventTypes, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// DeleteSubscription - method deactivates the subscription and dead-letters its pending deliveries,
+// the delivered ones are kept for the history
+func (w *WebhookRepo) DeleteSubscription(ctx context.Context, id int) error {
+	tx, err := w.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	deleteSubscription := fmt.Sprintf("UPDATE %s SET %s=now() WHERE %s=$1 AND %s IS NULL",
+		tableSubscriptions, columnDeletedAt, columnSubscriptionId, columnDeletedAt)
+	result, err := tx.Exec(ctx, deleteSubscription, id)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		tx.Rollback(context.Background())
+		return pgx.ErrNoRows
+	}
+	cancelDeliveries := fmt.Sprintf("UPDATE %s SET %s=$1, %s=$2 WHERE %s=$3 AND %s=$4",
+		tableDeliveries, columnStatus, columnLastError, columnSubscriptionId, columnStatus)
+	_, err = tx.Exec(ctx, cancelDeliveries, models.DeliveryDead, "subscription deleted", id,
+		models.DeliveryPending)
+	if err != nil {
+		tx.Rollback(context.Background())
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ClaimDeliveries - method takes the due pending deliveries with the url and the secret of the subscription.
+// The next attempt of the claimed deliveries is postponed by the lease, so other replicas skip them
+// while they are being delivered and pick them up again if this replica fails
+func (w *WebhookRepo) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery,
+	error) {
+	claimDeliveries := fmt.Sprintf(`WITH due AS (
+			SELECT %[1]s FROM %[2]s WHERE %[3]s=$1 AND %[4]s<=now() ORDER BY %[1]s LIMIT $2 FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE %[2]s d SET %[4]s=now()+$3*interval '1 second' FROM due WHERE d.%[1]s=due.%[1]s RETURNING d.*
+		)
+		SELECT c.%[5]s, s.%[6]s, s.%[7]s FROM claimed c JOIN %[8]s s ON s.%[9]s=c.%[9]s ORDER BY c.%[1]s`,
+		columnDeliveryId, tableDeliveries, columnStatus, columnNextAttemptAt,
+		strings.Join(deliveryColumns, ", c."), columnURL, columnSecret, tableSubscriptions, columnSubscriptionId)
+	rows, err := w.db.Query(ctx, claimDeliveries, models.DeliveryPending, limit,
+		int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := make([]models.WebhookDelivery, 0, limit)
+	for rows.Next() {
+		d := models.WebhookDelivery{}
+		if err = scanDelivery(rows, &d, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt - method saves the result of the delivery attempt, unless the delivery has been
+// dead-lettered meanwhile because its subscription was deleted
+func (w *WebhookRepo) RecordAttempt(ctx context.Context, a models.DeliveryAttempt) error {
+	recordAttempt := fmt.Sprintf(`UPDATE %s SET %s=%s+1, %s=$1, %s=NULLIF($2, 0), %s=NULLIF($3, ''), %s=$4,
+		%s=CASE WHEN $1=$5 THEN now() END WHERE %s=$6 AND %s=$7`,
+		tableDeliveries, columnAttempts, columnAttempts, columnStatus, columnLastStatusCode, columnLastError,
+		columnNextAttemptAt, columnDeliveredAt, columnDeliveryId, columnStatus)
+	_, err := w.db.Exec(ctx, recordAttempt, a.Status, a.StatusCode, a.Error, a.NextAttemptAt,
+		models.DeliveryDelivered, a.DeliveryID, models.DeliveryPending)
+	return err
+}
+
+// GetDeliveries - method returns the latest deliveries matching the filter
+func (w *WebhookRepo) GetDeliveries(ctx context.Context, f models.WebhookDeliveryFilter) ([]models.WebhookDelivery,
+	error) {
+	args := make([]interface{}, 0, 3)
+	conditions := []string{"true"}
+	if f.SubscriptionID != 0 {
+		args = append(args, f.SubscriptionID)
+		conditions = append(conditions, fmt.Sprintf("%s=$%d", columnSubscriptionId, len(args)))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conditions = append(conditions, fmt.Sprintf("%s=$%d", columnStatus, len(args)))
+	}
+	args = append(args, f.Limit)
+	getDeliveries := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s DESC LIMIT $%d",
+		strings.Join(deliveryColumns, ", "), tableDeliveries, strings.Join(conditions, " AND "), columnDeliveryId,
+		len(args))
+	rows, err := w.db.Query(ctx, getDeliveries, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d := models.WebhookDelivery{}
+		if err = scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// ReplayDelivery - method schedules the delivery again with a fresh number of attempts,
+// the deliveries of deleted subscriptions can't be replayed
+func (w *WebhookRepo) ReplayDelivery(ctx context.Context, id int64) error {
+	replayDelivery := fmt.Sprintf(`UPDATE %[1]s d SET %[2]s=$1, %[3]s=0, %[4]s=now(), %[5]s=NULL
+		FROM %[6]s s WHERE s.%[7]s=d.%[7]s AND s.%[8]s IS NULL AND d.%[9]s=$2`,
+		tableDeliveries, columnStatus, columnAttempts, columnNextAttemptAt, columnDeliveredAt, tableSubscriptions,
+		columnSubscriptionId, columnDeletedAt, columnDeliveryId)
+	result, err := w.db.Exec(ctx, replayDelivery, models.DeliveryPending, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// scanDelivery - scans a row with the delivery columns followed by the extra columns
+func scanDelivery(row pgx.Row, d *models.WebhookDelivery, extra ...interface{}) error {
+	dest := []interface{}{&d.DeliveryID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+		&d.Attempts, &d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// recordEvent - writes the event to the outbox and enqueues its deliveries to the webhook subscribers
+// of its type within the transaction that changes the balance, so an event is published if and only if
+// the change is committed. userID is the key that orders the events in the broker
+func recordEvent(ctx context.Context, tx pgx.Tx, eventType string, userID int, data interface{}) error {
+	return recordEvents(ctx, tx, eventType, []int{userID}, data)
+}
+
+// recordEvents - records the event that changes the balances of several users. Each user gets the event
+// with its own id in the outbox under his key, so the consumers partitioned by the user see every change
+// of his balance. The webhook subscribers receive the event of the first user only
+func recordEvents(ctx context.Context, tx pgx.Tx, eventType string, userIDs []int, data interface{}) error {
+	for i, userID := range userIDs {
+		id, err := newEventID()
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(models.Event{
+			ID:        id,
+			Type:      eventType,
+			CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+			Data:      data,
+		})
+		if err != nil {
+			return err
+		}
+		insertOutbox := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) VALUES ($1, $2, $3, $4)",
+			tableOutbox, columnEventId, columnEventType, columnUserId, columnPayload)
+		if _, err = tx.Exec(ctx, insertOutbox, id, eventType, userID, payload); err != nil {
+			return err
+		}
+		if i != 0 {
+			continue
+		}
+		enqueue := fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s) SELECT %s, $1::uuid, $2::text, $3::jsonb FROM %s WHERE %s IS NULL AND $2=ANY(%s)`,
+			tableDeliveries, columnSubscriptionId, columnEventId, columnEventType, columnPayload, columnSubscriptionId,
+			tableSubscriptions, columnDeletedAt, columnEventTypes)
+		if _, err = tx.Exec(ctx, enqueue, id, eventType, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newEventID - generates a random UUID of the event
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// auditAnonymous - client of the calls made without an API key
+	auditAnonymous = "anonymous"
+	// auditRedacted - value of the secrets of the payload in the log
+	auditRedacted = "[redacted]"
+	// defaultAuditLimit - number of entries returned when the limit is not set
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+var (
+	// auditGenesis - previous hash of the first entry of the log
+	auditGenesis = strings.Repeat("0", 64)
+	// auditSecrets - fields of the payload that are not stored in the log
+	auditSecrets  = map[string]bool{"secret": true, "key": true}
+	errAuditLimit = fmt.Errorf("limit must be between 1 and %d", maxAuditLimit)
+)
+
+// AuditService - object in the service layer that appends the mutating calls to the audit log,
+// chains them and checks its hash chain
+type AuditService struct {
+	repo     repository.Audit
+	location *time.Location
+	config   configs.ConfigAudit
+}
+
+// NewAuditService - constructor function for AuditService
+func NewAuditService(repo repository.Audit, location *time.Location, config configs.ConfigAudit) *AuditService {
+	return &AuditService{
+		repo:     repo,
+		location: location,
+		config:   config,
+	}
+}
+
+// WithAudit - returns the context whose balance changes append the entry of the call to the log in their
+// transaction, with the balances the change left. entry returns the entry of the call when it is appended,
+// the entry is recorded as successful with the status the call answers on success, the call is not finished
+// yet then. The call that is not recorded this way is recorded by RecordAudit
+func (s *AuditService) WithAudit(ctx context.Context, status int, entry func() models.AuditEntry) (context.Context,
+	*repository.AuditRecord) {
+	record := repository.NewAuditRecord(func() models.AuditEntry {
+		e := entry()
+		e.StatusCode, e.Outcome = status, models.AuditSuccess
+		return s.prepare(e)
+	})
+	return repository.WithAuditRecord(ctx, record), record
+}
+
+// RecordAudit - method appends the call that didn't change the balances to the log: the failed call or the call
+// of the other data. The payload is normalized and its secrets are redacted
+func (s *AuditService) RecordAudit(ctx context.Context, e models.AuditEntry) (err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.RecordAudit")
+	defer func() { tracing.End(span, 0, err) }()
+	e.Outcome = models.AuditSuccess
+	if e.StatusCode >= 300 {
+		e.Outcome = models.AuditFailure
+	}
+	e = s.prepare(e)
+	if err = s.repo.AppendAudit(ctx, &e); err != nil {
+		return fmt.Errorf("database error: %s", err.Error())
+	}
+	return nil
+}
+
+// RunAudit - chains the appended entries until the context is cancelled. The chaining is serialized
+// by the database, so the entries chained by the servers running together follow one another
+func (s *AuditService) RunAudit(ctx context.Context, onError func(err error)) {
+	ticker := time.NewTicker(s.config.AuditChainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.chain(ctx); err != nil && ctx.Err() == nil {
+			onError(fmt.Errorf("audit chaining error: %w", err))
+		}
+	}
+}
+
+// chain - chains all entries appended before the call, a full batch means more entries are waiting
+func (s *AuditService) chain(ctx context.Context) error {
+	for {
+		n, err := s.repo.ChainAudit(ctx, s.config.AuditChainBatch, seal)
+		if err != nil || n < s.config.AuditChainBatch {
+			return err
+		}
+	}
+}
+
+// GetAudit - method returns the entries of the filter in the order of the log
+func (s *AuditService) GetAudit(ctx context.Context, f models.AuditFilter) (entries []models.AuditEntry, code int,
+	err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetAudit")
+	defer func() { tracing.End(span, code, err) }()
+	if f.Limit < 0 || f.Limit > maxAuditLimit {
+		return nil, 400, errAuditLimit
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultAuditLimit
+	}
+	if code, err = s.PrepareAudit(&f); err != nil {
+		return nil, code, err
+	}
+	entries, err = s.repo.GetAuditEntries(ctx, f)
+	if err != nil {
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return entries, 200, nil
+}
+
+// PrepareAudit - method validates the filter and resolves its period, it must be called before the export
+// because errors cannot be reported once the stream has started
+func (s *AuditService) PrepareAudit(f *models.AuditFilter) (code int, err error) {
+	if f.UserID < 0 {
+		return 400, errUser
+	}
+	if f.From, err = parseDate(f.DateFrom, s.location); err != nil {
+		return 400, err
+	}
+	if f.To, err = parseDate(f.DateTo, s.location); err != nil {
+		return 400, err
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return 400, errExportPeriod
+	}
+	return 200, nil
+}
+
+// ExportAudit - method streams the chained entries of the filter into w as JSON lines with their hashes
+// in the order of the chain, so the chain can be verified outside the service
+func (s *AuditService) ExportAudit(ctx context.Context, f models.AuditFilter, w io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ExportAudit")
+	defer func() { tracing.End(span, 0, err) }()
+	f.Limit, f.Chained = 0, true
+	encoder := json.NewEncoder(w)
+	return s.repo.StreamAudit(ctx, f, func(e models.AuditEntry) error {
+		return encoder.Encode(e)
+	})
+}
+
+// VerifyAudit - method chains the appended entries, recalculates the hash chain of the whole log and reports
+// the first entry that was changed, or follows a removed one
+func (s *AuditService) VerifyAudit(ctx context.Context) (v models.AuditVerification, code int, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.VerifyAudit")
+	defer func() { tracing.End(span, code, err) }()
+	if err = s.chain(ctx); err != nil {
+		return v, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	errBroken := errors.New("chain is broken")
+	prev := auditGenesis
+	err = s.repo.StreamAudit(ctx, models.AuditFilter{Chained: true}, func(e models.AuditEntry) error {
+		switch {
+		case e.PrevHash != prev:
+			v.Error = "the previous hash does not match the previous entry"
+		case auditHash(e) != e.Hash:
+			v.Error = "the hash does not match the entry"
+		default:
+			v.Entries++
+			prev = e.Hash
+			return nil
+		}
+		id := e.AuditID
+		v.BrokenAt = &id
+		return errBroken
+	})
+	if err != nil && !errors.Is(err, errBroken) {
+		return v, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	v.Valid = v.BrokenAt == nil
+	return v, 200, nil
+}
+
+// prepare - sets the time of the entry, normalizes its payload and names the anonymous client
+func (s *AuditService) prepare(e models.AuditEntry) models.AuditEntry {
+	if e.Client == "" {
+		e.Client = auditAnonymous
+	}
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	e.Payload = normalizePayload(e.Payload)
+	return e
+}
+
+// seal - sets the hash of the entry chained after the entry with PrevHash, the first entry follows the genesis
+func seal(e *models.AuditEntry) {
+	if e.PrevHash == "" {
+		e.PrevHash = auditGenesis
+	}
+	e.Hash = auditHash(*e)
+}
+
+// normalizePayload - returns the compact JSON of the payload with the sorted keys and the redacted secrets.
+// A payload that is not JSON is stored as a string. The normalization of the stored payload doesn't change it,
+// so the hash of the entry read from the database matches
+func normalizePayload(payload json.RawMessage) json.RawMessage {
+	if len(payload) == 0 {
+		return json.RawMessage("null")
+	}
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		value = string(payload)
+	}
+	if fields, ok := value.(map[string]interface{}); ok {
+		for name := range fields {
+			if auditSecrets[name] {
+				fields[name] = auditRedacted
+			}
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+// auditHash - returns the SHA-256 of the previous hash and the normalized entry
+func auditHash(e models.AuditEntry) string {
+	data, _ := json.Marshal(struct {
+		CreatedAt  string             `json:"created_at"`
+		Client     string             `json:"client"`
+		KeyID      int                `json:"key_id"`
+		Method     string             `json:"method"`
+		Endpoint   string             `json:"endpoint"`
+		RequestID  string             `json:"request_id"`
+		SourceIP   string             `json:"source_ip"`
+		Payload    json.RawMessage    `json:"payload"`
+		StatusCode int                `json:"status_code"`
+		Outcome    string             `json:"outcome"`
+		Message    string             `json:"message"`
+		Balances   map[string]float64 `json:"balances"`
+	}{e.CreatedAt.UTC().Format(time.RFC3339Nano), e.Client, e.KeyID, e.Method, e.Endpoint, e.RequestID, e.SourceIP,
+		normalizePayload(e.Payload), e.StatusCode, e.Outcome, e.Message, e.Balances})
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), data...))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// apiKeyPrefix - prefix of the issued keys, it makes the leaked keys easy to find in the code and the logs
+	apiKeyPrefix = "avk_"
+	// apiKeyShownLength - length of the beginning of the key shown in the list of the keys
+	apiKeyShownLength = 12
+)
+
+var (
+	errAPIKeyInvalid = errors.New("api key is invalid or revoked")
+	errAPIKeyMissing = errors.New("api key does not exist or has already been revoked")
+)
+
+// AuthService - object in the service layer that issues the API keys of the client services and checks
+// the scopes of the calls
+type AuthService struct {
+	repo repository.Auth
+}
+
+// NewAuthService - constructor function for AuthService
+func NewAuthService(repo repository.Auth) *AuthService {
+	return &AuthService{repo: repo}
+}
+
+// IssueAPIKey - method generates the key of the client with the scopes, the key is set only in the issued
+// object and can't be recovered later
+func (s *AuthService) IssueAPIKey(ctx context.Context, key *models.APIKey) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.IssueAPIKey")
+	defer func() { tracing.End(span, code, err) }()
+	if strings.TrimSpace(key.Client) == "" {
+		return 400, errors.New("client must not be empty")
+	}
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return 500, fmt.Errorf("key generation error: %s", err.Error())
+	}
+	key.Key = apiKeyPrefix + hex.EncodeToString(b)
+	key.Prefix = key.Key[:apiKeyShownLength]
+	key.RevokedAt = nil
+	if err = s.repo.CreateAPIKey(ctx, key, hashAPIKey(key.Key)); err != nil {
+		return 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return 201, nil
+}
+
+// GetAPIKeys - method returns all keys with their scopes, the revoked keys are kept for the history
+func (s *AuthService) GetAPIKeys(ctx context.Context) (keys []models.APIKey, code int, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetAPIKeys")
+	defer func() { tracing.End(span, code, err) }()
+	keys, err = s.repo.GetAPIKeys(ctx)
+	if err != nil {
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return keys, 200, nil
+}
+
+// RevokeAPIKey - method revokes the key, the calls with it are rejected at once
+func (s *AuthService) RevokeAPIKey(ctx context.Context, id int) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.RevokeAPIKey")
+	defer func() { tracing.End(span, code, err) }()
+	if err = s.repo.RevokeAPIKey(ctx, id); err != nil {
+		if err.Error() == errNoRows {
+			return 404, errAPIKeyMissing
+		}
+		return 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return 200, nil
+}
+
+// Authorize - method finds the client by the key and checks that the key has the scope or the admin scope.
+// Returns 401 for an unknown or revoked key and 403 when the scope is missing
+func (s *AuthService) Authorize(ctx context.Context, key, scope string) (client models.APIKey, code int,
+	err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Authorize")
+	defer func() { tracing.End(span, code, err) }()
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return client, 401, errAPIKeyInvalid
+	}
+	client, err = s.repo.GetActiveAPIKey(ctx, hashAPIKey(key))
+	if err != nil {
+		if err.Error() == errNoRows {
+			return client, 401, errAPIKeyInvalid
+		}
+		return client, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	for _, granted := range client.Scopes {
+		if granted == scope || granted == models.ScopeAdmin {
+			return client, 200, nil
+		}
+	}
+	return client, 403, fmt.Errorf("client %s is not allowed to %s", client.Client, scope)
+}
+
+// hashAPIKey - returns the SHA-256 hash of the key stored instead of the key. The keys are random,
+// so they don't need a salt
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var errServiceName = errors.New("service name must not be empty")
+
+// catalogCacheTTL - lifetime of the cached names, the changes made through the other instances
+// of the service are seen after it
+const catalogCacheTTL = time.Minute
+
+// CatalogService - service catalog object in the service layer
+type CatalogService struct {
+	repo  repository.Catalog
+	cache *catalogCache
+}
+
+// NewCatalogService - constructor function for CatalogService, the cache of the names is reset
+// when the catalog changes
+func NewCatalogService(repo repository.Catalog, cache *catalogCache) *CatalogService {
+	return &CatalogService{
+		repo:  repo,
+		cache: cache,
+	}
+}
+
+// UpsertService - method adds the service to the catalog or updates the existing one
+func (c *CatalogService) UpsertService(ctx context.Context, s models.ServiceInfo) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "CatalogService.UpsertService")
+	defer func() { tracing.End(span, code, err) }()
+	if s.ServiceID < 1 {
+		return 400, errService
+	}
+	if s.Name == "" {
+		return 400, errServiceName
+	}
+	err = c.repo.UpsertService(ctx, s)
+	if err != nil {
+		return 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	c.cache.invalidate()
+	return 200, nil
+}
+
+// GetServices - method returns all services of the catalog
+func (c *CatalogService) GetServices(ctx context.Context) (services []models.ServiceInfo, code int, err error) {
+	ctx, span := tracing.Start(ctx, "CatalogService.GetServices")
+	defer func() { tracing.End(span, code, err) }()
+	services, err = c.repo.GetServices(ctx)
+	if err != nil {
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return services, 200, nil
+}
+
+// catalogCache - names of the services of the catalog for the descriptions of the transactions,
+// the catalog is small and rarely changes, so it is loaded once and kept until it changes or expires
+type catalogCache struct {
+	repo     repository.Catalog
+	mu       sync.RWMutex
+	names    map[int]string
+	loadedAt time.Time
+	// invalidatedAt - time of the last change of the catalog
+	invalidatedAt time.Time
+}
+
+// newCatalogCache - constructor function for catalogCache
+func newCatalogCache(repo repository.Catalog) *catalogCache {
+	return &catalogCache{repo: repo}
+}
+
+// Names - returns the names of the services by their ids, the map must not be modified
+func (c *catalogCache) Names(ctx context.Context) (map[int]string, error) {
+	c.mu.RLock()
+	names, loadedAt := c.names, c.loadedAt
+	c.mu.RUnlock()
+	if names != nil && time.Since(loadedAt) < catalogCacheTTL {
+		return names, nil
+	}
+	loadedAt = time.Now()
+	services, err := c.repo.GetServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", err.Error())
+	}
+	names = make(map[int]string, len(services))
+	for _, s := range services {
+		names[s.ServiceID] = s.Name
+	}
+	c.mu.Lock()
+	// the names loaded before the last invalidation are not kept
+	if loadedAt.After(c.invalidatedAt) {
+		c.names, c.loadedAt = names, loadedAt
+	}
+	c.mu.Unlock()
+	return names, nil
+}
+
+// invalidate - drops the cached names, they are loaded again on the next call
+func (c *catalogCache) invalidate() {
+	c.mu.Lock()
+	c.names = nil
+	c.invalidatedAt = time.Now()
+	c.mu.Unlock()
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/broker"
+	"avito/internal/models"
+	"avito/internal/parser"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+const (
+	// commandStaleAfter - age of a claim without the result after which the execution is considered
+	// interrupted, the outcome of such a command is unknown and it is dead-lettered for the manual check
+	commandStaleAfter = 5 * time.Minute
+	// consumeRetryMax - maximum delay before consuming again after the consumer stopped with an error
+	consumeRetryMax = 30 * time.Second
+	// auditBrokerClient - client of the commands in the audit log
+	auditBrokerClient = "broker"
+)
+
+// CommandService - object in the service layer that executes the commands of the message broker
+// through the user and order services. A command is executed once by its message id, the repeated
+// deliveries get the stored result. The executed commands are recorded in the audit log
+type CommandService struct {
+	users    User
+	orders   Order
+	audit    Audit
+	repo     repository.Command
+	consumer broker.Consumer
+	parser   *parser.Parser
+	config   configs.ConfigCommands
+}
+
+// NewCommandService - constructor function for CommandService, nothing is consumed without the consumer
+func NewCommandService(users User, orders Order, audit Audit, repo repository.Command, consumer broker.Consumer,
+	config configs.ConfigCommands) *CommandService {
+	return &CommandService{
+		users:    users,
+		orders:   orders,
+		audit:    audit,
+		repo:     repo,
+		consumer: consumer,
+		parser:   parser.NewParser(0),
+		config:   config,
+	}
+}
+
+// RunCommands - consumes the commands until the context is cancelled, restarting the consumer with
+// a growing delay when it fails
+func (c *CommandService) RunCommands(ctx context.Context, onError func(err error)) {
+	if c.consumer == nil {
+		return
+	}
+	delay := time.Second
+	for {
+		err := c.consumer.Consume(ctx, c.HandleCommand)
+		if ctx.Err() != nil {
+			return
+		}
+		onError(fmt.Errorf("command consumer error: %w", err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > consumeRetryMax {
+			delay = consumeRetryMax
+		}
+	}
+}
+
+// HandleCommand - executes the command and replies with the result. It returns an error only when
+// the command must be delivered again, the commands that can't be executed are dead-lettered
+func (c *CommandService) HandleCommand(ctx context.Context, cmd models.Command) (err error) {
+	// the command is the root of its trace, the command and its reply are correlated by the message id
+	ctx, span := tracing.Start(ctx, "CommandService.HandleCommand", attribute.String("avito.command.id", cmd.ID),
+		attribute.String("avito.command.type", cmd.Type))
+	defer func() { tracing.End(span, 0, err) }()
+	if cmd.ID == "" {
+		return c.consumer.DeadLetter(ctx, models.DeadLetter{Command: cmd, Reason: "message id is missing"})
+	}
+	claim, claimed, err := c.repo.ClaimCommand(ctx, cmd.ID, cmd.Type)
+	if err != nil {
+		return fmt.Errorf("database error: %s", err.Error())
+	}
+	if !claimed {
+		// the outcome of the command that failed with a server error is unknown, it is not executed again
+		if claim.StatusCode != nil && *claim.StatusCode >= 500 {
+			return c.consumer.DeadLetter(ctx, models.DeadLetter{Command: cmd, Reason: claim.Description})
+		}
+		if claim.StatusCode != nil {
+			return c.consumer.Reply(ctx, cmd, reply(cmd, *claim.StatusCode, claim.Description, true))
+		}
+		if time.Since(claim.ClaimedAt) < commandStaleAfter {
+			return fmt.Errorf("command %s is being executed", cmd.ID)
+		}
+		return c.consumer.DeadLetter(ctx, models.DeadLetter{Command: cmd,
+			Reason: "the previous execution was interrupted, the outcome is unknown"})
+	}
+	execute, err := c.command(cmd)
+	if err != nil {
+		reason := err.Error()
+		if err = c.consumer.DeadLetter(ctx, models.DeadLetter{Command: cmd, Reason: reason}); err != nil {
+			c.repo.ReleaseCommand(ctx, cmd.ID)
+			return err
+		}
+		// the poison message is remembered, so its repeated deliveries are not dead-lettered again
+		return c.complete(ctx, cmd, 400, reason)
+	}
+	// the balance change of the command appends its entry to the audit log in the same transaction
+	auditCtx, record := c.audit.WithAudit(ctx, commandSuccess[cmd.Type], func() models.AuditEntry {
+		return commandEntry(cmd)
+	})
+	code, err := execute(auditCtx)
+	for attempt := 1; code >= 500 && attempt < c.config.CommandMaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			// the failed attempt may have been applied, the claim is kept, so the next delivery
+			// is dead-lettered as interrupted once the claim is stale instead of executed again
+			return ctx.Err()
+		case <-time.After(c.config.CommandRetryDelay * time.Duration(attempt)):
+		}
+		code, err = execute(auditCtx)
+	}
+	if !record.Recorded() || code >= 300 {
+		if auditErr := c.record(ctx, cmd, code, err); auditErr != nil {
+			// the command is delivered again: the rejected command changed nothing and is executed again,
+			// the outcome of the failed one is unknown and it is dead-lettered once the claim is stale
+			if code < 500 {
+				c.repo.ReleaseCommand(ctx, cmd.ID)
+			}
+			return auditErr
+		}
+	}
+	if code >= 500 {
+		// the failed attempts may have been applied, the result is stored before the command
+		// is dead-lettered, so the repeated deliveries are dead-lettered instead of executed again
+		reason := err.Error()
+		if err = c.repo.CompleteCommand(ctx, models.CommandResult{MessageID: cmd.ID, StatusCode: &code,
+			Description: reason}); err != nil {
+			return fmt.Errorf("database error: %s", err.Error())
+		}
+		return c.consumer.DeadLetter(ctx, models.DeadLetter{Command: cmd, Reason: reason})
+	}
+	description := "success"
+	if err != nil {
+		description = err.Error()
+	}
+	return c.complete(ctx, cmd, code, description)
+}
+
+// complete - stores the result of the command and replies with it
+func (c *CommandService) complete(ctx context.Context, cmd models.Command, code int, description string) error {
+	err := c.repo.CompleteCommand(ctx, models.CommandResult{MessageID: cmd.ID, StatusCode: &code,
+		Description: description})
+	if err != nil {
+		return fmt.Errorf("database error: %s", err.Error())
+	}
+	return c.consumer.Reply(ctx, cmd, reply(cmd, code, description, false))
+}
+
+// record - appends the command that didn't change the balances to the audit log
+func (c *CommandService) record(ctx context.Context, cmd models.Command, code int, err error) error {
+	e := commandEntry(cmd)
+	e.StatusCode = code
+	if err != nil {
+		e.Message = err.Error()
+	}
+	return c.audit.RecordAudit(ctx, e)
+}
+
+// commandEntry - returns the entry of the command in the audit log as the call of the broker client,
+// the message id is recorded as the request id
+func commandEntry(cmd models.Command) models.AuditEntry {
+	return models.AuditEntry{Client: auditBrokerClient, Method: "COMMAND", Endpoint: cmd.Type, RequestID: cmd.ID,
+		Payload: cmd.Payload}
+}
+
+// command - decodes and validates the payload of the command, returns the function that executes it
+func (c *CommandService) command(cmd models.Command) (func(ctx context.Context) (int, error), error) {
+	switch cmd.Type {
+	case models.CommandAccrual:
+		var ac models.AccrualFunds
+		if err := c.parser.Unmarshal(cmd.Payload, &ac, true); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (int, error) { return c.users.AccrualFunds(ctx, ac) }, nil
+	case models.CommandReserve:
+		var order models.Order
+		if err := c.parser.Unmarshal(cmd.Payload, &order, true); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (int, error) { return c.users.BlockFunds(ctx, order) }, nil
+	case models.CommandCharge:
+		var order models.Order
+		if err := c.parser.Unmarshal(cmd.Payload, &order, true); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (int, error) { return c.orders.ChargeFunds(ctx, order) }, nil
+	case models.CommandCancel:
+		var unblock models.Unblock
+		if err := c.parser.Unmarshal(cmd.Payload, &unblock, true); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (int, error) { return c.users.UnblockFunds(ctx, unblock) }, nil
+	}
+	return nil, fmt.Errorf("unknown command type %q, expected one of: %s, %s, %s, %s", cmd.Type,
+		models.CommandAccrual, models.CommandReserve, models.CommandCharge, models.CommandCancel)
+}
+
+// commandSuccess - status codes of the successful commands, the status of the call of the API it stands for
+var commandSuccess = map[string]int{
+	models.CommandAccrual: 200,
+	models.CommandReserve: 201,
+	models.CommandCharge:  200,
+	models.CommandCancel:  200,
+}
+
+// reply - makes the reply to the command with its result
+func reply(cmd models.Command, code int, description string, duplicate bool) models.CommandReply {
+	return models.CommandReply{
+		CommandID:   cmd.ID,
+		Type:        cmd.Type,
+		Success:     code < 300,
+		StatusCode:  code,
+		Description: description,
+		Duplicate:   duplicate,
+	}
+}
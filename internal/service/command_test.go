@@ -0,0 +1,302 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/broker"
+	"avito/internal/models"
+	"avito/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHandleCommandRedelivery(t *testing.T) {
+	users := &mockCommandUsers{codes: []int{200}}
+	consumer := broker.NewMemoryConsumer()
+	commands := newMockCommandService(users, consumer, newMockCommandRepo())
+	cmd := models.Command{ID: "settlement-1", Type: models.CommandAccrual,
+		Payload: []byte(`{"user_id":1,"amount":100}`)}
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, commands.HandleCommand(context.Background(), cmd), fmt.Sprintf("delivery %d", i+1))
+	}
+	assert.Equal(t, 1, users.calls, "the command is executed once")
+	assert.Equal(t, []models.CommandReply{
+		{CommandID: "settlement-1", Type: models.CommandAccrual, Success: true, StatusCode: 200, Description: "success"},
+		{CommandID: "settlement-1", Type: models.CommandAccrual, Success: true, StatusCode: 200, Description: "success",
+			Duplicate: true},
+		{CommandID: "settlement-1", Type: models.CommandAccrual, Success: true, StatusCode: 200, Description: "success",
+			Duplicate: true},
+	}, consumer.Replies())
+	assert.Equal(t, 0, len(consumer.DeadLetters()))
+}
+
+func TestHandleCommandReplies(t *testing.T) {
+	tableTest := []struct {
+		testName        string
+		codes           []int
+		expectedCalls   int
+		expectedSuccess bool
+		expectedCode    int
+	}{
+		{
+			"success",
+			[]int{200},
+			1,
+			true,
+			200,
+		},
+		{
+			"client error is not retried",
+			[]int{400},
+			1,
+			false,
+			400,
+		},
+		{
+			"server error is retried",
+			[]int{500, 503, 200},
+			3,
+			true,
+			200,
+		},
+	}
+	for _, testCase := range tableTest {
+		users := &mockCommandUsers{codes: testCase.codes}
+		consumer := broker.NewMemoryConsumer()
+		commands := newMockCommandService(users, consumer, newMockCommandRepo())
+		cmd := models.Command{ID: "cmd", Type: models.CommandAccrual, Payload: []byte(`{"user_id":1,"amount":100}`)}
+
+		assert.Nil(t, commands.HandleCommand(context.Background(), cmd), testCase.testName)
+		assert.Equal(t, testCase.expectedCalls, users.calls, testCase.testName)
+		replies := consumer.Replies()
+		if assert.Equal(t, 1, len(replies), testCase.testName) {
+			assert.Equal(t, testCase.expectedSuccess, replies[0].Success, testCase.testName)
+			assert.Equal(t, testCase.expectedCode, replies[0].StatusCode, testCase.testName)
+		}
+	}
+}
+
+func TestHandleCommandPoison(t *testing.T) {
+	tableTest := []struct {
+		testName       string
+		cmd            models.Command
+		expectedReason string
+	}{
+		{
+			"missing message id",
+			models.Command{Type: models.CommandAccrual, Payload: []byte(`{"user_id":1,"amount":100}`)},
+			"message id is missing",
+		},
+		{
+			"unknown type",
+			models.Command{ID: "cmd", Type: "refill", Payload: []byte(`{"user_id":1,"amount":100}`)},
+			`unknown command type "refill", expected one of: accrual, reserve, charge, cancel`,
+		},
+		{
+			"invalid body",
+			models.Command{ID: "cmd", Type: models.CommandAccrual, Payload: []byte(`{"user_id":1,"amount":-100}`)},
+			"invalid data for request: amount must be greater than 0",
+		},
+	}
+	for _, testCase := range tableTest {
+		users := &mockCommandUsers{codes: []int{200}}
+		consumer := broker.NewMemoryConsumer()
+		commands := newMockCommandService(users, consumer, newMockCommandRepo())
+
+		assert.Nil(t, commands.HandleCommand(context.Background(), testCase.cmd), testCase.testName)
+		assert.Equal(t, 0, users.calls, testCase.testName)
+		letters := consumer.DeadLetters()
+		if assert.Equal(t, 1, len(letters), testCase.testName) {
+			assert.Equal(t, testCase.expectedReason, letters[0].Reason, testCase.testName)
+		}
+	}
+}
+
+func TestHandleCommandPoisonRedelivery(t *testing.T) {
+	users := &mockCommandUsers{codes: []int{200}}
+	consumer := broker.NewMemoryConsumer()
+	commands := newMockCommandService(users, consumer, newMockCommandRepo())
+	cmd := models.Command{ID: "cmd", Type: models.CommandAccrual, Payload: []byte(`{"user_id":0}`)}
+
+	assert.Nil(t, commands.HandleCommand(context.Background(), cmd))
+	assert.Nil(t, commands.HandleCommand(context.Background(), cmd))
+	assert.Equal(t, 1, len(consumer.DeadLetters()), "the poison message is dead-lettered once")
+	replies := consumer.Replies()
+	if assert.Equal(t, 2, len(replies)) {
+		assert.Equal(t, 400, replies[1].StatusCode)
+		assert.True(t, replies[1].Duplicate)
+	}
+}
+
+func TestHandleCommandRetryExhaustion(t *testing.T) {
+	users := &mockCommandUsers{codes: []int{500}}
+	consumer := broker.NewMemoryConsumer()
+	commands := newMockCommandService(users, consumer, newMockCommandRepo())
+	cmd := models.Command{ID: "cmd", Type: models.CommandAccrual, Payload: []byte(`{"user_id":1,"amount":100}`)}
+
+	assert.Nil(t, commands.HandleCommand(context.Background(), cmd))
+	assert.Equal(t, 3, users.calls, "the command is attempted COMMAND_MAX_ATTEMPTS times")
+	assert.Nil(t, commands.HandleCommand(context.Background(), cmd))
+	assert.Equal(t, 3, users.calls, "the failed command is not executed again")
+	letters := consumer.DeadLetters()
+	if assert.Equal(t, 2, len(letters)) {
+		assert.Equal(t, "database error: connection reset", letters[0].Reason)
+		assert.Equal(t, letters[0], letters[1])
+	}
+	assert.Equal(t, 0, len(consumer.Replies()))
+}
+
+func TestHandleCommandDeadLetterFailure(t *testing.T) {
+	users := &mockCommandUsers{codes: []int{500}}
+	consumer := &failingConsumer{MemoryConsumer: broker.NewMemoryConsumer(), failures: 1}
+	commands := newMockCommandService(users, consumer, newMockCommandRepo())
+	cmd := models.Command{ID: "cmd", Type: models.CommandAccrual, Payload: []byte(`{"user_id":1,"amount":100}`)}
+
+	assert.NotNil(t, commands.HandleCommand(context.Background(), cmd), "the command is delivered again")
+	assert.Nil(t, commands.HandleCommand(context.Background(), cmd), "redelivery")
+	assert.Equal(t, 3, users.calls, "the redelivered command is not executed again")
+	assert.Equal(t, 1, len(consumer.DeadLetters()))
+}
+
+func TestHandleCommandInterrupted(t *testing.T) {
+	users := &mockCommandUsers{codes: []int{500}}
+	consumer := broker.NewMemoryConsumer()
+	repo := newMockCommandRepo()
+	commands := newMockCommandService(users, consumer, repo)
+	commands.config.CommandRetryDelay = time.Hour
+	cmd := models.Command{ID: "cmd", Type: models.CommandAccrual, Payload: []byte(`{"user_id":1,"amount":100}`)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, commands.HandleCommand(ctx, cmd), "shutdown")
+	assert.NotNil(t, commands.HandleCommand(context.Background(), cmd), "the claim is being executed")
+	repo.results["cmd"].ClaimedAt = time.Now().Add(-commandStaleAfter)
+	assert.Nil(t, commands.HandleCommand(context.Background(), cmd), "stale claim")
+	assert.Equal(t, 1, users.calls, "the interrupted command is not executed again")
+	letters := consumer.DeadLetters()
+	if assert.Equal(t, 1, len(letters)) {
+		assert.Equal(t, "the previous execution was interrupted, the outcome is unknown", letters[0].Reason)
+	}
+}
+
+func TestHandleCommandAuditFailure(t *testing.T) {
+	users := &mockCommandUsers{codes: []int{400}}
+	consumer := broker.NewMemoryConsumer()
+	audit := &mockCommandAudit{failures: 1}
+	commands := NewCommandService(users, nil, audit, newMockCommandRepo(), consumer,
+		configs.ConfigCommands{CommandMaxAttempts: 3})
+	cmd := models.Command{ID: "cmd", Type: models.CommandAccrual, Payload: []byte(`{"user_id":1,"amount":100}`)}
+
+	assert.NotNil(t, commands.HandleCommand(context.Background(), cmd), "the command is delivered again")
+	assert.Equal(t, 0, len(consumer.Replies()), "the command is not completed without the audit entry")
+	assert.Nil(t, commands.HandleCommand(context.Background(), cmd), "redelivery")
+	assert.Equal(t, 2, users.calls, "the rejected command is executed again")
+	if assert.Equal(t, 1, len(audit.entries)) {
+		assert.Equal(t, 400, audit.entries[0].StatusCode)
+		assert.Equal(t, "cmd", audit.entries[0].RequestID)
+	}
+	replies := consumer.Replies()
+	if assert.Equal(t, 1, len(replies)) {
+		assert.Equal(t, 400, replies[0].StatusCode)
+	}
+}
+
+// newMockCommandService - returns the command service that retries three times without the delay
+func newMockCommandService(users User, consumer broker.Consumer, repo *mockCommandRepo) *CommandService {
+	return NewCommandService(users, nil, &mockCommandAudit{}, repo, consumer,
+		configs.ConfigCommands{CommandMaxAttempts: 3})
+}
+
+// mockCommandUsers - user service that answers the accruals with the given codes, the last code repeats
+type mockCommandUsers struct {
+	User
+	codes []int
+	calls int
+}
+
+func (mu *mockCommandUsers) AccrualFunds(ctx context.Context, ac models.AccrualFunds) (int, error) {
+	code := mu.codes[len(mu.codes)-1]
+	if mu.calls < len(mu.codes) {
+		code = mu.codes[mu.calls]
+	}
+	mu.calls++
+	switch {
+	case code >= 500:
+		return code, errors.New("database error: connection reset")
+	case code >= 400:
+		return code, errors.New("user with id 1 does not exist")
+	}
+	return code, nil
+}
+
+// mockCommandAudit - audit log that fails the given number of first appends
+type mockCommandAudit struct {
+	Audit
+	entries  []models.AuditEntry
+	failures int
+}
+
+func (ma *mockCommandAudit) WithAudit(ctx context.Context, status int, entry func() models.AuditEntry) (context.Context,
+	*repository.AuditRecord) {
+	return ctx, repository.NewAuditRecord(entry)
+}
+
+func (ma *mockCommandAudit) RecordAudit(ctx context.Context, e models.AuditEntry) error {
+	if ma.failures > 0 {
+		ma.failures--
+		return errors.New("database error: connection reset")
+	}
+	ma.entries = append(ma.entries, e)
+	return nil
+}
+
+// failingConsumer - memory consumer whose dead-lettering fails the given number of first calls
+type failingConsumer struct {
+	*broker.MemoryConsumer
+	failures int
+}
+
+func (f *failingConsumer) DeadLetter(ctx context.Context, letter models.DeadLetter) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("broker is unavailable")
+	}
+	return f.MemoryConsumer.DeadLetter(ctx, letter)
+}
+
+// mockCommandRepo - processed commands in memory
+type mockCommandRepo struct {
+	results map[string]*models.CommandResult
+}
+
+func newMockCommandRepo() *mockCommandRepo {
+	return &mockCommandRepo{results: make(map[string]*models.CommandResult)}
+}
+
+func (mr *mockCommandRepo) ClaimCommand(ctx context.Context, messageID, commandType string) (models.CommandResult,
+	bool, error) {
+	if result, ok := mr.results[messageID]; ok {
+		return *result, false, nil
+	}
+	result := &models.CommandResult{MessageID: messageID, CommandType: commandType, ClaimedAt: time.Now()}
+	mr.results[messageID] = result
+	return *result, true, nil
+}
+
+func (mr *mockCommandRepo) CompleteCommand(ctx context.Context, result models.CommandResult) error {
+	if claim, ok := mr.results[result.MessageID]; ok {
+		claim.StatusCode, claim.Description = result.StatusCode, result.Description
+	}
+	return nil
+}
+
+func (mr *mockCommandRepo) ReleaseCommand(ctx context.Context, messageID string) error {
+	if claim, ok := mr.results[messageID]; ok && claim.StatusCode == nil {
+		delete(mr.results, messageID)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"avito/internal/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// descriptionTemplates - templates of the transaction descriptions by language and message code.
+// Placeholders are the parameters of the message in braces, {service} is the name of the service
+// from the catalog or its id
+var descriptionTemplates = map[string]map[string]string{
+	models.LanguageRu: {
+		models.OperationAccrual:      "Пополнение баланса",
+		models.OperationReservation:  "Оплата услуги {service} по заказу {order_id}",
+		models.OperationCharge:       "Списание за услугу {service} по заказу {order_id}",
+		models.OperationCancellation: "Отмена оплаты услуги {service} по заказу {order_id}",
+		models.OperationTransferOut:  "Перевод пользователю {counterparty_user_id}",
+		models.OperationTransferIn:   "Перевод от пользователя {counterparty_user_id}",
+		models.OperationRefund:       "Возврат за услугу {service} по заказу {order_id}",
+	},
+	models.LanguageEn: {
+		models.OperationAccrual:      "Replenishment of the balance",
+		models.OperationReservation:  "Payment for the service {service} under the order {order_id}",
+		models.OperationCharge:       "Charge for the service {service} under the order {order_id}",
+		models.OperationCancellation: "Cancellation of the payment for the service {service} under the order {order_id}",
+		models.OperationTransferOut:  "Transfer to the user {counterparty_user_id}",
+		models.OperationTransferIn:   "Transfer from the user {counterparty_user_id}",
+		models.OperationRefund:       "Refund for the service {service} under the order {order_id}",
+	},
+}
+
+// serviceNames - how the service is named in the description when it is in the catalog and when it is not
+var serviceNames = map[string][2]string{
+	models.LanguageRu: {"«%s»", "№%s"},
+	models.LanguageEn: {"“%s”", "#%s"},
+}
+
+// defaultLanguage - our users are Russian-speaking
+const defaultLanguage = models.LanguageRu
+
+// NegotiateLanguage - selects the language of the descriptions: the lang parameter if it is supported,
+// otherwise the supported language with the highest weight in the Accept-Language header
+func NegotiateLanguage(lang, acceptLanguage string) string {
+	if _, ok := descriptionTemplates[strings.ToLower(lang)]; ok {
+		return strings.ToLower(lang)
+	}
+	type candidate struct {
+		language string
+		weight   float64
+	}
+	candidates := make([]candidate, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.SplitN(strings.TrimSpace(fields[0]), "-", 2)[0])
+		if _, ok := descriptionTemplates[tag]; !ok {
+			continue
+		}
+		weight := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					weight = q
+				}
+			}
+		}
+		if weight > 0 {
+			candidates = append(candidates, candidate{tag, weight})
+		}
+	}
+	if len(candidates) == 0 {
+		return defaultLanguage
+	}
+	sort.SliceStable(candidates, func(i, k int) bool {
+		return candidates[i].weight > candidates[k].weight
+	})
+	return candidates[0].language
+}
+
+// describe - renders the description of the transaction, the comment supplied by the caller is shown as is
+func describe(tr *models.TransactionList, language string, catalog map[int]string) {
+	if _, ok := descriptionTemplates[language]; !ok {
+		language = defaultLanguage
+	}
+	if tr.MessageCode == nil {
+		tr.Description = tr.Message
+		return
+	}
+	template, ok := descriptionTemplates[language][*tr.MessageCode]
+	if !ok {
+		tr.Description = tr.Message
+		return
+	}
+	replacements := make([]string, 0, 2*len(tr.MessageParams)+2)
+	for key, value := range tr.MessageParams {
+		replacements = append(replacements, "{"+key+"}", value)
+	}
+	if serviceID, ok := tr.MessageParams["service_id"]; ok {
+		names := serviceNames[language]
+		name := fmt.Sprintf(names[1], serviceID)
+		if id, err := strconv.Atoi(serviceID); err == nil && catalog[id] != "" {
+			name = fmt.Sprintf(names[0], catalog[id])
+		}
+		replacements = append(replacements, "{service}", name)
+	}
+	tr.Description = strings.NewReplacer(replacements...).Replace(template)
+	if strings.Contains(tr.Description, "{") {
+		// old transactions may lack the links required by the template
+		tr.Description = tr.Message
+	}
+}
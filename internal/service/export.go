@@ -0,0 +1,231 @@
+package service
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"math"
+	"time"
+)
+
+// bulk export formats, CSV is shared with the journal
+const (
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// parquetRowGroupSize - size of the row group buffered in memory by the parquet writer
+const parquetRowGroupSize = 8 * 1024 * 1024
+
+var errExportPeriod = errors.New("the beginning of the period must be earlier than its end")
+
+// parquetTransaction - transaction row of the parquet file, amounts are stored as decimals in kopecks
+type parquetTransaction struct {
+	TransactionID     int64   `parquet:"name=transaction_id, type=INT64"`
+	UserID            int64   `parquet:"name=user_id, type=INT64"`
+	Amount            int64   `parquet:"name=amount, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Date              int64   `parquet:"name=date_time, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Message           string  `parquet:"name=message, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Operation         string  `parquet:"name=operation, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OrderID           *int64  `parquet:"name=order_id, type=INT64, repetitiontype=OPTIONAL"`
+	ServiceID         *int64  `parquet:"name=service_id, type=INT64, repetitiontype=OPTIONAL"`
+	CounterpartyID    *int64  `parquet:"name=counterparty_user_id, type=INT64, repetitiontype=OPTIONAL"`
+	ExternalReference *string `parquet:"name=external_reference, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	ParentID          *int64  `parquet:"name=parent_transaction_id, type=INT64, repetitiontype=OPTIONAL"`
+	MessageCode       *string `parquet:"name=message_code, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	MessageParams     *string `parquet:"name=message_params, type=BYTE_ARRAY, convertedtype=JSON, repetitiontype=OPTIONAL"`
+}
+
+// parquetOrder - order row of the parquet file
+type parquetOrder struct {
+	OrderID   int64 `parquet:"name=order_id, type=INT64"`
+	UserID    int64 `parquet:"name=user_id, type=INT64"`
+	ServiceID int64 `parquet:"name=service_id, type=INT64"`
+	Amount    int64 `parquet:"name=amount, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Date      int64 `parquet:"name=date_time, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Block     bool  `parquet:"name=block, type=BOOLEAN"`
+}
+
+// orderRow - order row of the NDJSON export
+type orderRow struct {
+	OrderID   int       `json:"order_id"`
+	UserID    int       `json:"user_id"`
+	ServiceID int       `json:"service_id"`
+	Amount    float64   `json:"amount"`
+	Date      time.Time `json:"date"`
+	Block     bool      `json:"block"`
+}
+
+// ExportService - object in the service layer for streaming bulk exports
+type ExportService struct {
+	repo     repository.Export
+	location *time.Location
+}
+
+// NewExportService - constructor function for ExportService
+func NewExportService(repo repository.Export, location *time.Location) *ExportService {
+	return &ExportService{
+		repo:     repo,
+		location: location,
+	}
+}
+
+// PrepareExport - method validates the export request and resolves its period,
+// it must be called before the export because errors cannot be reported once the stream has started
+func (e *ExportService) PrepareExport(req *models.ExportRequest) (code int, err error) {
+	if req.Table != "transactions" && req.Table != "orders" {
+		return 400, fmt.Errorf("table %q cannot be exported", req.Table)
+	}
+	if req.Format == "" {
+		req.Format = FormatCSV
+	}
+	if req.Format != FormatCSV && req.Format != FormatNDJSON && req.Format != FormatParquet {
+		return 400, fmt.Errorf("unsupported format %q", req.Format)
+	}
+	if req.UserID < 0 {
+		return 400, errUser
+	}
+	if req.From, err = parseDate(req.DateFrom, e.location); err != nil {
+		return 400, err
+	}
+	if req.To, err = parseDate(req.DateTo, e.location); err != nil {
+		return 400, err
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		return 400, errExportPeriod
+	}
+	return 200, nil
+}
+
+// Export - method streams the requested table into w in the requested format
+func (e *ExportService) Export(ctx context.Context, req models.ExportRequest, w io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "ExportService.Export", attribute.String("avito.export.table", req.Table),
+		attribute.String("avito.export.format", req.Format))
+	defer func() { tracing.End(span, 0, err) }()
+	switch req.Format {
+	case FormatCSV:
+		return e.repo.CopyCSV(ctx, req, w)
+	case FormatNDJSON:
+		return e.exportNDJSON(ctx, req, w)
+	case FormatParquet:
+		return e.exportParquet(ctx, req, w)
+	}
+	return fmt.Errorf("unsupported format %q", req.Format)
+}
+
+// exportNDJSON - writes each row as a separate JSON line
+func (e *ExportService) exportNDJSON(ctx context.Context, req models.ExportRequest, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	if req.Table == "orders" {
+		return e.repo.StreamOrders(ctx, req, func(order models.Order) error {
+			return encoder.Encode(orderRow{
+				OrderID:   order.OrderID,
+				UserID:    order.UserID,
+				ServiceID: order.ServiceID,
+				Amount:    order.Amount,
+				Date:      order.Date.In(e.location),
+				Block:     order.Block,
+			})
+		})
+	}
+	return e.repo.StreamTransactions(ctx, req, func(tr models.TransactionList) error {
+		tr.Date = tr.Date.In(e.location)
+		return encoder.Encode(tr)
+	})
+}
+
+// exportParquet - writes rows into a parquet file, only the current row group is kept in memory
+func (e *ExportService) exportParquet(ctx context.Context, req models.ExportRequest, w io.Writer) error {
+	var schema interface{} = new(parquetTransaction)
+	if req.Table == "orders" {
+		schema = new(parquetOrder)
+	}
+	pw, err := writer.NewParquetWriterFromWriter(w, schema, 1)
+	if err != nil {
+		return err
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	if req.Table == "orders" {
+		err = e.repo.StreamOrders(ctx, req, func(order models.Order) error {
+			return pw.Write(parquetOrder{
+				OrderID:   int64(order.OrderID),
+				UserID:    int64(order.UserID),
+				ServiceID: int64(order.ServiceID),
+				Amount:    toKopecks(order.Amount),
+				Date:      order.Date.UnixMicro(),
+				Block:     order.Block,
+			})
+		})
+	} else {
+		err = e.repo.StreamTransactions(ctx, req, func(tr models.TransactionList) error {
+			return pw.Write(parquetTransaction{
+				TransactionID:     int64(tr.TransactionID),
+				UserID:            int64(tr.UserID),
+				Amount:            toKopecks(tr.Amount),
+				Date:              tr.Date.UnixMicro(),
+				Message:           tr.Message,
+				Operation:         tr.Operation,
+				OrderID:           optionalInt64(tr.OrderID),
+				ServiceID:         optionalInt64(tr.ServiceID),
+				CounterpartyID:    optionalInt64(tr.CounterpartyID),
+				ExternalReference: tr.ExternalReference,
+				ParentID:          optionalInt64(tr.ParentID),
+				MessageCode:       tr.MessageCode,
+				MessageParams:     optionalJSON(tr.MessageParams),
+			})
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return pw.WriteStop()
+}
+
+// parseDate - parses an RFC 3339 timestamp or a date in the accounting time zone, empty value means no limit
+func parseDate(value string, location *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected RFC 3339 timestamp or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+// optionalJSON - converts the parameters of the message to an optional JSON column
+func optionalJSON(params map[string]string) *string {
+	if params == nil {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	value := string(data)
+	return &value
+}
+
+// optionalInt64 - converts the nullable identifier to the optional parquet value
+func optionalInt64(id *int) *int64 {
+	if id == nil {
+		return nil
+	}
+	value := int64(*id)
+	return &value
+}
+
+// toKopecks - converts the amount to the integer number of kopecks
+func toKopecks(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
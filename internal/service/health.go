@@ -0,0 +1,56 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"avito/internal/repository"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// HealthService - object in the service layer that checks the dependencies of the service
+type HealthService struct {
+	repo   repository.Health
+	config configs.ConfigHealth
+}
+
+// NewHealthService - constructor function for HealthService
+func NewHealthService(repo repository.Health, config configs.ConfigHealth) *HealthService {
+	return &HealthService{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// CheckReadiness - checks the connection to the database with a ping and that all migrations are applied,
+// each check is limited by the readiness timeout
+func (h *HealthService) CheckReadiness(ctx context.Context) []models.HealthCheck {
+	return []models.HealthCheck{
+		h.check(ctx, "database", h.repo.Ping),
+		h.check(ctx, "migrations", func(ctx context.Context) error {
+			pending, err := h.repo.GetPendingMigrations(ctx)
+			if err != nil {
+				return fmt.Errorf("database error: %s", err.Error())
+			}
+			if len(pending) == 0 {
+				return nil
+			}
+			names := make([]string, 0, len(pending))
+			for _, m := range pending {
+				names = append(names, fmt.Sprintf("%06d_%s", m.Version, m.Name))
+			}
+			return fmt.Errorf("pending migrations: %s", strings.Join(names, ", "))
+		}),
+	}
+}
+
+// check - runs the check with the readiness timeout
+func (h *HealthService) check(ctx context.Context, name string, fn func(ctx context.Context) error) models.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, h.config.ReadinessTimeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		return models.HealthCheck{Name: name, Error: err.Error()}
+	}
+	return models.HealthCheck{Name: name, OK: true}
+}
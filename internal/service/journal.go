@@ -0,0 +1,190 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// journal export formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// journalHeader - header of the journal in CSV format
+var journalHeader = []string{"entry_id", "date", "operation", "debit_account", "credit_account", "amount",
+	"user_id", "counterparty_user_id", "service_id", "order_id", "description"}
+
+// JournalService - object in the service layer that builds journal entries for the general ledger system
+type JournalService struct {
+	repo     repository.Journal
+	catalog  repository.Catalog
+	accounts configs.ConfigJournal
+	location *time.Location
+}
+
+// NewJournalService - constructor function for JournalService
+func NewJournalService(repo repository.Journal, catalog repository.Catalog, accounts configs.ConfigJournal,
+	location *time.Location) *JournalService {
+	return &JournalService{
+		repo:     repo,
+		catalog:  catalog,
+		accounts: accounts,
+		location: location,
+	}
+}
+
+// ExportJournal - method exports the money movements of the month as journal entries in CSV or JSON lines format
+func (j *JournalService) ExportJournal(ctx context.Context, req models.JournalRequest) (data []byte, code int,
+	err error) {
+	ctx, span := tracing.Start(ctx, "JournalService.ExportJournal")
+	defer func() { tracing.End(span, code, err) }()
+	if req.Year < firstYear {
+		return nil, 400, errYear
+	}
+	if req.Month < 1 || req.Month > 12 {
+		return nil, 400, errMonth
+	}
+	if req.Format == "" {
+		req.Format = FormatCSV
+	}
+	if req.Format != FormatCSV && req.Format != FormatJSONL {
+		return nil, 400, fmt.Errorf("unsupported format %q", req.Format)
+	}
+	req.From = time.Date(req.Year, time.Month(req.Month), 1, 0, 0, 0, 0, j.location)
+	req.To = req.From.AddDate(0, 1, 0)
+	movements, err := j.repo.GetMovements(ctx, req.From, req.To)
+	if err != nil {
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	services, err := j.catalog.GetServices(ctx)
+	if err != nil {
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	catalog := make(map[int]models.ServiceInfo, len(services))
+	for _, s := range services {
+		catalog[s.ServiceID] = s
+	}
+	entries := make([]models.JournalEntry, 0, len(movements))
+	for _, m := range movements {
+		entries = append(entries, j.entry(m, catalog))
+	}
+	sort.SliceStable(entries, func(i, k int) bool {
+		return entries[i].Date.Before(entries[k].Date)
+	})
+	if req.Format == FormatJSONL {
+		data, err = encodeJSONL(entries)
+	} else {
+		data, err = encodeJournalCSV(entries)
+	}
+	if err != nil {
+		return nil, 500, err
+	}
+	return data, 200, nil
+}
+
+// entry - makes a journal entry from the money movement
+func (j *JournalService) entry(m models.Movement, catalog map[int]models.ServiceInfo) models.JournalEntry {
+	e := models.JournalEntry{
+		EntryID:        fmt.Sprintf("T%d", m.SourceID),
+		Date:           m.Date.In(j.location),
+		Operation:      m.Operation,
+		Amount:         m.Amount,
+		UserID:         m.UserID,
+		CounterpartyID: m.CounterpartyID,
+		ServiceID:      m.ServiceID,
+		OrderID:        m.OrderID,
+	}
+	switch m.Operation {
+	case models.JournalAccrual:
+		e.DebitAccount, e.CreditAccount = j.accounts.CashAccount, j.accounts.UsersAccount
+		e.Description = fmt.Sprintf("replenishment of the balance of the user %d", m.UserID)
+	case models.JournalReservation:
+		e.DebitAccount, e.CreditAccount = j.accounts.UsersAccount, j.accounts.ReservedAccount
+		e.Description = fmt.Sprintf("reservation of funds of the user %d", m.UserID)
+	case models.JournalCancellation:
+		e.DebitAccount, e.CreditAccount = j.accounts.ReservedAccount, j.accounts.UsersAccount
+		e.Description = fmt.Sprintf("return of reserved funds to the user %d", m.UserID)
+	case models.JournalRefund:
+		e.DebitAccount, e.CreditAccount = j.accounts.RevenueAccount, j.accounts.UsersAccount
+		if s, ok := catalog[m.ServiceID]; ok && s.CreditAccount != "" {
+			e.DebitAccount = s.CreditAccount
+		}
+		e.Description = fmt.Sprintf("refund to the user %d under the order %d", m.UserID, m.OrderID)
+	case models.JournalTransfer:
+		e.DebitAccount, e.CreditAccount = j.accounts.UsersAccount, j.accounts.UsersAccount
+		e.Description = fmt.Sprintf("transfer from the user %d to the user %d", m.UserID, m.CounterpartyID)
+	case models.JournalAdjustment:
+		e.DebitAccount, e.CreditAccount = j.accounts.AdjustmentAccount, j.accounts.UsersAccount
+		if m.Amount < 0 {
+			e.DebitAccount, e.CreditAccount = e.CreditAccount, e.DebitAccount
+			e.Amount = -m.Amount
+		}
+		e.Description = fmt.Sprintf("adjustment of the balance of the user %d", m.UserID)
+	case models.JournalCharge:
+		e.EntryID = fmt.Sprintf("O%d", m.SourceID)
+		e.DebitAccount, e.CreditAccount = j.accounts.ReservedAccount, j.accounts.RevenueAccount
+		name := fmt.Sprintf("service %d", m.ServiceID)
+		if s, ok := catalog[m.ServiceID]; ok {
+			name = s.Name
+			if s.DebitAccount != "" {
+				e.DebitAccount = s.DebitAccount
+			}
+			if s.CreditAccount != "" {
+				e.CreditAccount = s.CreditAccount
+			}
+		}
+		e.Description = fmt.Sprintf("revenue for %s under the order %d", name, m.OrderID)
+	}
+	return e
+}
+
+// encodeJournalCSV - writes journal entries in CSV format with the header
+func encodeJournalCSV(entries []models.JournalEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = ';'
+	if err := w.Write(journalHeader); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		record := []string{e.EntryID, e.Date.Format(time.RFC3339), e.Operation, e.DebitAccount, e.CreditAccount,
+			strconv.FormatFloat(e.Amount, 'f', 2, 64), strconv.Itoa(e.UserID), optionalID(e.CounterpartyID),
+			optionalID(e.ServiceID), optionalID(e.OrderID), e.Description}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// encodeJSONL - writes each element as a separate JSON line
+func encodeJSONL(entries []models.JournalEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// optionalID - formats the optional identifier, zero means that there is no link
+func optionalID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
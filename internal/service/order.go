@@ -1,11 +1,15 @@
 package service
 
 import (
+	"avito/internal/metrics"
 	"avito/internal/models"
 	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 var (
@@ -17,18 +21,23 @@ var (
 
 // OrderService - order object in the service layer
 type OrderService struct {
-	repo repository.Order
+	repo     repository.Order
+	location *time.Location
 }
 
 // NewOrderService - constructor function for OrderService
-func NewOrderService(repo repository.Order) *OrderService {
+func NewOrderService(repo repository.Order, location *time.Location) *OrderService {
 	return &OrderService{
-		repo: repo,
+		repo:     repo,
+		location: location,
 	}
 }
 
 // ChargeFunds - method for charging previously reserved funds
-func (o *OrderService) ChargeFunds(order models.Order) (code int, err error) {
+func (o *OrderService) ChargeFunds(ctx context.Context, order models.Order) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.ChargeFunds")
+	defer func() { tracing.End(span, code, err) }()
+	defer func() { metrics.ObserveOperation(models.OperationCharge, order.Amount, code) }()
 	if order.Amount <= 0 {
 		return 400, errAmount
 	}
@@ -42,7 +51,7 @@ func (o *OrderService) ChargeFunds(order models.Order) (code int, err error) {
 		return 400, errOrder
 	}
 	order.Block = false
-	err = o.repo.ChargeFunds(order)
+	err = o.repo.ChargeFunds(ctx, order)
 	if err != nil {
 		if err.Error() == errNoOrder {
 			return 400, err
@@ -53,15 +62,19 @@ func (o *OrderService) ChargeFunds(order models.Order) (code int, err error) {
 }
 
 // GetReport - method for providing a summary report for accounting
-func (o *OrderService) GetReport(report models.Report) (data []byte, code int, err error) {
+func (o *OrderService) GetReport(ctx context.Context, report models.Report) (data []byte, code int, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetReport")
+	defer func() { tracing.End(span, code, err) }()
 	if report.Year < 2007 {
 		return nil, 400, errYear
 	}
 	if report.Month < 1 || report.Month > 12 {
 		return nil, 400, errMonth
 	}
+	report.From = time.Date(report.Year, time.Month(report.Month), 1, 0, 0, 0, 0, o.location)
+	report.To = report.From.AddDate(0, 1, 0)
 	report.Data = make(map[int]float64)
-	err = o.repo.GetReport(&report)
+	err = o.repo.GetReport(ctx, &report)
 	if err != nil {
 		return nil, 500, err
 	}
@@ -79,3 +92,14 @@ func (o *OrderService) GetReport(report models.Report) (data []byte, code int, e
 	data = []byte(strings.TrimSuffix(sb.String(), "\n"))
 	return data, 200, nil
 }
+
+// GetOpenReservations - method returns the number and the total amount of the open reservations
+func (o *OrderService) GetOpenReservations(ctx context.Context) (count int64, amount float64, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetOpenReservations")
+	defer func() { tracing.End(span, 0, err) }()
+	count, amount, err = o.repo.GetOpenReservations(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("database error: %s", err.Error())
+	}
+	return count, amount, nil
+}
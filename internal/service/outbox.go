@@ -0,0 +1,87 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/broker"
+	"avito/internal/repository"
+	"context"
+	"fmt"
+	"time"
+)
+
+// outboxCleanupInterval - how often the published events older than the retention are removed
+const outboxCleanupInterval = time.Hour
+
+// OutboxService - object in the service layer that relays the events of the outbox to the message broker
+type OutboxService struct {
+	repo      repository.Outbox
+	publisher broker.Publisher
+	config    configs.ConfigOutbox
+}
+
+// NewOutboxService - constructor function for OutboxService, the relay does nothing without the publisher
+func NewOutboxService(repo repository.Outbox, publisher broker.Publisher, config configs.ConfigOutbox) *OutboxService {
+	return &OutboxService{
+		repo:      repo,
+		publisher: publisher,
+		config:    config,
+	}
+}
+
+// RunOutbox - publishes the recorded events until the context is cancelled. A batch that failed
+// is published again on the next tick, so the broker receives every event at least once
+func (o *OutboxService) RunOutbox(ctx context.Context, onError func(err error)) {
+	if o.publisher == nil {
+		return
+	}
+	ticker := time.NewTicker(o.config.OutboxPollInterval)
+	defer ticker.Stop()
+	var cleaned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// a full batch means more events are waiting, they are published without waiting for the next tick
+		for ctx.Err() == nil {
+			n, err := o.publishBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					onError(fmt.Errorf("outbox publishing error: %w", err))
+				}
+				break
+			}
+			if n < o.config.OutboxBatch {
+				break
+			}
+		}
+		if time.Since(cleaned) >= outboxCleanupInterval {
+			if _, err := o.repo.DeletePublished(ctx, time.Now().Add(-o.config.OutboxRetention)); err != nil {
+				onError(fmt.Errorf("outbox cleanup error: %w", err))
+				continue
+			}
+			cleaned = time.Now()
+		}
+	}
+}
+
+// publishBatch - claims the oldest unpublished events, publishes them outside the database transaction
+// and marks them published, returns the number of the published events. The events that were not published
+// are released, the events that were published but not marked are published again when their claim expires
+func (o *OutboxService) publishBatch(ctx context.Context) (int, error) {
+	claimID, messages, err := o.repo.ClaimOutbox(ctx, o.config.OutboxBatch, o.config.OutboxLease)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+	if err = o.publisher.Publish(ctx, messages); err != nil {
+		if releaseErr := o.repo.ReleaseOutbox(ctx, claimID); releaseErr != nil {
+			return 0, fmt.Errorf("%w, release error: %s", err, releaseErr.Error())
+		}
+		return 0, err
+	}
+	if err = o.repo.MarkPublished(ctx, claimID); err != nil {
+		return 0, err
+	}
+	return len(messages), nil
+}
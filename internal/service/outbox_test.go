@@ -0,0 +1,219 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/broker"
+	"avito/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPublishBatchOrder(t *testing.T) {
+	repo := newMockOutboxRepo(1, 2, 1, 2, 1)
+	publisher := broker.NewMemoryPublisher()
+	outbox := NewOutboxService(repo, publisher, configs.ConfigOutbox{OutboxBatch: 2, OutboxLease: time.Minute})
+	tableTest := []struct {
+		testName      string
+		expectedCount int
+	}{
+		{"first batch", 2},
+		{"second batch", 2},
+		{"last batch", 1},
+		{"nothing left", 0},
+	}
+	for _, testCase := range tableTest {
+		n, err := outbox.publishBatch(context.Background())
+		assert.Nil(t, err, testCase.testName)
+		assert.Equal(t, testCase.expectedCount, n, testCase.testName)
+	}
+	assert.Equal(t, []string{"event-1", "event-2", "event-3", "event-4", "event-5"}, eventIDs(publisher.Messages()))
+	assert.Equal(t, 5, repo.published())
+}
+
+func TestPublishBatchRetry(t *testing.T) {
+	repo := newMockOutboxRepo(1, 2, 3)
+	publisher := &failingPublisher{MemoryPublisher: broker.NewMemoryPublisher(), failures: 1}
+	outbox := NewOutboxService(repo, publisher, configs.ConfigOutbox{OutboxBatch: 10, OutboxLease: time.Minute})
+
+	n, err := outbox.publishBatch(context.Background())
+	assert.NotNil(t, err, "failed publishing")
+	assert.Equal(t, 0, n, "failed publishing")
+	assert.Equal(t, 0, repo.published(), "failed publishing")
+	assert.Equal(t, 0, repo.claimed(), "the failed batch is released")
+
+	n, err = outbox.publishBatch(context.Background())
+	assert.Nil(t, err, "retry")
+	assert.Equal(t, 3, n, "retry")
+	assert.Equal(t, []string{"event-1", "event-2", "event-3"}, eventIDs(publisher.Messages()), "retry")
+	assert.Equal(t, 3, repo.published(), "retry")
+}
+
+func TestPublishBatchAtLeastOnce(t *testing.T) {
+	repo := newMockOutboxRepo(1, 2)
+	repo.markFailures = 1
+	publisher := broker.NewMemoryPublisher()
+	outbox := NewOutboxService(repo, publisher, configs.ConfigOutbox{OutboxBatch: 10, OutboxLease: time.Minute})
+
+	_, err := outbox.publishBatch(context.Background())
+	assert.NotNil(t, err, "the published batch is not marked")
+	assert.Equal(t, 2, repo.claimed(), "the claim is kept until it expires")
+
+	n, err := outbox.publishBatch(context.Background())
+	assert.Nil(t, err, "active claim")
+	assert.Equal(t, 0, n, "the claimed events are not published by another relay")
+
+	repo.expireClaims()
+	n, err = outbox.publishBatch(context.Background())
+	assert.Nil(t, err, "expired claim")
+	assert.Equal(t, 2, n, "expired claim")
+	// the consumers drop the duplicates by the event id
+	assert.Equal(t, []string{"event-1", "event-2", "event-1", "event-2"}, eventIDs(publisher.Messages()))
+	assert.Equal(t, 2, repo.published())
+}
+
+func TestPublishBatchClaimedByAnotherRelay(t *testing.T) {
+	repo := newMockOutboxRepo(1, 2, 3)
+	_, _, err := repo.ClaimOutbox(context.Background(), 1, time.Minute)
+	assert.Nil(t, err)
+	publisher := broker.NewMemoryPublisher()
+	outbox := NewOutboxService(repo, publisher, configs.ConfigOutbox{OutboxBatch: 10, OutboxLease: time.Minute})
+
+	n, err := outbox.publishBatch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n, "the later events wait for the claimed ones")
+	assert.Equal(t, 0, len(publisher.Messages()))
+}
+
+// eventIDs - returns the ids of the events in the order they were published
+func eventIDs(messages []models.OutboxMessage) []string {
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.EventID)
+	}
+	return ids
+}
+
+// failingPublisher - memory publisher that fails the given number of first calls
+type failingPublisher struct {
+	*broker.MemoryPublisher
+	failures int
+}
+
+func (f *failingPublisher) Publish(ctx context.Context, messages []models.OutboxMessage) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("broker is unavailable")
+	}
+	return f.MemoryPublisher.Publish(ctx, messages)
+}
+
+// mockOutboxEvent - event of the mock outbox with its claim
+type mockOutboxEvent struct {
+	message      models.OutboxMessage
+	claimID      string
+	claimedUntil time.Time
+	published    bool
+}
+
+// mockOutboxRepo - outbox in memory with the claims of the database one
+type mockOutboxRepo struct {
+	events       []*mockOutboxEvent
+	claims       int
+	markFailures int
+}
+
+func newMockOutboxRepo(userIDs ...int) *mockOutboxRepo {
+	repo := &mockOutboxRepo{}
+	for i, userID := range userIDs {
+		repo.events = append(repo.events, &mockOutboxEvent{message: models.OutboxMessage{
+			OutboxID:  int64(i + 1),
+			EventID:   fmt.Sprintf("event-%d", i+1),
+			EventType: models.EventFundsAccrued,
+			Key:       strconv.Itoa(userID),
+		}})
+	}
+	return repo
+}
+
+func (mr *mockOutboxRepo) ClaimOutbox(ctx context.Context, limit int,
+	lease time.Duration) (string, []models.OutboxMessage, error) {
+	for _, e := range mr.events {
+		if !e.published && e.claimedUntil.After(time.Now()) {
+			return "", nil, nil
+		}
+	}
+	mr.claims++
+	claimID := strconv.Itoa(mr.claims)
+	messages := make([]models.OutboxMessage, 0, limit)
+	for _, e := range mr.events {
+		if len(messages) == limit {
+			break
+		}
+		if e.published {
+			continue
+		}
+		e.claimID, e.claimedUntil = claimID, time.Now().Add(lease)
+		messages = append(messages, e.message)
+	}
+	return claimID, messages, nil
+}
+
+func (mr *mockOutboxRepo) MarkPublished(ctx context.Context, claimID string) error {
+	if mr.markFailures > 0 {
+		mr.markFailures--
+		return errors.New("connection reset")
+	}
+	for _, e := range mr.events {
+		if e.claimID == claimID && !e.published {
+			e.published, e.claimID, e.claimedUntil = true, "", time.Time{}
+		}
+	}
+	return nil
+}
+
+func (mr *mockOutboxRepo) ReleaseOutbox(ctx context.Context, claimID string) error {
+	for _, e := range mr.events {
+		if e.claimID == claimID && !e.published {
+			e.claimID, e.claimedUntil = "", time.Time{}
+		}
+	}
+	return nil
+}
+
+func (mr *mockOutboxRepo) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// published - returns the number of the events marked published
+func (mr *mockOutboxRepo) published() int {
+	n := 0
+	for _, e := range mr.events {
+		if e.published {
+			n++
+		}
+	}
+	return n
+}
+
+// claimed - returns the number of the unpublished events with an active claim
+func (mr *mockOutboxRepo) claimed() int {
+	n := 0
+	for _, e := range mr.events {
+		if !e.published && e.claimedUntil.After(time.Now()) {
+			n++
+		}
+	}
+	return n
+}
+
+// expireClaims - ends the leases of all claims, as if the relay holding them stopped
+func (mr *mockOutboxRepo) expireClaims() {
+	for _, e := range mr.events {
+		e.claimedUntil = time.Time{}
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+var errPeriod = errors.New("year and month must be set together")
+
+// firstYear - the year from which the service keeps the books
+const firstYear = 2007
+
+// ReconciliationService - reconciliation object in the service layer
+type ReconciliationService struct {
+	repo     repository.Reconciliation
+	location *time.Location
+}
+
+// NewReconciliationService - constructor function for ReconciliationService
+func NewReconciliationService(repo repository.Reconciliation, location *time.Location) *ReconciliationService {
+	return &ReconciliationService{
+		repo:     repo,
+		location: location,
+	}
+}
+
+// Reconcile - method compares users' balances and reservations with their transactions, the history
+// with the orders and the charged orders with the charges in the history
+func (r *ReconciliationService) Reconcile(ctx context.Context,
+	req models.ReconciliationRequest) (rec models.Reconciliation, code int, err error) {
+	ctx, span := tracing.Start(ctx, "ReconciliationService.Reconcile")
+	defer func() { tracing.End(span, code, err) }()
+	switch {
+	case req.Year == 0 && req.Month == 0:
+		req.From = time.Date(firstYear, time.January, 1, 0, 0, 0, 0, r.location)
+		req.To = time.Now().In(r.location)
+	case req.Year == 0 || req.Month == 0:
+		return rec, 400, errPeriod
+	case req.Year < firstYear:
+		return rec, 400, errYear
+	case req.Month < 1 || req.Month > 12:
+		return rec, 400, errMonth
+	default:
+		req.From = time.Date(req.Year, time.Month(req.Month), 1, 0, 0, 0, 0, r.location)
+		req.To = req.From.AddDate(0, 1, 0)
+	}
+	rec.From, rec.To = req.From, req.To
+	books, err := r.repo.GetBooks(ctx, req.From, req.To)
+	if err != nil {
+		return rec, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	rec.Balances = books.Balances
+	for i := range rec.Balances {
+		rec.Balances[i].Difference = roundAmount(rec.Balances[i].Balance + rec.Balances[i].Reserved -
+			rec.Balances[i].Ledger)
+	}
+	rec.Orders = books.Orders
+	rec.Orders.Difference = roundAmount(rec.Orders.Debited - rec.Orders.Ordered)
+	rec.Revenue = revenueDiscrepancies(books.ChargedRevenue, books.LedgerRevenue)
+	rec.Balanced = len(rec.Balances) == 0 && rec.Orders.Difference == 0 && len(rec.Revenue) == 0
+	return rec, 200, nil
+}
+
+// revenueDiscrepancies - compares the charged orders with the charges recorded in the history for the period
+func revenueDiscrepancies(charged, ledger map[int]float64) []models.RevenueDiscrepancy {
+	services := make(map[int]struct{}, len(charged))
+	for serviceID := range charged {
+		services[serviceID] = struct{}{}
+	}
+	for serviceID := range ledger {
+		services[serviceID] = struct{}{}
+	}
+	discrepancies := make([]models.RevenueDiscrepancy, 0)
+	for serviceID := range services {
+		difference := roundAmount(charged[serviceID] - ledger[serviceID])
+		if difference == 0 {
+			continue
+		}
+		discrepancies = append(discrepancies, models.RevenueDiscrepancy{
+			ServiceID:  serviceID,
+			Charged:    charged[serviceID],
+			Ledger:     ledger[serviceID],
+			Difference: difference,
+		})
+	}
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].ServiceID < discrepancies[j].ServiceID
+	})
+	return discrepancies
+}
+
+// roundAmount - rounds the amount to kopecks, so that float errors are not taken as discrepancies
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
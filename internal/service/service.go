@@ -2,28 +2,113 @@
 package service
 
 import (
+	"avito/configs"
+	"avito/internal/broker"
 	"avito/internal/models"
 	"avito/internal/repository"
+	"context"
+	"io"
+	"time"
 )
 
 // User - Interface describing the user entity
 type User interface {
-	AccrualFunds(ac models.AccrualFunds) (code int, err error)
-	GetBalance(ub *models.UserBalance) (code int, err error)
-	BlockFunds(order models.Order) (code int, err error)
-	TransferFunds(t models.Transfer) (code int, err error)
-	UnblockFunds(unblock models.Unblock) (code int, err error)
+	AccrualFunds(ctx context.Context, ac models.AccrualFunds) (code int, err error)
+	GetBalance(ctx context.Context, ub *models.UserBalance) (code int, err error)
+	BlockFunds(ctx context.Context, order models.Order) (code int, err error)
+	TransferFunds(ctx context.Context, t models.Transfer) (code int, err error)
+	UnblockFunds(ctx context.Context, unblock models.Unblock) (code int, err error)
+	AdjustBalance(ctx context.Context, adj models.Adjustment) (code int, err error)
 }
 
 // Order - Interface describing the order entity
 type Order interface {
-	ChargeFunds(order models.Order) (code int, err error)
-	GetReport(report models.Report) (data []byte, code int, err error)
+	ChargeFunds(ctx context.Context, order models.Order) (code int, err error)
+	GetReport(ctx context.Context, report models.Report) (data []byte, code int, err error)
+	GetOpenReservations(ctx context.Context) (count int64, amount float64, err error)
 }
 
 // Transaction - Interface describing the transaction entity
 type Transaction interface {
-	GetUserTransactions(tr models.TransactionListRequest) (tl []models.TransactionList, code int, err error)
+	GetUserTransactions(ctx context.Context, tr models.TransactionListRequest) (page models.TransactionPage, code int,
+		err error)
+	GetTransactionDetail(ctx context.Context, req models.TransactionDetailRequest) (detail models.TransactionDetail,
+		code int, err error)
+}
+
+// Reconciliation - Interface describing the reconciliation of the books
+type Reconciliation interface {
+	Reconcile(ctx context.Context, req models.ReconciliationRequest) (rec models.Reconciliation, code int, err error)
+}
+
+// Catalog - Interface describing the service catalog
+type Catalog interface {
+	UpsertService(ctx context.Context, s models.ServiceInfo) (code int, err error)
+	GetServices(ctx context.Context) (services []models.ServiceInfo, code int, err error)
+}
+
+// Journal - Interface describing the export of journal entries for the general ledger system
+type Journal interface {
+	ExportJournal(ctx context.Context, req models.JournalRequest) (data []byte, code int, err error)
+}
+
+// BulkExport - Interface describing streaming bulk exports of the tables
+type BulkExport interface {
+	PrepareExport(req *models.ExportRequest) (code int, err error)
+	Export(ctx context.Context, req models.ExportRequest, w io.Writer) error
+}
+
+// Stream - Interface describing the real-time subscription to the balance changes and new transactions
+type Stream interface {
+	RunStream(ctx context.Context, onError func(err error))
+	Subscribe(ctx context.Context, req models.StreamRequest) (sub *Subscription, code int, err error)
+}
+
+// Webhook - Interface describing the webhook subscriptions and the delivery of the events to them
+type Webhook interface {
+	CreateSubscription(ctx context.Context, s *models.WebhookSubscription) (code int, err error)
+	GetSubscriptions(ctx context.Context) (subscriptions []models.WebhookSubscription, code int, err error)
+	DeleteSubscription(ctx context.Context, id int) (code int, err error)
+	GetDeliveries(ctx context.Context, f models.WebhookDeliveryFilter) (deliveries []models.WebhookDelivery, code int,
+		err error)
+	ReplayDelivery(ctx context.Context, id int64) (code int, err error)
+	RunWebhooks(ctx context.Context, onError func(err error))
+}
+
+// Outbox - Interface describing the relay of the domain events to the message broker
+type Outbox interface {
+	RunOutbox(ctx context.Context, onError func(err error))
+}
+
+// Command - Interface describing the execution of the commands received from the message broker
+type Command interface {
+	RunCommands(ctx context.Context, onError func(err error))
+	HandleCommand(ctx context.Context, cmd models.Command) error
+}
+
+// Health - Interface describing the checks of the dependencies for the readiness of the service
+type Health interface {
+	CheckReadiness(ctx context.Context) []models.HealthCheck
+}
+
+// Auth - Interface describing the API keys of the client services and the check of their scopes
+type Auth interface {
+	IssueAPIKey(ctx context.Context, key *models.APIKey) (code int, err error)
+	GetAPIKeys(ctx context.Context) (keys []models.APIKey, code int, err error)
+	RevokeAPIKey(ctx context.Context, id int) (code int, err error)
+	Authorize(ctx context.Context, key, scope string) (client models.APIKey, code int, err error)
+}
+
+// Audit - Interface describing the append-only audit log of the mutating calls
+type Audit interface {
+	WithAudit(ctx context.Context, status int, entry func() models.AuditEntry) (context.Context,
+		*repository.AuditRecord)
+	RecordAudit(ctx context.Context, e models.AuditEntry) error
+	GetAudit(ctx context.Context, f models.AuditFilter) (entries []models.AuditEntry, code int, err error)
+	PrepareAudit(f *models.AuditFilter) (code int, err error)
+	ExportAudit(ctx context.Context, f models.AuditFilter, w io.Writer) error
+	VerifyAudit(ctx context.Context) (v models.AuditVerification, code int, err error)
+	RunAudit(ctx context.Context, onError func(err error))
 }
 
 // Service - object responsible for the operation of the internal logic
@@ -31,13 +116,43 @@ type Service struct {
 	User
 	Order
 	Transaction
+	Reconciliation
+	Catalog
+	Journal
+	BulkExport
+	Stream
+	Webhook
+	Outbox
+	Command
+	Health
+	Auth
+	Audit
 }
 
-// NewService - constructor function for Service
-func NewService(repository *repository.Repository) *Service {
+// NewService - constructor function for Service, location is the accounting time zone
+// in which report periods and statements are calculated. The publisher and the consumer are nil
+// when the events are not published and the commands are not consumed
+func NewService(repository *repository.Repository, location *time.Location, config *configs.Common,
+	publisher broker.Publisher, consumer broker.Consumer) *Service {
+	users := NewUserService(repository.User)
+	orders := NewOrderService(repository.Order, location)
+	audit := NewAuditService(repository.Audit, location, config.ConfigAudit)
+	catalog := newCatalogCache(repository.Catalog)
 	return &Service{
-		User:        NewUserService(repository.User),
-		Order:       NewOrderService(repository.Order),
-		Transaction: NewTransactionService(repository.Transaction),
+		User:           users,
+		Order:          orders,
+		Transaction:    NewTransactionService(repository.Transaction, repository.Order, catalog, location),
+		Reconciliation: NewReconciliationService(repository.Reconciliation, location),
+		Catalog:        NewCatalogService(repository.Catalog, catalog),
+		Journal:        NewJournalService(repository.Journal, repository.Catalog, config.ConfigJournal, location),
+		BulkExport:     NewExportService(repository.Export, location),
+		Stream:         NewStreamService(repository.Stream, repository.User, catalog, location),
+		Webhook:        NewWebhookService(repository.Webhook, config.ConfigWebhooks),
+		Outbox:         NewOutboxService(repository.Outbox, publisher, config.ConfigOutbox),
+		Command: NewCommandService(users, orders, audit, repository.Command, consumer,
+			config.ConfigCommands),
+		Health: NewHealthService(repository.Health, config.ConfigHealth),
+		Auth:   NewAuthService(repository.Auth),
+		Audit:  audit,
 	}
 }
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriptionBuffer - number of live events buffered for a subscriber, a subscriber that falls
+	// further behind is disconnected and resumes from its last event id
+	subscriptionBuffer = 64
+	// listenRetryMax - maximum delay before listening again after the connection failed
+	listenRetryMax = 30 * time.Second
+	// replayPageSize - number of the missed transactions read at once, the replay is read page by page
+	// as the client receives them
+	replayPageSize = 1000
+)
+
+var errStreamStopped = errors.New("the server is shutting down")
+
+// Subscription - stream of the events of the user: the replay of the missed transactions and the current
+// balance first, then the live events. Events is closed when the subscription ends
+type Subscription struct {
+	Events <-chan models.StreamEvent
+	// Cancel releases the subscription, it must be called when the client disconnects
+	Cancel func()
+}
+
+// subscriber - registered receiver of the live events of the user
+type subscriber struct {
+	userID int
+	events chan models.TransactionEvent
+}
+
+// StreamService - object in the service layer that fans out the committed transactions to the subscribers.
+// The transactions come from the database notifications, so the events of all replicas are delivered
+type StreamService struct {
+	repo        repository.Stream
+	users       repository.User
+	catalog     *catalogCache
+	location    *time.Location
+	mu          sync.Mutex
+	subscribers map[int]map[*subscriber]struct{}
+	stopped     bool
+}
+
+// NewStreamService - constructor function for StreamService
+func NewStreamService(repo repository.Stream, users repository.User, catalog *catalogCache,
+	location *time.Location) *StreamService {
+	return &StreamService{
+		repo:        repo,
+		users:       users,
+		catalog:     catalog,
+		location:    location,
+		subscribers: make(map[int]map[*subscriber]struct{}),
+	}
+}
+
+// RunStream - listens to the committed transactions until the context is cancelled, reconnecting with
+// a growing delay when the connection fails. When it stops all subscriptions are closed
+func (s *StreamService) RunStream(ctx context.Context, onError func(err error)) {
+	delay := time.Second
+	for {
+		err := s.repo.ListenTransactions(ctx, s.publish)
+		if ctx.Err() != nil {
+			s.closeAll()
+			return
+		}
+		onError(fmt.Errorf("transaction listener error: %w", err))
+		select {
+		case <-ctx.Done():
+			s.closeAll()
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > listenRetryMax {
+			delay = listenRetryMax
+		}
+	}
+}
+
+// Subscribe - subscribes to the balance changes and new transactions of the user. All transactions made
+// after LastEventID are replayed before the live events, the subscription ends if the replay fails
+func (s *StreamService) Subscribe(ctx context.Context, req models.StreamRequest) (sub *Subscription, code int,
+	err error) {
+	ctx, span := tracing.Start(ctx, "StreamService.Subscribe")
+	defer func() { tracing.End(span, code, err) }()
+	if req.UserID < 1 {
+		return nil, 400, errUser
+	}
+	if req.LastEventID < 0 {
+		return nil, 400, fmt.Errorf("last event id must not be negative")
+	}
+	live := &subscriber{userID: req.UserID, events: make(chan models.TransactionEvent, subscriptionBuffer)}
+	// the subscriber is registered before the replay is read, so no transaction falls between them
+	if !s.register(live) {
+		return nil, 503, errStreamStopped
+	}
+	balance, err := s.users.GetBalance(ctx, &models.UserBalance{UserID: req.UserID})
+	if err != nil {
+		s.unregister(live)
+		if err.Error() == errNoRows {
+			return nil, 400, fmt.Errorf("user with id %d does not exist", req.UserID)
+		}
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	replay := make([]models.TransactionList, 0)
+	if req.LastEventID != 0 {
+		replay, err = s.repo.GetTransactionsAfter(ctx, req.UserID, req.LastEventID, replayPageSize)
+		if err != nil {
+			s.unregister(live)
+			return nil, 500, fmt.Errorf("database error: %s", err.Error())
+		}
+	}
+	names, err := s.catalog.Names(ctx)
+	if err != nil {
+		s.unregister(live)
+		return nil, 500, err
+	}
+	events := make(chan models.StreamEvent, subscriptionBuffer)
+	// the stream outlives the request, its queries are cancelled when the subscription ends
+	streamCtx, stop := context.WithCancel(context.Background())
+	done := streamCtx.Done()
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.unregister(live)
+			stop()
+		})
+	}
+	go func() {
+		defer close(events)
+		defer cancel()
+		// the error of the goroutine is its own, Subscribe has already returned
+		var err error
+		lastID := req.LastEventID
+		send := func(event models.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		replayed := len(replay) != 0
+		for len(replay) != 0 {
+			for _, tr := range replay {
+				if !send(s.transactionEvent(tr, req.Language, names)) {
+					return
+				}
+				lastID = tr.TransactionID
+			}
+			if len(replay) < replayPageSize {
+				break
+			}
+			if names, err = s.catalog.Names(streamCtx); err != nil {
+				return
+			}
+			if replay, err = s.repo.GetTransactionsAfter(streamCtx, req.UserID, lastID, replayPageSize); err != nil {
+				return
+			}
+		}
+		// the replay may contain the transactions committed after the balance was read, their live events
+		// are skipped, so the balance is read again
+		if replayed {
+			if balance, err = s.users.GetBalance(streamCtx, &models.UserBalance{UserID: req.UserID}); err != nil {
+				return
+			}
+		}
+		if !send(models.StreamEvent{Type: models.EventBalance, Data: balance}) {
+			return
+		}
+		for {
+			select {
+			case event, ok := <-live.events:
+				if !ok {
+					return
+				}
+				if event.TransactionID <= lastID {
+					continue
+				}
+				if names, err = s.catalog.Names(streamCtx); err != nil {
+					return
+				}
+				lastID = event.TransactionID
+				if !send(s.transactionEvent(event.TransactionList, req.Language, names)) {
+					return
+				}
+				ub := &models.UserBalance{UserID: event.UserID, Balance: event.Balance}
+				if !send(models.StreamEvent{Type: models.EventBalance, Data: ub}) {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return &Subscription{Events: events, Cancel: cancel}, 200, nil
+}
+
+// transactionEvent - makes the event of the transaction with the description in the requested language
+func (s *StreamService) transactionEvent(tr models.TransactionList, language string,
+	names map[int]string) models.StreamEvent {
+	tr.Date = tr.Date.In(s.location)
+	describe(&tr, language, names)
+	return models.StreamEvent{ID: strconv.Itoa(tr.TransactionID), Type: models.EventTransaction, Data: tr}
+}
+
+// publish - passes the committed transaction to the subscribers of the user, a subscriber whose buffer
+// is full is dropped
+func (s *StreamService) publish(event models.TransactionEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers[event.UserID] {
+		select {
+		case sub.events <- event:
+		default:
+			s.remove(sub)
+		}
+	}
+}
+
+// register - adds the subscriber of the live events, returns false when the stream is stopped
+func (s *StreamService) register(sub *subscriber) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	if s.subscribers[sub.userID] == nil {
+		s.subscribers[sub.userID] = make(map[*subscriber]struct{})
+	}
+	s.subscribers[sub.userID][sub] = struct{}{}
+	return true
+}
+
+// unregister - removes the subscriber if it has not been removed yet
+func (s *StreamService) unregister(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(sub)
+}
+
+// remove - removes the subscriber and closes its channel, the caller holds the lock
+func (s *StreamService) remove(sub *subscriber) {
+	subs, ok := s.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok = subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(s.subscribers, sub.userID)
+	}
+	close(sub.events)
+}
+
+// closeAll - ends all subscriptions and rejects the new ones, so the streaming responses finish on shutdown
+func (s *StreamService) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for _, subs := range s.subscribers {
+		for sub := range subs {
+			s.remove(sub)
+		}
+	}
+}
@@ -3,34 +3,355 @@ package service
 import (
 	"avito/internal/models"
 	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var errEmptyList = errors.New("user has no transactions")
+var (
+	errEmptyList    = errors.New("user has no transactions")
+	errSortSpec     = errors.New("sort and order_by cannot be used together")
+	errDateRange    = errors.New("date_from must be earlier than date_to")
+	errAmountRange  = errors.New("amount_min must not be greater than amount_max")
+	errAmountFilter = errors.New("amount range must not be negative")
+	errOrderFilter  = errors.New("order id must not be less than 0")
+	errCursor       = errors.New("invalid cursor")
+	errCursorSort   = errors.New("cursor does not match the sort order of the request")
+	errCursorOffset = errors.New("cursor and offset cannot be used together")
+	errTransaction  = errors.New("transaction id must not be less than 1")
+)
+
+// reversalOperations - operations that reverse the transaction of the order
+var reversalOperations = map[string][]string{
+	models.OperationReservation: {models.OperationCancellation, models.OperationRefund},
+	models.OperationCharge:      {models.OperationRefund},
+}
+
+// defaultSort - the history is shown from the newest transactions by default
+var defaultSort = []models.SortKey{{Field: models.SortDate, Direction: models.SortDesc}}
+
+// sortAliases - accepted names of the sort keys
+var sortAliases = map[string]string{
+	models.SortAmount: models.SortAmount,
+	models.SortDate:   models.SortDate,
+	"date":            models.SortDate,
+}
 
 // TransactionService - transaction object in the service layer
 type TransactionService struct {
-	repo repository.Transaction
+	repo     repository.Transaction
+	orders   repository.Order
+	catalog  *catalogCache
+	location *time.Location
 }
 
 // NewTransactionService - constructor function for TransactionService
-func NewTransactionService(repo repository.Transaction) *TransactionService {
+func NewTransactionService(repo repository.Transaction, orders repository.Order, catalog *catalogCache,
+	location *time.Location) *TransactionService {
 	return &TransactionService{
-		repo: repo,
+		repo:     repo,
+		orders:   orders,
+		catalog:  catalog,
+		location: location,
 	}
 }
 
-// GetUserTransactions - method to get list of user's transactions
-func (t *TransactionService) GetUserTransactions(tr models.TransactionListRequest) (tl []models.TransactionList, code int, err error) {
+// GetUserTransactions - method to get list of user's transactions. When the limit is set and there are
+// more rows, the page contains the cursor of the next page
+func (t *TransactionService) GetUserTransactions(ctx context.Context,
+	tr models.TransactionListRequest) (page models.TransactionPage, code int, err error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetUserTransactions")
+	defer func() { tracing.End(span, code, err) }()
 	if tr.UserID < 1 {
-		return nil, 400, errUser
+		return page, 400, errUser
+	}
+	if err = validateFilter(tr.TransactionFilter); err != nil {
+		return page, 400, err
+	}
+	if len(tr.Sort) != 0 {
+		if tr.OrderBy != "" {
+			return page, 400, errSortSpec
+		}
+		tr.Sort, err = validateSort(tr.Sort)
+	} else {
+		tr.Sort, err = parseOrderBy(tr.OrderBy)
+	}
+	if err != nil {
+		return page, 400, err
+	}
+	signature := sortSignature(tr.Sort)
+	if tr.Cursor != "" {
+		if tr.Offset != 0 {
+			return page, 400, errCursorOffset
+		}
+		tr.After, err = decodeCursor(tr.Cursor, signature, tr.Sort)
+		if err != nil {
+			return page, 400, err
+		}
+	}
+	tl, err := t.repo.GetUserTransactions(ctx, tr)
+	if err != nil {
+		return page, 500, err
+	}
+	// the aggregates of no transactions are zero, they are not an error
+	if len(tl) == 0 && tr.After == nil && !tr.WithTotal && !tr.WithSummary {
+		return page, 400, errEmptyList
+	}
+	if tr.Limit != 0 && len(tl) > tr.Limit {
+		tl = tl[:tr.Limit]
+		page.NextCursor, err = encodeCursor(signature, tr.Sort, tl[len(tl)-1])
+		if err != nil {
+			return page, 500, err
+		}
+	}
+	names, err := t.catalog.Names(ctx)
+	if err != nil {
+		return page, 500, err
+	}
+	for i := range tl {
+		tl[i].Date = tl[i].Date.In(t.location)
+		describe(&tl[i], tr.Language, names)
+	}
+	page.Transactions = tl
+	if tr.WithTotal || tr.WithSummary {
+		summary, err := t.repo.SummarizeUserTransactions(ctx, tr)
+		if err != nil {
+			return page, 500, err
+		}
+		summary.Net = roundAmount(summary.Incoming - summary.Outgoing)
+		if tr.WithTotal {
+			page.Total = &summary.Count
+		}
+		if tr.WithSummary {
+			page.Summary = &summary
+		}
+	}
+	return page, 200, nil
+}
+
+// GetTransactionDetail - method returns the transaction with its linked entities. The transaction
+// of another user than the one of the request is reported as missing, 0 is any user
+func (t *TransactionService) GetTransactionDetail(ctx context.Context,
+	req models.TransactionDetailRequest) (detail models.TransactionDetail, code int, err error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetTransactionDetail")
+	defer func() { tracing.End(span, code, err) }()
+	if req.TransactionID < 1 {
+		return detail, 400, errTransaction
+	}
+	if req.UserID < 0 {
+		return detail, 400, errUser
+	}
+	notFound := fmt.Errorf("transaction with id %d does not exist", req.TransactionID)
+	detail.Transaction, err = t.repo.GetTransaction(ctx, req.TransactionID)
+	if err != nil {
+		if err.Error() == errNoRows {
+			return detail, 404, notFound
+		}
+		return detail, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	if req.UserID != 0 && detail.Transaction.UserID != req.UserID {
+		return models.TransactionDetail{}, 404, notFound
+	}
+	detail.Mirror, err = t.repo.GetMirrorTransaction(ctx, detail.Transaction)
+	if err != nil {
+		return detail, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	detail.Reversals = make([]models.TransactionList, 0)
+	if orderID := detail.Transaction.OrderID; orderID != nil {
+		order, err := t.orders.GetOrderDetail(ctx, *orderID)
+		if err != nil && err.Error() != errNoRows {
+			return detail, 500, fmt.Errorf("database error: %s", err.Error())
+		}
+		if err == nil {
+			order.Date = order.Date.In(t.location)
+			detail.Order = &order
+		}
+		if operations, ok := reversalOperations[detail.Transaction.Operation]; ok {
+			detail.Reversals, err = t.repo.GetOrderReversals(ctx, *orderID, detail.Transaction.TransactionID, operations)
+			if err != nil {
+				return detail, 500, fmt.Errorf("database error: %s", err.Error())
+			}
+		}
+	}
+	names, err := t.catalog.Names(ctx)
+	if err != nil {
+		return detail, 500, err
+	}
+	detail.Transaction.Date = detail.Transaction.Date.In(t.location)
+	describe(&detail.Transaction, req.Language, names)
+	if detail.Mirror != nil {
+		detail.Mirror.Date = detail.Mirror.Date.In(t.location)
+		describe(detail.Mirror, req.Language, names)
+	}
+	for i := range detail.Reversals {
+		detail.Reversals[i].Date = detail.Reversals[i].Date.In(t.location)
+		describe(&detail.Reversals[i], req.Language, names)
 	}
-	tl, err = t.repo.GetUserTransactions(tr)
+	return detail, 200, nil
+}
+
+// parseOrderBy - parses the comma separated list of sort keys with optional directions,
+// for example "amount desc, date_time". Only whitelisted keys are accepted
+func parseOrderBy(orderBy string) ([]models.SortKey, error) {
+	if strings.TrimSpace(orderBy) == "" {
+		return defaultSort, nil
+	}
+	parts := strings.Split(orderBy, ",")
+	sort := make([]models.SortKey, 0, len(parts))
+	for _, part := range parts {
+		words := strings.Fields(strings.ToLower(part))
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("invalid sort key %q", strings.TrimSpace(part))
+		}
+		field, ok := sortAliases[words[0]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported sort key %q, allowed: amount, date_time", words[0])
+		}
+		key := models.SortKey{Field: field, Direction: models.SortAsc}
+		if len(words) == 2 {
+			if words[1] != models.SortAsc && words[1] != models.SortDesc {
+				return nil, fmt.Errorf("unsupported sort direction %q, allowed: asc, desc", words[1])
+			}
+			key.Direction = words[1]
+		}
+		sort = append(sort, key)
+	}
+	return sort, nil
+}
+
+// validateSort - checks the structured sort keys against the whitelist, the direction is ascending by default
+func validateSort(keys []models.SortKey) ([]models.SortKey, error) {
+	sort := make([]models.SortKey, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		field, ok := sortAliases[strings.ToLower(key.Field)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported sort key %q, allowed: amount, date_time", key.Field)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("sort key %q is repeated", key.Field)
+		}
+		seen[field] = true
+		direction := strings.ToLower(key.Direction)
+		switch direction {
+		case "":
+			direction = models.SortAsc
+		case models.SortAsc, models.SortDesc:
+		default:
+			return nil, fmt.Errorf("unsupported sort direction %q, allowed: asc, desc", key.Direction)
+		}
+		sort = append(sort, models.SortKey{Field: field, Direction: direction})
+	}
+	return sort, nil
+}
+
+// validateFilter - checks the consistency of the history filter
+func validateFilter(f models.TransactionFilter) error {
+	if f.DateFrom != nil && f.DateTo != nil && !f.DateFrom.Before(*f.DateTo) {
+		return errDateRange
+	}
+	if (f.AmountMin != nil && *f.AmountMin < 0) || (f.AmountMax != nil && *f.AmountMax < 0) {
+		return errAmountFilter
+	}
+	if f.AmountMin != nil && f.AmountMax != nil && *f.AmountMin > *f.AmountMax {
+		return errAmountRange
+	}
+	switch f.Direction {
+	case "", models.DirectionIn, models.DirectionOut:
+	default:
+		return fmt.Errorf("unsupported direction %q, allowed: in, out", f.Direction)
+	}
+	if f.Operation != "" && !isOperation(f.Operation) {
+		return fmt.Errorf("unsupported operation %q, allowed: %s", f.Operation, strings.Join(models.Operations, ", "))
+	}
+	if f.OrderID < 0 {
+		return errOrderFilter
+	}
+	if f.CounterpartyID < 0 {
+		return errUser
+	}
+	return nil
+}
+
+// isOperation - reports whether the operation is one of the operations of the transactions
+func isOperation(operation string) bool {
+	for _, op := range models.Operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// sortSignature - canonical representation of the sort stored in the cursor
+func sortSignature(sort []models.SortKey) string {
+	keys := make([]string, 0, len(sort))
+	for _, key := range sort {
+		keys = append(keys, key.Field+" "+key.Direction)
+	}
+	return strings.Join(keys, ",")
+}
+
+// encodeCursor - encodes the position after the transaction into an opaque cursor
+func encodeCursor(signature string, sort []models.SortKey, last models.TransactionList) (string, error) {
+	cursor := models.PageCursor{
+		Sort:          signature,
+		Values:        make([]string, 0, len(sort)),
+		TransactionID: last.TransactionID,
+	}
+	for _, key := range sort {
+		switch key.Field {
+		case models.SortAmount:
+			cursor.Values = append(cursor.Values, strconv.FormatFloat(last.Amount, 'f', -1, 64))
+		case models.SortDate:
+			cursor.Values = append(cursor.Values, last.Date.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor - decodes the cursor and checks that it was issued for the same sort
+// and that its values are of the types of the sort keys
+func decodeCursor(value, signature string, sort []models.SortKey) (*models.PageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
 	if err != nil {
-		return nil, 500, err
+		return nil, errCursor
+	}
+	var cursor models.PageCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, errCursor
+	}
+	if cursor.Sort != signature {
+		return nil, errCursorSort
+	}
+	if len(cursor.Values) != len(sort) || cursor.TransactionID < 1 {
+		return nil, errCursor
 	}
-	if len(tl) == 0 {
-		return nil, 400, errEmptyList
+	for i, key := range sort {
+		switch key.Field {
+		case models.SortAmount:
+			amount, err := strconv.ParseFloat(cursor.Values[i], 64)
+			if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+				return nil, errCursor
+			}
+		case models.SortDate:
+			if _, err = time.Parse(time.RFC3339Nano, cursor.Values[i]); err != nil {
+				return nil, errCursor
+			}
+		default:
+			return nil, errCursor
+		}
 	}
-	return tl, 200, nil
+	return &cursor, nil
 }
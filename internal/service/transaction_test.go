@@ -0,0 +1,87 @@
+package service
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetUserTransactionsOperation(t *testing.T) {
+	repo := &mockTransactionRepo{}
+	transactions := NewTransactionService(repo, nil, newCatalogCache(mockCatalogRepo{}), time.UTC)
+	// each operation of the transactions and no operation filter the history
+	for _, operation := range append([]string{""}, models.Operations...) {
+		tr := models.TransactionListRequest{UserID: 1, Limit: 10}
+		tr.Operation = operation
+		page, code, err := transactions.GetUserTransactions(context.Background(), tr)
+		assert.Equal(t, 200, code, operation)
+		if assert.Nil(t, err, operation) {
+			assert.Equal(t, operation, repo.filter.Operation, operation)
+			assert.Len(t, page.Transactions, 1, operation)
+		}
+	}
+
+	tr := models.TransactionListRequest{UserID: 1, Limit: 10}
+	tr.Operation = "payout"
+	_, code, err := transactions.GetUserTransactions(context.Background(), tr)
+	assert.Equal(t, 400, code, "unknown operation")
+	if assert.NotNil(t, err, "unknown operation") {
+		assert.Equal(t, `unsupported operation "payout", allowed: accrual, reservation, charge, cancellation, `+
+			"transfer_in, transfer_out, refund, adjustment", err.Error(), "unknown operation")
+	}
+}
+
+func TestOperationsDocumented(t *testing.T) {
+	field, _ := reflect.TypeOf(models.TransactionFilter{}).FieldByName("Operation")
+	assert.Equal(t, strings.Join(models.Operations, ","), field.Tag.Get("enums"), "swagger enum")
+	readme, err := os.ReadFile("../../README.md")
+	if !assert.Nil(t, err) {
+		return
+	}
+	// the operations of the history filter are listed in one sentence
+	text := strings.Join(strings.Fields(string(readme)), " ")
+	i := strings.Index(text, "operation - `")
+	if !assert.True(t, i >= 0, "README") {
+		return
+	}
+	sentence := text[i:]
+	sentence = sentence[:strings.Index(sentence, ".")]
+	parts := strings.Split(sentence, "`")
+	documented := make([]string, 0, len(parts)/2)
+	for j := 1; j < len(parts); j += 2 {
+		documented = append(documented, parts[j])
+	}
+	assert.Equal(t, models.Operations, documented, "README")
+}
+
+// mockTransactionRepo - history of one transaction of the filtered operation, keeps the last filter
+type mockTransactionRepo struct {
+	repository.Transaction
+	filter models.TransactionFilter
+}
+
+func (mr *mockTransactionRepo) GetUserTransactions(ctx context.Context,
+	tr models.TransactionListRequest) ([]models.TransactionList, error) {
+	mr.filter = tr.TransactionFilter
+	operation := tr.Operation
+	if operation == "" {
+		operation = models.OperationAccrual
+	}
+	return []models.TransactionList{{TransactionID: 1, UserID: tr.UserID, Amount: 10, Operation: operation,
+		Date: time.Now()}}, nil
+}
+
+// mockCatalogRepo - empty catalog of the services
+type mockCatalogRepo struct {
+	repository.Catalog
+}
+
+func (mr mockCatalogRepo) GetServices(ctx context.Context) ([]models.ServiceInfo, error) {
+	return nil, nil
+}
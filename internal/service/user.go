@@ -1,10 +1,14 @@
 package service
 
 import (
+	"avito/internal/metrics"
 	"avito/internal/models"
 	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -14,8 +18,14 @@ var (
 	errService = errors.New("service id must not be less than 1")
 	errOrder   = errors.New("order id must not be less than 1")
 	errNoRows  = "no rows in result set"
+	errRefund  = errors.New("the refund must refer to the order")
+	errAdjust  = errors.New("the adjustment amount must not be 0")
+	errReason  = errors.New("the reason of the adjustment must not be empty")
 )
 
+// operationTransfer - operation of the metrics for a transfer, it is recorded in the history of both users
+const operationTransfer = "transfer"
+
 // UserService - user object in the service layer
 type UserService struct {
 	repo repository.User
@@ -29,23 +39,44 @@ func NewUserService(repo repository.User) *UserService {
 }
 
 // AccrualFunds - method of accruing cash to the balance
-func (u *UserService) AccrualFunds(ac models.AccrualFunds) (code int, err error) {
+func (u *UserService) AccrualFunds(ctx context.Context, ac models.AccrualFunds) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.AccrualFunds")
+	defer func() { tracing.End(span, code, err) }()
+	defer func() {
+		operation := models.OperationAccrual
+		if ac.Operation == models.OperationRefund {
+			operation = models.OperationRefund
+		}
+		metrics.ObserveOperation(operation, ac.Amount, code)
+	}()
 	if ac.Amount <= 0 {
 		return 400, errAmount
 	}
 	if ac.UserID < 1 {
 		return 400, errUser
 	}
-	ac.Message = "replenishment of the balance"
-	err = u.repo.AccrualFunds(ac)
+	if ac.Operation == models.OperationRefund && ac.OrderID < 1 {
+		return 400, errRefund
+	}
+	if ac.Operation != models.OperationRefund {
+		ac.Operation = models.OperationAccrual
+		ac.OrderID = 0
+	}
+	err = u.repo.AccrualFunds(ctx, ac)
 	if err != nil {
+		if errors.Is(err, repository.ErrRefund) {
+			return 400, err
+		}
 		return 500, fmt.Errorf("database error: %s", err.Error())
 	}
 	return 200, nil
 }
 
 // BlockFunds - method of reserving funds from the main balance in a separate account
-func (u *UserService) BlockFunds(order models.Order) (code int, err error) {
+func (u *UserService) BlockFunds(ctx context.Context, order models.Order) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.BlockFunds")
+	defer func() { tracing.End(span, code, err) }()
+	defer func() { metrics.ObserveOperation(models.OperationReservation, order.Amount, code) }()
 	if order.Amount <= 0 {
 		return 400, errAmount
 	}
@@ -58,9 +89,9 @@ func (u *UserService) BlockFunds(order models.Order) (code int, err error) {
 	if order.OrderID < 1 {
 		return 400, errOrder
 	}
-	order.Date = time.Now().Truncate(time.Second)
+	order.Date = time.Now().UTC().Truncate(time.Second)
 	order.Block = true
-	err = u.repo.BlockFunds(order)
+	err = u.repo.BlockFunds(ctx, order)
 	if err != nil {
 		if err.Error() == errNoRows {
 			return 400, fmt.Errorf("user with id %d does not exist", order.UserID)
@@ -71,11 +102,14 @@ func (u *UserService) BlockFunds(order models.Order) (code int, err error) {
 }
 
 // UnblockFunds - method of reserving money if it was not possible to apply the service
-func (u *UserService) UnblockFunds(unblock models.Unblock) (code int, err error) {
+func (u *UserService) UnblockFunds(ctx context.Context, unblock models.Unblock) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UnblockFunds")
+	defer func() { tracing.End(span, code, err) }()
+	defer func() { metrics.ObserveOperation(models.OperationCancellation, unblock.Amount, code) }()
 	if unblock.OrderID < 1 {
 		return 400, errOrder
 	}
-	err = u.repo.UnblockFunds(unblock)
+	err = u.repo.UnblockFunds(ctx, &unblock)
 	if err != nil {
 		if err.Error() == errNoRows {
 			return 400, fmt.Errorf("it is not possible to unlock funds for this order")
@@ -86,11 +120,13 @@ func (u *UserService) UnblockFunds(unblock models.Unblock) (code int, err error)
 }
 
 // GetBalance - method to get user balance
-func (u *UserService) GetBalance(ub *models.UserBalance) (code int, err error) {
+func (u *UserService) GetBalance(ctx context.Context, ub *models.UserBalance) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetBalance")
+	defer func() { tracing.End(span, code, err) }()
 	if ub.UserID < 1 {
 		return 400, errUser
 	}
-	ub, err = u.repo.GetBalance(ub)
+	ub, err = u.repo.GetBalance(ctx, ub)
 	if err != nil {
 		if err.Error() == errNoRows {
 			return 400, fmt.Errorf("user with id %d does not exist", ub.UserID)
@@ -102,15 +138,42 @@ func (u *UserService) GetBalance(ub *models.UserBalance) (code int, err error) {
 }
 
 // TransferFunds - method for transferring funds between users
-func (u *UserService) TransferFunds(t models.Transfer) (code int, err error) {
+func (u *UserService) TransferFunds(ctx context.Context, t models.Transfer) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.TransferFunds")
+	defer func() { tracing.End(span, code, err) }()
+	defer func() { metrics.ObserveOperation(operationTransfer, t.Amount, code) }()
 	if t.SenderID < 1 || t.ReceiverID < 1 {
 		return 400, errUser
 	}
 	if t.Amount <= 0 {
 		return 400, errAmount
 	}
-	err = u.repo.TransferFunds(t)
+	err = u.repo.TransferFunds(ctx, t)
+	if err != nil {
+		return 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return 200, nil
+}
+
+// AdjustBalance - method of the manual correction of the balance, the balance can't become negative
+func (u *UserService) AdjustBalance(ctx context.Context, adj models.Adjustment) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.AdjustBalance")
+	defer func() { tracing.End(span, code, err) }()
+	defer func() { metrics.ObserveOperation(models.OperationAdjustment, adj.Amount, code) }()
+	if adj.UserID < 1 {
+		return 400, errUser
+	}
+	if adj.Amount == 0 {
+		return 400, errAdjust
+	}
+	if strings.TrimSpace(adj.Comment) == "" {
+		return 400, errReason
+	}
+	err = u.repo.AdjustBalance(ctx, adj)
 	if err != nil {
+		if errors.Is(err, repository.ErrAdjustment) {
+			return 400, err
+		}
 		return 500, fmt.Errorf("database error: %s", err.Error())
 	}
 	return 200, nil
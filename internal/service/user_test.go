@@ -0,0 +1,94 @@
+package service
+
+import (
+	"avito/internal/models"
+	"avito/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAdjustBalance(t *testing.T) {
+	tableTest := []struct {
+		testName        string
+		data            models.Adjustment
+		expectedCode    int
+		expectedMessage string
+	}{
+		{
+			"invalid user id",
+			models.Adjustment{UserID: 0, Amount: 10, Comment: "missed accrual"},
+			400,
+			"user id must not be less than 1",
+		},
+		{
+			"zero amount",
+			models.Adjustment{UserID: 1, Amount: 0, Comment: "missed accrual"},
+			400,
+			"the adjustment amount must not be 0",
+		},
+		{
+			"empty reason",
+			models.Adjustment{UserID: 1, Amount: 10, Comment: " "},
+			400,
+			"the reason of the adjustment must not be empty",
+		},
+		{
+			"valid data",
+			models.Adjustment{UserID: 1, Amount: -40, Comment: "duplicate accrual"},
+			200,
+			"",
+		},
+		{
+			"insufficient funds",
+			models.Adjustment{UserID: 1, Amount: -150, Comment: "duplicate accrual"},
+			400,
+			"adjustment is not possible: the balance 100.00 of the user 1 is less than the debit 150.00",
+		},
+		{
+			"unknown user",
+			models.Adjustment{UserID: 3, Amount: 10, Comment: "missed accrual"},
+			400,
+			"adjustment is not possible: user with id 3 does not exist",
+		},
+		{
+			"internal error",
+			models.Adjustment{UserID: 2, Amount: 10, Comment: "missed accrual"},
+			500,
+			"database error: connection reset",
+		},
+	}
+	users := NewUserService(mockUserRepo{})
+	for _, testCase := range tableTest {
+		code, err := users.AdjustBalance(context.Background(), testCase.data)
+		assert.Equal(t, testCase.expectedCode, code, testCase.testName)
+		if testCase.expectedMessage == "" {
+			assert.Nil(t, err, testCase.testName)
+			continue
+		}
+		if assert.NotNil(t, err, testCase.testName) {
+			assert.Equal(t, testCase.expectedMessage, err.Error(), testCase.testName)
+		}
+	}
+}
+
+// mockUserRepo - balances in the repository: the user 1 has 100, the user 2 fails and the others don't exist
+type mockUserRepo struct {
+	repository.User
+}
+
+func (mr mockUserRepo) AdjustBalance(ctx context.Context, adj models.Adjustment) error {
+	switch adj.UserID {
+	case 1:
+		if 100+adj.Amount < 0 {
+			return fmt.Errorf("%w: the balance 100.00 of the user 1 is less than the debit %.2f",
+				repository.ErrAdjustment, -adj.Amount)
+		}
+		return nil
+	case 2:
+		return errors.New("connection reset")
+	}
+	return fmt.Errorf("%w: user with id %d does not exist", repository.ErrAdjustment, adj.UserID)
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"avito/configs"
+	"avito/internal/models"
+	"avito/internal/repository"
+	"avito/internal/tracing"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookBatch - number of deliveries claimed at once
+	webhookBatch = 50
+	// webhookLeaseMargin - time added to the delivery timeout while a claimed delivery is hidden from other replicas
+	webhookLeaseMargin = 30 * time.Second
+	// defaultDeliveriesLimit - number of deliveries returned when the limit is not set
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+	// SignatureHeader - header with the HMAC-SHA256 signature of the payload
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+var (
+	errWebhookURL          = errors.New("webhook url must be an absolute http or https url")
+	errSubscriptionMissing = errors.New("webhook subscription does not exist")
+	errDeliveryMissing     = errors.New("webhook delivery does not exist or its subscription has been deleted")
+	errDeliveryStatus      = fmt.Errorf("delivery status must be one of: %s, %s, %s",
+		models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead)
+)
+
+// WebhookService - object in the service layer that manages the webhook subscriptions and delivers
+// the events enqueued by the repository together with the balance changes
+type WebhookService struct {
+	repo   repository.Webhook
+	config configs.ConfigWebhooks
+	client *fasthttp.Client
+}
+
+// NewWebhookService - constructor function for WebhookService
+func NewWebhookService(repo repository.Webhook, config configs.ConfigWebhooks) *WebhookService {
+	return &WebhookService{
+		repo:   repo,
+		config: config,
+		client: &fasthttp.Client{
+			ReadTimeout:  config.WebhookTimeout,
+			WriteTimeout: config.WebhookTimeout,
+		},
+	}
+}
+
+// CreateSubscription - method adds the subscription, the secret is generated when it is not supplied
+func (w *WebhookService) CreateSubscription(ctx context.Context, s *models.WebhookSubscription) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateSubscription")
+	defer func() { tracing.End(span, code, err) }()
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 400, errWebhookURL
+	}
+	if s.Secret == "" {
+		b := make([]byte, 32)
+		if _, err = rand.Read(b); err != nil {
+			return 500, fmt.Errorf("secret generation error: %s", err.Error())
+		}
+		s.Secret = hex.EncodeToString(b)
+	}
+	if err = w.repo.CreateSubscription(ctx, s); err != nil {
+		return 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return 201, nil
+}
+
+// GetSubscriptions - method returns the active subscriptions
+func (w *WebhookService) GetSubscriptions(ctx context.Context) (subscriptions []models.WebhookSubscription, code int,
+	err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetSubscriptions")
+	defer func() { tracing.End(span, code, err) }()
+	subscriptions, err = w.repo.GetSubscriptions(ctx)
+	if err != nil {
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return subscriptions, 200, nil
+}
+
+// DeleteSubscription - method deletes the subscription, its pending deliveries are dead-lettered
+func (w *WebhookService) DeleteSubscription(ctx context.Context, id int) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteSubscription")
+	defer func() { tracing.End(span, code, err) }()
+	if err = w.repo.DeleteSubscription(ctx, id); err != nil {
+		if err.Error() == errNoRows {
+			return 404, errSubscriptionMissing
+		}
+		return 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return 200, nil
+}
+
+// GetDeliveries - method returns the latest deliveries, newest first
+func (w *WebhookService) GetDeliveries(ctx context.Context,
+	f models.WebhookDeliveryFilter) (deliveries []models.WebhookDelivery,
+	code int, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetDeliveries")
+	defer func() { tracing.End(span, code, err) }()
+	switch f.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		return nil, 400, errDeliveryStatus
+	}
+	if f.Limit < 0 || f.Limit > maxDeliveriesLimit {
+		return nil, 400, fmt.Errorf("limit must be between 1 and %d", maxDeliveriesLimit)
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultDeliveriesLimit
+	}
+	deliveries, err = w.repo.GetDeliveries(ctx, f)
+	if err != nil {
+		return nil, 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return deliveries, 200, nil
+}
+
+// ReplayDelivery - method schedules the delivery again regardless of its status, the payload is sent
+// as it was recorded, so the receivers recognize the replayed event by its id
+func (w *WebhookService) ReplayDelivery(ctx context.Context, id int64) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.ReplayDelivery")
+	defer func() { tracing.End(span, code, err) }()
+	if err = w.repo.ReplayDelivery(ctx, id); err != nil {
+		if err.Error() == errNoRows {
+			return 404, errDeliveryMissing
+		}
+		return 500, fmt.Errorf("database error: %s", err.Error())
+	}
+	return 202, nil
+}
+
+// RunWebhooks - delivers the due events until the context is cancelled. The deliveries are claimed
+// with a lease, so the replicas share the queue without sending an event twice
+func (w *WebhookService) RunWebhooks(ctx context.Context, onError func(err error)) {
+	ticker := time.NewTicker(w.config.WebhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// a full batch means more deliveries are due, they are taken without waiting for the next tick
+		for ctx.Err() == nil {
+			deliveries, err := w.repo.ClaimDeliveries(ctx, webhookBatch, w.config.WebhookTimeout+webhookLeaseMargin)
+			if err != nil {
+				onError(fmt.Errorf("webhook deliveries claiming error: %w", err))
+				break
+			}
+			var wg sync.WaitGroup
+			for _, d := range deliveries {
+				wg.Add(1)
+				go func(d models.WebhookDelivery) {
+					defer wg.Done()
+					if err := w.repo.RecordAttempt(ctx, w.deliver(d)); err != nil {
+						onError(fmt.Errorf("webhook delivery %d recording error: %w", d.DeliveryID, err))
+					}
+				}(d)
+			}
+			wg.Wait()
+			if len(deliveries) < webhookBatch {
+				break
+			}
+		}
+	}
+}
+
+// deliver - posts the payload to the subscriber and decides on the next attempt.
+// Any 2xx response acknowledges the event
+func (w *WebhookService) deliver(d models.WebhookDelivery) models.DeliveryAttempt {
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(d.URL)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	req.Header.Set("X-Webhook-Id", d.EventID)
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.DeliveryID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set(SignatureHeader, SignPayload(d.Secret, timestamp, d.Payload))
+	req.SetBody(d.Payload)
+
+	attempt := models.DeliveryAttempt{DeliveryID: d.DeliveryID, Status: models.DeliveryDelivered, NextAttemptAt: now}
+	err := w.client.DoTimeout(req, resp, w.config.WebhookTimeout)
+	if err == nil {
+		attempt.StatusCode = resp.StatusCode()
+		if attempt.StatusCode >= 200 && attempt.StatusCode < 300 {
+			return attempt
+		}
+		err = fmt.Errorf("unexpected status code %d", attempt.StatusCode)
+	}
+	attempt.Error = err.Error()
+	attempts := d.Attempts + 1
+	if attempts >= w.config.WebhookMaxAttempts {
+		attempt.Status = models.DeliveryDead
+		return attempt
+	}
+	attempt.Status = models.DeliveryPending
+	attempt.NextAttemptAt = now.Add(w.backoff(attempts))
+	return attempt
+}
+
+// backoff - delay before the next attempt, doubled after every failed attempt up to WebhookBackoffMax
+func (w *WebhookService) backoff(attempts int) time.Duration {
+	delay := w.config.WebhookBackoffBase
+	for i := 1; i < attempts && delay < w.config.WebhookBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > w.config.WebhookBackoffMax {
+		delay = w.config.WebhookBackoffMax
+	}
+	return delay
+}
+
+// SignPayload - returns the signature header value: sha256= followed by the hex HMAC-SHA256
+// of the timestamp, a dot and the body, keyed with the secret of the subscription
+func SignPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
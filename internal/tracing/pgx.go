@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// QueryLogger - pgx logger that records the span of each SQL statement after it is executed. The statements
+// are recorded only within a recorded span, so the statements of the background workers are not traced
+type QueryLogger struct {
+	attributes []attribute.KeyValue
+}
+
+// NewQueryLogger - constructor function for QueryLogger with the attributes of the database
+func NewQueryLogger(host string, port int, database, user string) *QueryLogger {
+	return &QueryLogger{attributes: []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		semconv.DBNameKey.String(database),
+		semconv.DBUserKey.String(user),
+		semconv.NetPeerNameKey.String(host),
+		semconv.NetPeerPortKey.Int(port),
+	}}
+}
+
+// Log - records the span of the executed statement, the other messages of pgx are skipped
+func (l *QueryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return
+	}
+	duration, ok := data["time"].(time.Duration)
+	if !ok {
+		return
+	}
+	attributes := append(make([]attribute.KeyValue, 0, len(l.attributes)+3), l.attributes...)
+	name := msg
+	if sql, ok := data["sql"].(string); ok {
+		operation := strings.ToUpper(strings.SplitN(strings.TrimSpace(sql), " ", 2)[0])
+		name = operation
+		attributes = append(attributes, semconv.DBStatementKey.String(sql), semconv.DBOperationKey.String(operation))
+	}
+	if rows, ok := data["rowCount"].(int); ok {
+		attributes = append(attributes, attribute.Int("db.rows", rows))
+	}
+	end := time.Now()
+	// the statement has already been executed, so the span is recorded with its real start and end
+	_, span := Tracer().Start(ctx, name, trace.WithTimestamp(end.Add(-duration)),
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,139 @@
+// Package tracing contains the OpenTelemetry tracing of the application: the export of the spans, the propagation
+// of the W3C trace context in the HTTP headers and the spans of the calls and the SQL statements
+package tracing
+
+import (
+	"avito/configs"
+	"context"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+const (
+	ExporterNone     = "none"
+	ExporterStdout   = "stdout"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	// RequestContextKey - key of the user value of the request holding the context with the span of the request
+	RequestContextKey = "request_context"
+	instrumentation   = "avito"
+)
+
+// Init - sets the global tracer provider that exports the spans with the configured exporter and the W3C
+// trace context propagator. With the none exporter the spans are not recorded. The returned function
+// flushes the exported spans
+func Init(cfg configs.ConfigTracing) (shutdown func(ctx context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+	var exporter sdktrace.SpanExporter
+	switch cfg.TracingExporter {
+	case ExporterNone, "":
+		return func(ctx context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLPGRPC:
+		options := []otlptracegrpc.Option{}
+		if cfg.TracingEndpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(cfg.TracingEndpoint))
+		}
+		if cfg.TracingInsecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), options...)
+	case ExporterOTLPHTTP:
+		options := []otlptracehttp.Option{}
+		if cfg.TracingEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.TracingEndpoint))
+		}
+		if cfg.TracingInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, expected one of: %s, %s, %s, %s", cfg.TracingExporter,
+			ExporterNone, ExporterStdout, ExporterOTLPGRPC, ExporterOTLPHTTP)
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(cfg.TracingServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer - returns the tracer of the application
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Extract - returns the context with the remote span of the traceparent header of the request
+func Extract(header *fasthttp.RequestHeader) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), HeaderCarrier{Header: header})
+}
+
+// FromRequest - returns the context of the request passed to the service layer, it carries the span of the request.
+// The context of the request is not cancelled when the client goes away
+func FromRequest(ctx *fasthttp.RequestCtx) context.Context {
+	if c, ok := ctx.UserValue(RequestContextKey).(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
+
+// Start - starts the span of the call as a child of the span in the context
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End - records the status code and the error of the call and ends the span. The status code is not recorded
+// when it is 0, the span is marked as failed by a server error or by an error without the status code
+func End(span trace.Span, code int, err error) {
+	if code != 0 {
+		span.SetAttributes(attribute.Int("avito.status_code", code))
+	}
+	if err != nil {
+		span.RecordError(err)
+		if code == 0 || code >= 500 {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+// HeaderCarrier - adapts the headers of the fasthttp request to the propagation of the trace context
+type HeaderCarrier struct {
+	Header *fasthttp.RequestHeader
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	return string(c.Header.Peek(key))
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	c.Header.Set(key, value)
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0)
+	c.Header.VisitAll(func(key, value []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
@@ -1,5 +1,7 @@
 package logger
 
+import "context"
+
 // Logger - interface describing the logger
 type Logger interface {
 	Errorf(format string, args ...interface{})
@@ -12,4 +14,8 @@ type Logger interface {
 	Debug(args ...interface{})
 	Panicf(format string, args ...interface{})
 	Printf(format string, args ...interface{})
+	// WithFields - returns the logger adding the fields to each line
+	WithFields(fields Fields) Logger
+	// WithContext - returns the logger adding the fields of the context and the trace ID to each line
+	WithContext(ctx context.Context) Logger
 }
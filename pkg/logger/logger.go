@@ -2,22 +2,97 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"io"
 	"os"
 )
 
+// Fields - fields of the log line, the keys are the names of the fields
+type Fields map[string]interface{}
+
+// fieldsKey - key of the context value holding the fields of the log
+type fieldsKey struct{}
+
 // Log - event logging object
 type Log struct {
 	*logrus.Entry
 }
 
-// New - constructor function for Log
+// New - constructor function for Log. The log is written to stdout with the info level until it is configured
 func New() *Log {
 	l := logrus.New()
 	l.Formatter = &logrus.TextFormatter{
 		DisableColors: false,
 	}
-	l.SetLevel(logrus.DebugLevel)
+	l.SetLevel(logrus.InfoLevel)
 	l.SetOutput(os.Stdout)
 	return &Log{logrus.NewEntry(l)}
 }
+
+// Configure - sets the level (debug, info, warn or error), the format (text or json) and the output
+// (stdout or stderr) of the log
+func (l *Log) Configure(level, format, output string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.Logger.SetLevel(lvl)
+	switch format {
+	case "json":
+		l.Logger.SetFormatter(&logrus.JSONFormatter{})
+	case "text":
+		l.Logger.SetFormatter(&logrus.TextFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+	var w io.Writer
+	switch output {
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		return fmt.Errorf("unknown log output %q, expected stdout or stderr", output)
+	}
+	l.Logger.SetOutput(w)
+	return nil
+}
+
+// WithFields - returns the logger adding the fields to each line
+func (l *Log) WithFields(fields Fields) Logger {
+	return &Log{l.Entry.WithFields(logrus.Fields(fields))}
+}
+
+// WithContext - returns the logger adding the fields of the context and the ID of the trace to each line
+func (l *Log) WithContext(ctx context.Context) Logger {
+	fields := logrus.Fields{}
+	for k, v := range FieldsFromContext(ctx) {
+		fields[k] = v
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+	return &Log{l.Entry.WithContext(ctx).WithFields(fields)}
+}
+
+// ContextWithFields - returns the context carrying the fields in addition to the fields of the parent context
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	parent := FieldsFromContext(ctx)
+	merged := make(Fields, len(parent)+len(fields))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FieldsFromContext - returns the fields of the log carried by the context
+func FieldsFromContext(ctx context.Context) Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(Fields)
+	return fields
+}
@@ -0,0 +1,6 @@
+ALTER TABLE orders
+    ALTER COLUMN date_time TYPE timestamp
+        USING date_time AT TIME ZONE coalesce(nullif(current_setting('avito.legacy_timezone', true), ''), 'UTC');
+ALTER TABLE transactions
+    ALTER COLUMN date_time TYPE timestamp
+        USING date_time AT TIME ZONE coalesce(nullif(current_setting('avito.legacy_timezone', true), ''), 'UTC');
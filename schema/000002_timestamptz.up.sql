@@ -0,0 +1,8 @@
+-- the timestamps written before were the wall clock of the service in its time zone, they are converted
+-- from the zone set by MIGRATE_LEGACY_TIMEZONE (UTC when it is not set)
+ALTER TABLE transactions
+    ALTER COLUMN date_time TYPE timestamptz
+        USING date_time AT TIME ZONE coalesce(nullif(current_setting('avito.legacy_timezone', true), ''), 'UTC');
+ALTER TABLE orders
+    ALTER COLUMN date_time TYPE timestamptz
+        USING date_time AT TIME ZONE coalesce(nullif(current_setting('avito.legacy_timezone', true), ''), 'UTC');
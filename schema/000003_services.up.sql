@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS services
+(
+    service_id integer PRIMARY KEY,
+    name varchar(255) NOT NULL,
+    debit_account varchar(32),
+    credit_account varchar(32)
+);
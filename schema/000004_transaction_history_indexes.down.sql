@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS transactions_user_id_amount_idx;
+DROP INDEX IF EXISTS transactions_user_id_date_time_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS transactions_user_id_date_time_idx ON transactions (user_id, date_time, transaction_id);
+CREATE INDEX IF NOT EXISTS transactions_user_id_amount_idx ON transactions (user_id, amount, transaction_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS transactions_order_id_idx;
+DROP INDEX IF EXISTS transactions_user_id_operation_idx;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_check;
+DELETE FROM transactions WHERE operation = 'charge';
+ALTER TABLE transactions DROP COLUMN IF EXISTS external_reference;
+ALTER TABLE transactions DROP COLUMN IF EXISTS counterparty_user_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS service_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS order_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS operation;
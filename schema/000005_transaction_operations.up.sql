@@ -0,0 +1,65 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS operation varchar(32);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS order_id integer;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS service_id integer;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS counterparty_user_id integer;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS external_reference varchar(255);
+
+-- the counterparty of old transfers is only known from the message
+UPDATE transactions
+SET counterparty_user_id = substring(message from '(\d+)$')::integer
+WHERE counterparty_user_id IS NULL
+  AND (message LIKE 'outgoing transfer to the user %' OR message LIKE 'incoming transfer from user %');
+
+-- old reservation debits have no reference to the order, they were written by the user with the amount
+-- and the date of the order, which identify the order unless the user placed several orders of the same
+-- amount in the same second, such debits are left without the order. The amount of the cancelled order
+-- was set to zero
+WITH candidates AS (
+    SELECT t.transaction_id, o.order_id
+    FROM transactions t
+    JOIN orders o ON o.user_id = t.user_id
+        AND o.date_time = t.date_time
+        AND (o.amount = -t.amount OR (o.amount = 0 AND o.block = false))
+    WHERE t.order_id IS NULL
+      AND t.message = 'service payment'),
+unique_candidates AS (
+    SELECT transaction_id, order_id
+    FROM candidates c
+    WHERE (SELECT count(*) FROM candidates d WHERE d.transaction_id = c.transaction_id) = 1
+      AND (SELECT count(*) FROM candidates d WHERE d.order_id = c.order_id) = 1)
+UPDATE transactions t
+SET order_id = u.order_id
+FROM unique_candidates u
+WHERE t.transaction_id = u.transaction_id;
+
+UPDATE transactions
+SET operation = CASE
+    WHEN message = 'replenishment of the balance' THEN 'accrual'
+    WHEN message = 'service payment' THEN 'reservation'
+    WHEN message = 'cancellation of service payment' THEN 'cancellation'
+    WHEN message LIKE 'outgoing transfer to the user %' THEN 'transfer_out'
+    WHEN message LIKE 'incoming transfer from user %' THEN 'transfer_in'
+    WHEN amount < 0 THEN 'reservation'
+    ELSE 'accrual'
+END
+WHERE operation IS NULL;
+
+UPDATE transactions t
+SET service_id = o.service_id
+FROM orders o
+WHERE t.service_id IS NULL
+  AND t.order_id = o.order_id;
+
+ALTER TABLE transactions ALTER COLUMN operation SET NOT NULL;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_check CHECK (operation IN
+    ('accrual', 'reservation', 'charge', 'cancellation', 'transfer_in', 'transfer_out', 'refund'));
+CREATE INDEX IF NOT EXISTS transactions_user_id_operation_idx ON transactions (user_id, operation);
+CREATE INDEX IF NOT EXISTS transactions_order_id_idx ON transactions (order_id);
+
+INSERT INTO transactions (user_id, amount, date_time, message, operation, order_id, service_id)
+SELECT o.user_id, 0, o.date_time, 'charge of service payment', 'charge', o.order_id, o.service_id
+FROM orders o
+WHERE o.block = false
+  AND o.amount <> 0
+  AND NOT EXISTS (SELECT 1 FROM transactions t WHERE t.order_id = o.order_id AND t.operation = 'charge');
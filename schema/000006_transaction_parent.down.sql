@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS transactions_parent_transaction_id_idx;
+ALTER TABLE transactions DROP COLUMN IF EXISTS parent_transaction_id;
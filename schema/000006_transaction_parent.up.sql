@@ -0,0 +1,36 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS parent_transaction_id integer REFERENCES transactions (transaction_id);
+
+-- the incoming side of a transfer refers to the outgoing one, both were written in the same second
+UPDATE transactions t
+SET parent_transaction_id = (
+    SELECT p.transaction_id
+    FROM transactions p
+    WHERE p.operation = 'transfer_out'
+      AND p.user_id = t.counterparty_user_id
+      AND p.counterparty_user_id = t.user_id
+      AND p.amount = -t.amount
+      AND p.date_time = t.date_time
+    ORDER BY p.transaction_id
+    LIMIT 1)
+WHERE t.parent_transaction_id IS NULL
+  AND t.operation = 'transfer_in';
+
+-- charges and cancellations refer to the reservation of the order
+UPDATE transactions t
+SET parent_transaction_id = p.transaction_id
+FROM transactions p
+WHERE t.parent_transaction_id IS NULL
+  AND t.operation IN ('charge', 'cancellation')
+  AND p.operation = 'reservation'
+  AND p.order_id = t.order_id;
+
+-- refunds refer to the charge of the order
+UPDATE transactions t
+SET parent_transaction_id = p.transaction_id
+FROM transactions p
+WHERE t.parent_transaction_id IS NULL
+  AND t.operation = 'refund'
+  AND p.operation = 'charge'
+  AND p.order_id = t.order_id;
+
+CREATE INDEX IF NOT EXISTS transactions_parent_transaction_id_idx ON transactions (parent_transaction_id);
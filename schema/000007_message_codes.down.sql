@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS message_params;
+ALTER TABLE transactions DROP COLUMN IF EXISTS message_code;
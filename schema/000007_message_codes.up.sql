@@ -0,0 +1,16 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS message_code varchar(64);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS message_params jsonb;
+
+-- only the default messages are replaced by templates, comments supplied by the callers are kept as they are
+UPDATE transactions
+SET message_code = operation,
+    message_params = jsonb_strip_nulls(jsonb_build_object(
+        'order_id', order_id::text,
+        'service_id', service_id::text,
+        'counterparty_user_id', counterparty_user_id::text))
+WHERE message_code IS NULL
+  AND (message IN ('replenishment of the balance', 'service payment', 'cancellation of service payment',
+                   'charge of service payment')
+    OR message LIKE 'outgoing transfer to the user %'
+    OR message LIKE 'incoming transfer from user %'
+    OR message LIKE 'refund for the order %');
@@ -0,0 +1,26 @@
+-- new transactions are published to the listeners of the replicas when the transaction commits,
+-- the payload carries the balance of the user after the transaction
+CREATE OR REPLACE FUNCTION notify_transaction() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('transactions', json_build_object(
+        'transaction_id', NEW.transaction_id,
+        'user_id', NEW.user_id,
+        'amount', NEW.amount,
+        'date', NEW.date_time,
+        'message', NEW.message,
+        'operation', NEW.operation,
+        'order_id', NEW.order_id,
+        'service_id', NEW.service_id,
+        'counterparty_user_id', NEW.counterparty_user_id,
+        'external_reference', NEW.external_reference,
+        'parent_transaction_id', NEW.parent_transaction_id,
+        'message_code', NEW.message_code,
+        'message_params', NEW.message_params,
+        'balance', (SELECT balance FROM users WHERE user_id = NEW.user_id))::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS transactions_notify ON transactions;
+CREATE TRIGGER transactions_notify AFTER INSERT ON transactions
+    FOR EACH ROW EXECUTE PROCEDURE notify_transaction();
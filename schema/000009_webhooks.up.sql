@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions
+(
+    subscription_id serial PRIMARY KEY,
+    url varchar(2048) NOT NULL,
+    event_types text[] NOT NULL,
+    secret varchar(255) NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    deleted_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    delivery_id bigserial PRIMARY KEY,
+    subscription_id integer NOT NULL REFERENCES webhook_subscriptions (subscription_id),
+    event_id uuid NOT NULL,
+    event_type varchar(64) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_status_code integer,
+    last_error text,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    delivered_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, status, delivery_id);
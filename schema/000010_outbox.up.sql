@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    outbox_id bigserial PRIMARY KEY,
+    event_id uuid NOT NULL UNIQUE,
+    event_type varchar(64) NOT NULL,
+    user_id integer NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    published_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (outbox_id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_published_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
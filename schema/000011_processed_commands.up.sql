@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS processed_commands
+(
+    message_id varchar(255) PRIMARY KEY,
+    command_type text NOT NULL,
+    status_code integer,
+    description text,
+    claimed_at timestamptz NOT NULL DEFAULT now(),
+    processed_at timestamptz
+);
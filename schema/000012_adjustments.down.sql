@@ -0,0 +1,4 @@
+-- fails while the adjustments are in the history
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_check CHECK (operation IN
+    ('accrual', 'reservation', 'charge', 'cancellation', 'transfer_in', 'transfer_out', 'refund'));
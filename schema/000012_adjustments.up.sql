@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_check CHECK (operation IN
+    ('accrual', 'reservation', 'charge', 'cancellation', 'transfer_in', 'transfer_out', 'refund', 'adjustment'));
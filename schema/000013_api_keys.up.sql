@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    key_id serial PRIMARY KEY,
+    client varchar(64) NOT NULL,
+    scopes text[] NOT NULL,
+    prefix varchar(16) NOT NULL,
+    key_hash char(64) NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    revoked_at timestamptz
+);
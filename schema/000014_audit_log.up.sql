@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    audit_id bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    client varchar(64) NOT NULL,
+    key_id integer,
+    method varchar(16) NOT NULL,
+    endpoint varchar(255) NOT NULL,
+    request_id varchar(128) NOT NULL,
+    source_ip varchar(64) NOT NULL,
+    payload jsonb NOT NULL,
+    status_code integer NOT NULL,
+    outcome varchar(16) NOT NULL CHECK (outcome IN ('success', 'failure')),
+    message text NOT NULL,
+    balances jsonb,
+    prev_hash char(64) NOT NULL,
+    hash char(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS audit_log_client_idx ON audit_log (client, audit_id);
+
+-- the log is append-only: the entries can't be changed or deleted by the application role
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_immutable ON audit_log;
+CREATE TRIGGER audit_log_immutable BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_immutable();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_immutable();
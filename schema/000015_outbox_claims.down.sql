@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_claim_id_idx;
+ALTER TABLE outbox DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE outbox DROP COLUMN IF EXISTS claim_id;
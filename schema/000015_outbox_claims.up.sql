@@ -0,0 +1,6 @@
+-- the relay claims a batch of the events before it publishes them outside the database transaction,
+-- the claim of a relay that stopped expires and the events are claimed again
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS claim_id uuid;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS claimed_until timestamptz;
+
+CREATE INDEX IF NOT EXISTS outbox_claim_id_idx ON outbox (claim_id) WHERE claim_id IS NOT NULL;
@@ -0,0 +1,2 @@
+-- the key issued for a user-facing client is bound to the user, its calls are limited to the data of the user
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS user_id integer;
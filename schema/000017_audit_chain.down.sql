@@ -0,0 +1,12 @@
+-- the entries that are not chained yet must be chained by the server before the downgrade
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS audit_log_unchained_idx;
+ALTER TABLE audit_log DROP CONSTRAINT IF EXISTS audit_log_chained_check;
+ALTER TABLE audit_log ALTER COLUMN hash SET NOT NULL;
+ALTER TABLE audit_log ALTER COLUMN prev_hash SET NOT NULL;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS chain_seq;
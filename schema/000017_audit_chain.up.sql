@@ -0,0 +1,26 @@
+-- the entries are appended without the hash by the transactions that change the balances and are chained
+-- afterwards in the order of chain_seq, so the appends of the unrelated calls don't wait for each other
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS chain_seq bigint UNIQUE;
+ALTER TABLE audit_log DISABLE TRIGGER audit_log_immutable;
+UPDATE audit_log SET chain_seq = audit_id WHERE chain_seq IS NULL;
+ALTER TABLE audit_log ENABLE TRIGGER audit_log_immutable;
+ALTER TABLE audit_log ALTER COLUMN prev_hash DROP NOT NULL;
+ALTER TABLE audit_log ALTER COLUMN hash DROP NOT NULL;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_chained_check
+    CHECK ((chain_seq IS NULL) = (hash IS NULL) AND (chain_seq IS NULL) = (prev_hash IS NULL));
+
+CREATE INDEX IF NOT EXISTS audit_log_unchained_idx ON audit_log (audit_id) WHERE chain_seq IS NULL;
+
+-- the entry is chained once: its position and hashes are set, the entry itself can't be changed
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        IF OLD.chain_seq IS NULL AND NEW.chain_seq IS NOT NULL
+            AND to_jsonb(NEW) - ARRAY['chain_seq', 'prev_hash', 'hash']
+                = to_jsonb(OLD) - ARRAY['chain_seq', 'prev_hash', 'hash'] THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
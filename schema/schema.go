@@ -0,0 +1,10 @@
+// Package schema contains the versioned migrations of the database. They are embedded into the binary
+// and applied by the migrate command or at startup
+package schema
+
+import "embed"
+
+// Migrations - files of the migrations named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var Migrations embed.FS